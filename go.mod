@@ -3,7 +3,10 @@ module github.com/IgorRybak2055/speed-control-service
 go 1.13
 
 require (
+	github.com/golang/protobuf v1.3.2
 	github.com/json-iterator/go v1.1.9
 	github.com/luno/jettison v0.0.0-20191223144501-7fe4a971f291
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/net v0.0.0-20190724013045-ca1201d0de80
+	google.golang.org/grpc v1.22.1
 )
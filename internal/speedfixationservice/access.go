@@ -0,0 +1,234 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/pkg/env"
+)
+
+// Roles of query users granted by tokens, cameras are authenticated by their keys
+const (
+	roleAnalyst = "analyst"
+	roleOfficer = "officer"
+	roleAdmin   = "admin"
+)
+
+var (
+	// queryRoles see fixations, analysts see pseudonymized plates only
+	queryRoles = []string{roleAnalyst, roleOfficer, roleAdmin}
+	// officerRoles see full plates and work with evidence
+	officerRoles = []string{roleOfficer, roleAdmin}
+	adminRoles   = []string{roleAdmin}
+)
+
+// pseudonymizedFields are replaced by pseudonyms in responses of analysts, evidence is dropped
+// because plate can be recovered by checking its signature with all possible plates
+var pseudonymizedFields = map[string]bool{"vehicle_number": true, "raw_vehicle_number": true}
+
+// claimsKey is the context key of verified token claims
+type claimsKey struct{}
+
+// tokenKeySet reads key set which validates tokens of query users, nil key set opens query routes
+// and closes officer and admin ones
+func tokenKeySet() (*jwt.KeySet, error) {
+	path := env.GetString("jwksFile", "")
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return jwt.LoadKeySet(file, jwt.Config{Issuer: env.GetString("jwtIssuer", ""), Audience: env.GetString("jwtAudience", "")})
+}
+
+// bearerToken returns token of Authorization header
+func bearerToken(header string) string {
+	const prefix = "bearer "
+
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return strings.TrimSpace(header[len(prefix):])
+	}
+
+	return ""
+}
+
+// openRoute reports whether route allowed to roles is open without key set, only query routes are,
+// officer and admin routes show plates and change the service
+func openRoute(roles []string) bool {
+	for _, role := range roles {
+		if role == roleAnalyst {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizeToken verifies token and checks that it grants one of roles
+func (srv *service) authorizeToken(token string, roles []string) (jwt.Claims, error) {
+	if srv.tokens == nil {
+		return jwt.Claims{}, errors.Wrap(jwt.ErrInvalidToken, "tokens can not be verified, jwksFile is not configured")
+	}
+
+	if token == "" {
+		return jwt.Claims{}, errors.Wrap(jwt.ErrInvalidToken, "bearer token is required")
+	}
+
+	claims, err := srv.tokens.Verify(token, srv.now())
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+
+	// claims of denied user are returned for audit
+	if !claims.HasRole(roles...) {
+		return claims, errForbidden
+	}
+
+	return claims, nil
+}
+
+// authorize lets through requests with token granting one of roles
+func (srv *service) authorize(roles []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.tokens == nil && openRoute(roles) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := srv.authorizeToken(bearerToken(r.Header.Get("Authorization")), roles)
+		auditUser(r.Context(), claims)
+
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+// pseudonymous reports whether user of the request sees pseudonymized plates
+func pseudonymous(ctx context.Context) bool {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.Claims)
+	return ok && !claims.HasRole(officerRoles...)
+}
+
+// pseudonym returns stable pseudonym of vehicle number, it can not be reversed without the key
+func (srv *service) pseudonym(number string) string {
+	if number == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, srv.pseudonymKey)
+	mac.Write([]byte(plate.Normalize(number)))
+
+	return "P-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// pseudonymizeValue replaces plates in decoded JSON value
+func (srv *service) pseudonymizeValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		delete(v, "evidence")
+
+		for name, field := range v {
+			if number, ok := field.(string); ok && pseudonymizedFields[name] {
+				v[name] = srv.pseudonym(number)
+				continue
+			}
+
+			srv.pseudonymizeValue(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			srv.pseudonymizeValue(item)
+		}
+	}
+}
+
+// pseudonymizeJSON replaces plates in JSON response of analyst, other responses are returned as is
+func (srv *service) pseudonymizeJSON(ctx context.Context, data []byte) ([]byte, error) {
+	if !pseudonymous(ctx) {
+		return data, nil
+	}
+
+	var v interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	srv.pseudonymizeValue(v)
+
+	return json.Marshal(v)
+}
+
+// pseudonymWriter keeps response to replace plates in it
+type pseudonymWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (pw *pseudonymWriter) WriteHeader(status int) {
+	pw.status = status
+}
+
+func (pw *pseudonymWriter) Write(b []byte) (int, error) {
+	return pw.body.Write(b)
+}
+
+// pseudonymize replaces plates in JSON responses of analysts
+func (srv *service) pseudonymize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !pseudonymous(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pw := &pseudonymWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(pw, r)
+
+		body := pw.body.Bytes()
+
+		// error responses do not contain plates
+		if pw.status < http.StatusBadRequest {
+			var err error
+
+			if body, err = srv.pseudonymizeJSON(r.Context(), body); err != nil {
+				responseError(w, err)
+				return
+			}
+		}
+
+		w.WriteHeader(pw.status)
+		_, _ = w.Write(body)
+	})
+}
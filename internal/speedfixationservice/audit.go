@@ -0,0 +1,274 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/luno/jettison/errors"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	pb "github.com/IgorRybak2055/speed-control-service/pkg/speedcontrolpb"
+)
+
+// auditKey is the context key of audit entry of the request
+type auditKey struct{}
+
+// auditEntry returns audit entry of the request, it is nil when the request is not audited
+func auditEntry(ctx context.Context) *repo.AuditEntry {
+	entry, _ := ctx.Value(auditKey{}).(*repo.AuditEntry)
+	return entry
+}
+
+// auditUser records user of token in audit entry
+func auditUser(ctx context.Context, claims jwt.Claims) {
+	if entry := auditEntry(ctx); entry != nil {
+		entry.User, entry.Roles = claims.Subject, claims.Roles
+	}
+}
+
+// auditRecords adds records sent by streaming handler to audit entry
+func auditRecords(ctx context.Context, n int) {
+	if entry := auditEntry(ctx); entry != nil {
+		entry.Records += n
+	}
+}
+
+// requestPlates returns normalized plates looked up by request parameters
+func requestPlates(params url.Values) []string {
+	var ret []string
+
+	for _, name := range []string{"plate", "vehicle_number"} {
+		for _, value := range params[name] {
+			if value != "" {
+				ret = append(ret, plate.Normalize(value))
+			}
+		}
+	}
+
+	for _, value := range params["filter"] {
+		if expr, err := filter.Parse(value); err == nil {
+			ret = append(ret, filter.Values(expr, "plate")...)
+		}
+	}
+
+	return ret
+}
+
+// countRecords returns the number of fixations and vehicles in decoded JSON response
+func countRecords(v interface{}) int {
+	var n int
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v["vehicle_number"]; ok {
+			return 1
+		}
+
+		for _, field := range v {
+			n += countRecords(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			n += countRecords(item)
+		}
+	}
+
+	return n
+}
+
+// auditWriter keeps response to count returned records, streamed responses are counted by handlers
+type auditWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (aw *auditWriter) WriteHeader(status int) {
+	aw.status = status
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *auditWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+
+	if !aw.streaming {
+		aw.body.Write(b)
+	}
+
+	return aw.ResponseWriter.Write(b)
+}
+
+func (aw *auditWriter) Flush() {
+	aw.streaming = true
+	aw.body.Reset()
+
+	if flusher, ok := aw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (aw *auditWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := aw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can not be hijacked")
+	}
+
+	aw.streaming = true
+	aw.status = http.StatusSwitchingProtocols
+
+	return hijacker.Hijack()
+}
+
+// appendAudit stores audit entry, the response is already sent, so failure is only logged
+func (srv *service) appendAudit(entry repo.AuditEntry) {
+	if err := srv.audits.Append(entry); err != nil {
+		log.Printf("unable store audit entry of request %v: %v", entry.RequestID, err)
+	}
+}
+
+// audit records who accessed data with which parameters and how many records were returned
+func (srv *service) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.audits == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		params := r.URL.Query()
+		entry := &repo.AuditEntry{
+			Time:       srv.now().UTC(),
+			Method:     r.Method,
+			Path:       routePath(r.URL.Path),
+			Params:     params,
+			Plates:     requestPlates(params),
+			RequestID:  w.Header().Get(requestIDHeader),
+			RemoteAddr: r.RemoteAddr,
+		}
+
+		aw := &auditWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+
+		entry.Status = aw.status
+
+		if !aw.streaming && aw.status < http.StatusBadRequest {
+			var v interface{}
+			if err := json.Unmarshal(aw.body.Bytes(), &v); err == nil {
+				entry.Records = countRecords(v)
+			}
+		}
+
+		srv.appendAudit(*entry)
+	})
+}
+
+func (srv service) auditList(w http.ResponseWriter, r *http.Request) {
+	var (
+		conditions = repo.AuditConditions{User: r.FormValue("user"), Plate: r.FormValue("plate")}
+		err        error
+	)
+
+	if from := r.FormValue("from"); from != "" {
+		if conditions.From, err = time.Parse(time.RFC3339Nano, from); err != nil {
+			responseError(w, fieldError("from", "unable parse datetime"))
+			return
+		}
+	}
+
+	if to := r.FormValue("to"); to != "" {
+		if conditions.To, err = time.Parse(time.RFC3339Nano, to); err != nil {
+			responseError(w, fieldError("to", "unable parse datetime"))
+			return
+		}
+	}
+
+	resp, err := srv.audits.LookUp(conditions)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+// callAudit starts audit entry of gRPC call, it is nil when audit is disabled
+func (srv *service) callAudit(ctx context.Context, method string) (context.Context, *repo.AuditEntry) {
+	if srv.audits == nil {
+		return ctx, nil
+	}
+
+	entry := &repo.AuditEntry{Time: srv.now().UTC(), Method: "GRPC", Path: method}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.RemoteAddr = p.Addr.String()
+	}
+
+	return context.WithValue(ctx, auditKey{}, entry), entry
+}
+
+// auditRequest records parameters and plates of gRPC request in audit entry
+func auditRequest(ctx context.Context, m interface{}) {
+	entry := auditEntry(ctx)
+	msg, ok := m.(proto.Message)
+
+	if entry == nil || !ok {
+		return
+	}
+
+	if data, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(msg); err == nil {
+		entry.Params = map[string][]string{"request": {data}}
+	}
+
+	if req, ok := m.(*pb.QueryRequest); ok {
+		entry.Plates = requestPlates(url.Values{"filter": {req.GetFilter()}})
+	}
+}
+
+// messageRecords returns the number of fixations in gRPC response
+func messageRecords(m interface{}) int {
+	switch m := m.(type) {
+	case *pb.Fixation:
+		return 1
+	case *pb.FixationList:
+		return len(m.GetFixations())
+	case *pb.SpeedStatistics:
+		n := len(m.GetMinTies()) + len(m.GetMaxTies())
+
+		for _, f := range []*pb.Fixation{m.GetMin(), m.GetMax()} {
+			if f != nil {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	return 0
+}
+
+// finishCallAudit stores audit entry of gRPC call with its status code
+func (srv *service) finishCallAudit(entry *repo.AuditEntry, err error) {
+	if entry == nil {
+		return
+	}
+
+	entry.Status = int(status.Code(err))
+	srv.appendAudit(*entry)
+}
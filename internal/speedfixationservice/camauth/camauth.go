@@ -0,0 +1,224 @@
+// Package camauth provides authentication of cameras by signed requests
+package camauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// Headers of signed request
+const (
+	CameraHeader    = "X-Camera-ID"
+	TimestampHeader = "X-Camera-Timestamp"
+	SignatureHeader = "X-Camera-Signature"
+)
+
+// ErrUnauthenticated is returned when request is not signed by active key of the camera
+var ErrUnauthenticated = errors.New("camera is not authenticated", errors.WithCode("unauthenticated"))
+
+// Keyring issues camera keys and verifies signatures made by them
+type Keyring struct {
+	repo repo.CameraRepo
+	// window is the allowed difference between request timestamp and the service clock
+	window time.Duration
+	clock  clock.Clock
+
+	mu sync.Mutex
+	// seen keeps signatures verified within window, so the same request can not be sent again
+	seen map[string]time.Time
+}
+
+// NewKeyring creates keyring of cameras stored in repository
+func NewKeyring(cr repo.CameraRepo, window time.Duration, clk clock.Clock) *Keyring {
+	return &Keyring{
+		repo:   cr,
+		window: window,
+		clock:  clk,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Sign returns signature of the body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newKey(now time.Time) (repo.CameraKey, error) {
+	b := make([]byte, 40)
+	if _, err := rand.Read(b); err != nil {
+		return repo.CameraKey{}, err
+	}
+
+	return repo.CameraKey{ID: hex.EncodeToString(b[:8]), Secret: hex.EncodeToString(b[8:]), Created: now}, nil
+}
+
+// Cameras returns registered cameras without secrets
+func (k *Keyring) Cameras() ([]repo.Camera, error) {
+	cameras, err := k.repo.Cameras()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cameras {
+		keys := make([]repo.CameraKey, len(cameras[i].Keys))
+		for n, key := range cameras[i].Keys {
+			key.Secret = ""
+			keys[n] = key
+		}
+
+		cameras[i].Keys = keys
+	}
+
+	return cameras, nil
+}
+
+// Issue adds new key to the camera, the camera is registered by its first key
+func (k *Keyring) Issue(id string) (repo.CameraKey, error) {
+	return k.Rotate(id, -1)
+}
+
+// Rotate adds new key to the camera, other active keys expire after grace,
+// so the camera has time to switch to the new key. Negative grace keeps them active.
+func (k *Keyring) Rotate(id string, grace time.Duration) (repo.CameraKey, error) {
+	now := k.clock.Now().UTC()
+
+	key, err := newKey(now)
+	if err != nil {
+		return repo.CameraKey{}, err
+	}
+
+	_, err = k.repo.UpdateCamera(id, func(camera *repo.Camera) error {
+		if camera.Created.IsZero() {
+			camera.Created = now
+		}
+
+		if grace >= 0 {
+			for i, old := range camera.Keys {
+				if old.Active(now) && (old.Expires.IsZero() || old.Expires.After(now.Add(grace))) {
+					camera.Keys[i].Expires = now.Add(grace)
+				}
+			}
+		}
+
+		camera.Keys = append(camera.Keys, key)
+
+		return nil
+	})
+	if err != nil {
+		return repo.CameraKey{}, err
+	}
+
+	return key, nil
+}
+
+// Revoke revokes key of the camera, empty key ID revokes all keys
+func (k *Keyring) Revoke(id, keyID string) error {
+	now := k.clock.Now().UTC()
+
+	_, err := k.repo.UpdateCamera(id, func(camera *repo.Camera) error {
+		var found bool
+
+		for i, key := range camera.Keys {
+			if keyID != "" && key.ID != keyID {
+				continue
+			}
+
+			found = true
+
+			if key.Revoked.IsZero() {
+				camera.Keys[i].Revoked = now
+			}
+		}
+
+		// missing camera has no keys
+		if !found {
+			return repo.ErrNotFound
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// Verify checks that body sent at timestamp is signed by active key of the camera and was not sent before
+func (k *Keyring) Verify(id, timestamp, signature string, body []byte) error {
+	if id == "" || timestamp == "" || signature == "" {
+		return errors.Wrap(ErrUnauthenticated, "request is not signed")
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(ErrUnauthenticated, "unable parse timestamp")
+	}
+
+	var (
+		now  = k.clock.Now()
+		sent = time.Unix(sec, 0)
+	)
+
+	if sent.Before(now.Add(-k.window)) || sent.After(now.Add(k.window)) {
+		return errors.Wrap(ErrUnauthenticated, "timestamp is outside of allowed window", j.KV("window", k.window))
+	}
+
+	camera, err := k.repo.GetCamera(id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return errors.Wrap(ErrUnauthenticated, "invalid signature")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var valid bool
+
+	for _, key := range camera.Keys {
+		if key.Active(now) && hmac.Equal([]byte(Sign(key.Secret, timestamp, body)), []byte(signature)) {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return errors.Wrap(ErrUnauthenticated, "invalid signature")
+	}
+
+	return k.remember(id+"|"+signature, sent, now)
+}
+
+// remember rejects signature seen before, signatures older than window are forgotten
+// because their timestamps are rejected anyway
+func (k *Keyring) remember(signature string, sent, now time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for s, t := range k.seen {
+		if t.Before(now.Add(-k.window)) {
+			delete(k.seen, s)
+		}
+	}
+
+	if _, ok := k.seen[signature]; ok {
+		return errors.Wrap(ErrUnauthenticated, "request is replayed")
+	}
+
+	k.seen[signature] = sent
+
+	return nil
+}
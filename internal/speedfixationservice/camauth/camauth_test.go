@@ -0,0 +1,73 @@
+package camauth
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func TestKeyring(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "camauth")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	var (
+		now = time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+		clk = clock.NewFake(now)
+		k   = NewKeyring(repo.NewTestCameraRepository(tempDir), time.Minute, clk)
+		wg  sync.WaitGroup
+	)
+
+	// concurrent rotations do not lose keys of each other
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := k.Rotate("C12", time.Hour)
+			require.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	cameras, err := k.Cameras()
+	require.NoError(t, err)
+	require.Len(t, cameras, 1)
+	require.Len(t, cameras[0].Keys, 10)
+
+	key, err := k.Rotate("C12", 0)
+	require.NoError(t, err)
+	require.Equal(t, now, key.Created)
+
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"speed":100}`)
+
+	require.NoError(t, k.Verify("C12", ts, Sign(key.Secret, ts, body), body))
+
+	// timestamp is checked by the keyring clock
+	clk.Advance(2 * time.Minute)
+
+	err = k.Verify("C12", ts, Sign(key.Secret, ts, []byte(`{"speed":90}`)), []byte(`{"speed":90}`))
+	require.True(t, errors.Is(err, ErrUnauthenticated))
+
+	require.NoError(t, k.Revoke("C12", key.ID))
+
+	ts = strconv.FormatInt(clk.Now().Unix(), 10)
+
+	err = k.Verify("C12", ts, Sign(key.Secret, ts, body), body)
+	require.True(t, errors.Is(err, ErrUnauthenticated))
+}
@@ -0,0 +1,163 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// cameraKey is the context key of authenticated camera
+type cameraKey struct{}
+
+// authenticatedCamera returns camera which signed the request, it is empty for unsigned requests
+func authenticatedCamera(ctx context.Context) string {
+	camera, _ := ctx.Value(cameraKey{}).(string)
+	return camera
+}
+
+// certificateCamera returns registered camera named by subject of verified client certificate
+func (srv *service) certificateCamera(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return "", errors.Wrap(camauth.ErrUnauthenticated, "client certificate is required")
+	}
+
+	camera := state.VerifiedChains[0][0].Subject.CommonName
+
+	_, err := srv.cameraRepo.GetCamera(camera)
+	if errors.Is(err, repo.ErrNotFound) {
+		return "", errors.Wrap(camauth.ErrUnauthenticated, "certificate subject is not a registered camera", j.KV("camera", camera))
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return camera, nil
+}
+
+// cameraAuthMiddleware verifies signature of registration, the signature is made over timestamp and body
+// or over query string when the body is empty. Unsigned requests are accepted only when
+// authentication is not required. In mutual TLS mode camera is authenticated by its client certificate.
+func (srv *service) cameraAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.clientCerts {
+			camera, err := srv.certificateCamera(r.TLS)
+			if err != nil {
+				responseError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cameraKey{}, camera)))
+
+			return
+		}
+
+		if !srv.cameraAuth {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		camera := r.Header.Get(camauth.CameraHeader)
+		if camera == "" && !srv.cameraAuthRequired {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responseError(w, fieldError("body", "unable read request body"))
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		signed := body
+		if len(signed) == 0 {
+			signed = []byte(r.URL.RawQuery)
+		}
+
+		err = srv.cameras.Verify(camera, r.Header.Get(camauth.TimestampHeader), r.Header.Get(camauth.SignatureHeader), signed)
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cameraKey{}, camera)))
+	})
+}
+
+// checkCamera returns camera of the registration, it must be the camera which signed the request
+func checkCamera(ctx context.Context, camera string) (string, error) {
+	authenticated := authenticatedCamera(ctx)
+
+	switch {
+	case authenticated == "":
+		return camera, nil
+	case camera == "":
+		return authenticated, nil
+	case camera != authenticated:
+		return "", fieldError("camera", "camera does not match the signing camera")
+	}
+
+	return camera, nil
+}
+
+func (srv service) cameraList(w http.ResponseWriter, _ *http.Request) {
+	resp, err := srv.cameras.Cameras()
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+func (srv service) cameraKeyIssue(w http.ResponseWriter, r *http.Request) {
+	key, err := srv.cameras.Issue(r.FormValue("camera"))
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeStatusResponse(w, key, http.StatusCreated)
+}
+
+func (srv service) cameraKeyRotate(w http.ResponseWriter, r *http.Request) {
+	var grace time.Duration
+
+	if value := r.FormValue("grace"); value != "" {
+		var err error
+
+		if grace, err = time.ParseDuration(value); err != nil || grace < 0 {
+			responseError(w, fieldError("grace", "unable parse duration"))
+			return
+		}
+	}
+
+	key, err := srv.cameras.Rotate(r.FormValue("camera"), grace)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeStatusResponse(w, key, http.StatusCreated)
+}
+
+func (srv service) cameraKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := srv.cameras.Revoke(r.FormValue("camera"), r.FormValue("key")); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/peer"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	pb "github.com/IgorRybak2055/speed-control-service/pkg/speedcontrolpb"
+)
+
+// deadLetterMiddleware stores payloads of registrations rejected with client error, items rejected
+// inside of accepted batch are stored one by one as single registrations. Dead letters are kept
+// by authenticated camera, camera named in the payload is not trusted.
+func (srv *service) deadLetterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responseError(w, fieldError("body", "unable read request body"))
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+
+		// payload sent in query string is kept too
+		if len(payload) == 0 && r.URL.RawQuery != "" {
+			payload = []byte(r.URL.RawQuery)
+		}
+
+		rc := &responseCapture{ResponseWriter: w}
+		next.ServeHTTP(rc, r)
+
+		if rc.status == http.StatusOK && routePath(r.URL.Path) == "/register/batch" {
+			srv.deadLetterItems(r, payload, rc.body.Bytes())
+			return
+		}
+
+		if rc.status < http.StatusBadRequest || rc.status >= http.StatusInternalServerError ||
+			rc.status == http.StatusConflict || rc.status == statusClientClosedRequest {
+			return
+		}
+
+		reason := rc.body.Bytes()
+		if !json.Valid(reason) {
+			reason, _ = json.Marshal(rc.body.String())
+		}
+
+		_, err = srv.deadLetters.Add(repo.DeadLetter{
+			Received:    srv.now(),
+			RemoteAddr:  r.RemoteAddr,
+			Camera:      authenticatedCamera(r.Context()),
+			Path:        r.URL.Path,
+			ContentType: r.Header.Get("Content-Type"),
+			Payload:     string(payload),
+			Status:      rc.status,
+			Reason:      reason,
+		})
+		if err != nil {
+			log.Println("unable store dead letter:", err)
+		}
+	})
+}
+
+// deadLetterItems stores items of batch which are rejected in batch response
+func (srv *service) deadLetterItems(r *http.Request, payload, response []byte) {
+	var results []batchResult
+
+	if err := json.Unmarshal(response, &results); err != nil {
+		log.Println("unable read batch results:", err)
+		return
+	}
+
+	items, err := batchItems(r, bytes.NewReader(payload), 0)
+	if err != nil {
+		log.Println("unable split batch into items:", err)
+		return
+	}
+
+	for _, result := range results {
+		if result.Status != "rejected" || result.Index < 0 || result.Index >= len(items) {
+			continue
+		}
+
+		reason, err := json.Marshal(result)
+		if err != nil {
+			log.Println("unable store dead letter:", err)
+			continue
+		}
+
+		// the item is replayed as single registration
+		_, err = srv.deadLetters.Add(repo.DeadLetter{
+			Received:    srv.now(),
+			RemoteAddr:  r.RemoteAddr,
+			Camera:      authenticatedCamera(r.Context()),
+			Path:        strings.TrimSuffix(r.URL.Path, "/batch"),
+			ContentType: "application/json",
+			Payload:     string(items[result.Index]),
+			Status:      http.StatusBadRequest,
+			Reason:      reason,
+		})
+		if err != nil {
+			log.Println("unable store dead letter:", err)
+		}
+	}
+}
+
+// deadLetterCall stores registration rejected in gRPC call as dead letter of HTTP registration,
+// so it is listed and replayed like registrations sent by HTTP
+func (srv *service) deadLetterCall(ctx context.Context, req *pb.RegisterRequest, reason string) {
+	if srv.deadLetters == nil {
+		return
+	}
+
+	f := req.GetFixation()
+	reg := registration{
+		VehicleNumber: f.GetVehicleNumber(),
+		Speed:         json.Number(strconv.FormatFloat(f.GetSpeed(), 'f', -1, 64)),
+		Camera:        f.GetCamera(),
+		Signature:     req.GetSignature(),
+	}
+
+	if date, err := ptypes.Timestamp(f.GetDate()); err == nil {
+		reg.Date = date.UTC().Format(time.RFC3339Nano)
+	}
+
+	payload, err := json.Marshal(reg)
+	if err != nil {
+		log.Println("unable store dead letter:", err)
+		return
+	}
+
+	msg, err := json.Marshal(reason)
+	if err != nil {
+		log.Println("unable store dead letter:", err)
+		return
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+
+	_, err = srv.deadLetters.Add(repo.DeadLetter{
+		Received:    srv.now(),
+		RemoteAddr:  addr,
+		Camera:      authenticatedCamera(ctx),
+		Path:        apiPrefix + "/register",
+		ContentType: "application/json",
+		Payload:     string(payload),
+		Status:      http.StatusBadRequest,
+		Reason:      msg,
+	})
+	if err != nil {
+		log.Println("unable store dead letter:", err)
+	}
+}
+
+func (srv service) deadLetterList(w http.ResponseWriter, r *http.Request) {
+	var (
+		conditions = repo.DeadLetterConditions{Camera: r.FormValue("camera")}
+		err        error
+	)
+
+	if from := r.FormValue("from"); from != "" {
+		if conditions.From, err = time.Parse(time.RFC3339, from); err != nil {
+			responseError(w, fieldError("from", "unable parse from date"))
+			return
+		}
+	}
+
+	if to := r.FormValue("to"); to != "" {
+		if conditions.To, err = time.Parse(time.RFC3339, to); err != nil {
+			responseError(w, fieldError("to", "unable parse to date"))
+			return
+		}
+	}
+
+	resp, err := srv.deadLetters.LookUp(conditions)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+// replayResult is the response of registration handler to the replayed dead letter
+type replayResult struct {
+	ID       string          `json:"id"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// replayRecorder keeps the response of replayed request in memory
+type replayRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *replayRecorder) Header() http.Header { return rr.header }
+
+func (rr *replayRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+
+	return rr.body.Write(b)
+}
+
+func (rr *replayRecorder) WriteHeader(status int) { rr.status = status }
+
+// deadLetterReplay sends stored payload to the registration handler again,
+// dead letter is deleted when registration succeeds
+func (srv service) deadLetterReplay(w http.ResponseWriter, r *http.Request) {
+	letter, err := srv.deadLetters.Get(r.FormValue("id"))
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	// the registration is replayed as made by the camera which sent it, so timeouts of the replay apply to it
+	// and camera named in the payload is checked again
+	ctx := r.Context()
+	if letter.Camera != "" {
+		ctx = context.WithValue(ctx, cameraKey{}, letter.Camera)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, letter.Path, bytes.NewReader([]byte(letter.Payload)))
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	req.RemoteAddr = letter.RemoteAddr
+
+	if letter.ContentType != "" {
+		req.Header.Set("Content-Type", letter.ContentType)
+	} else {
+		req.URL.RawQuery = letter.Payload
+	}
+
+	rec := &replayRecorder{header: make(http.Header)}
+
+	switch routePath(letter.Path) {
+	case "/register/batch":
+		srv.registerBatch(rec, req)
+	default:
+		srv.registerSpeed(rec, req)
+	}
+
+	if rec.status < http.StatusBadRequest {
+		if err := srv.deadLetters.Delete(letter.ID); err != nil {
+			responseError(w, err)
+			return
+		}
+	}
+
+	makeResponse(w, replayResult{ID: letter.ID, Status: rec.status, Response: rec.body.Bytes()})
+}
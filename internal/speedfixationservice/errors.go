@@ -0,0 +1,233 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/evidence"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/usecase"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/webhook"
+)
+
+// Error codes of error responses, codes are stable and clients should rely on them rather than on messages:
+//
+//	invalid_request       400 request parameters or body are invalid, details describe every invalid field
+//	invalid_filter        400 filter expression can not be parsed
+//	unknown_plate_format  400 vehicle number does not match any configured plate format
+//	invalid_evidence      400 evidence signature of fixation is missing or is not made by public key of the camera
+//	invalid_public_key    400 camera public key is not base64 Ed25519 key
+//	rejected              400 fixation broke validation rules
+//	unauthenticated       401 registration is not signed by active key of the camera or is replayed,
+//	                          or bearer token of query user is missing or invalid
+//	forbidden             403 token does not grant role required by the endpoint
+//	not_found             404 requested record does not exist
+//	no_data               404 there are no fixations of the requested day
+//	method_not_allowed    405 path does not support request method, Allow header lists supported ones
+//	out_of_service_hours  406 query endpoints do not work at the moment
+//	duplicate             409 the same fixation is already registered
+//	key_in_progress       409 request with the same idempotency key is being processed
+//	static_subscription   409 webhook subscription is configured by file and can not be changed by API
+//	body_too_large        413 request body is larger than the configured limit
+//	key_reused            422 idempotency key is already used by the camera for other request
+//	rate_limited          429 client spent its request budget, Retry-After header tells when to retry
+//	internal              500 the service failed, the request can be retried
+//	shutting_down         503 the service is stopping, the request can be retried after restart
+//	timeout               504 the request took longer than timeout of the endpoint
+//	canceled              499 client closed connection before the response, nobody reads it
+const (
+	codeInvalidRequest     = "invalid_request"
+	codeInvalidFilter      = "invalid_filter"
+	codeUnknownPlateFormat = "unknown_plate_format"
+	codeInvalidEvidence    = "invalid_evidence"
+	codeInvalidPublicKey   = "invalid_public_key"
+	codeRejected           = "rejected"
+	codeUnauthenticated    = "unauthenticated"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeNoData             = "no_data"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeOutOfServiceHours  = "out_of_service_hours"
+	codeDuplicate          = "duplicate"
+	codeKeyInProgress      = "key_in_progress"
+	codeStaticSubscription = "static_subscription"
+	codeDeliveryNotDead    = "delivery_not_dead"
+	codeBodyTooLarge       = "body_too_large"
+	codeKeyReused          = "key_reused"
+	codeRateLimited        = "rate_limited"
+	codeInternal           = "internal"
+	codeShuttingDown       = "shutting_down"
+	codeTimeout            = "timeout"
+	codeCanceled           = "canceled"
+)
+
+// statusClientClosedRequest is the status of requests canceled by client, it is only logged
+const statusClientClosedRequest = 499
+
+// requestIDHeader is the header with ID of the request, it is generated when client does not send it
+const requestIDHeader = "X-Request-ID"
+
+var (
+	errPageNotFound      = errors.New("page not found", errors.WithCode(codeNotFound))
+	errForbidden         = errors.New("access denied", errors.WithCode(codeForbidden))
+	errMethodNotAllowed  = errors.New("method not allowed", errors.WithCode(codeMethodNotAllowed))
+	errOutOfServiceHours = errors.New("service does not work at the moment", errors.WithCode(codeOutOfServiceHours))
+	errBodyTooLarge      = errors.New("request body is too large", errors.WithCode(codeBodyTooLarge))
+	errRateLimited       = errors.New("too many requests", errors.WithCode(codeRateLimited))
+	errKeyReused         = errors.New("idempotency key is already used for other request", errors.WithCode(codeKeyReused))
+)
+
+// APIError is the body of error response
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+	// OpensAt is the next opening of route closed by service hours
+	OpensAt   *time.Time `json:"opens_at,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+}
+
+// errorResponse is the envelope of error response
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// knownErrors maps errors to response status and code, errors not listed here are internal
+var knownErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{err: camauth.ErrUnauthenticated, status: http.StatusUnauthorized, code: codeUnauthenticated},
+	{err: jwt.ErrInvalidToken, status: http.StatusUnauthorized, code: codeUnauthenticated},
+	{err: errForbidden, status: http.StatusForbidden, code: codeForbidden},
+	{err: repo.ErrNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: os.ErrNotExist, status: http.StatusNotFound, code: codeNoData},
+	{err: repo.ErrDuplicate, status: http.StatusConflict, code: codeDuplicate},
+	{err: repo.ErrKeyInProgress, status: http.StatusConflict, code: codeKeyInProgress},
+	{err: webhook.ErrStaticSubscription, status: http.StatusConflict, code: codeStaticSubscription},
+	{err: webhook.ErrNotDead, status: http.StatusConflict, code: codeDeliveryNotDead},
+	{err: evidence.ErrInvalid, status: http.StatusBadRequest, code: codeInvalidEvidence},
+	{err: evidence.ErrInvalidKey, status: http.StatusBadRequest, code: codeInvalidPublicKey},
+	{err: usecase.ErrRejected, status: http.StatusBadRequest, code: codeRejected},
+	{err: plate.ErrUnknownFormat, status: http.StatusBadRequest, code: codeUnknownPlateFormat},
+	{err: errMethodNotAllowed, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+	{err: errOutOfServiceHours, status: http.StatusNotAcceptable, code: codeOutOfServiceHours},
+	{err: errBodyTooLarge, status: http.StatusRequestEntityTooLarge, code: codeBodyTooLarge},
+	{err: errKeyReused, status: http.StatusUnprocessableEntity, code: codeKeyReused},
+	{err: errRateLimited, status: http.StatusTooManyRequests, code: codeRateLimited},
+	{err: repo.ErrClosed, status: http.StatusServiceUnavailable, code: codeShuttingDown},
+	{err: context.DeadlineExceeded, status: http.StatusGatewayTimeout, code: codeTimeout},
+	{err: context.Canceled, status: statusClientClosedRequest, code: codeCanceled},
+}
+
+// fieldError returns validation error of one field
+func fieldError(field, message string) error {
+	return &ValidationError{Errors: []FieldError{{Field: field, Message: message}}}
+}
+
+// apiError converts error to response body and status
+func apiError(err error) (APIError, int) {
+	var (
+		verr   *ValidationError
+		synErr *filter.SyntaxError
+		closed *closedError
+	)
+
+	switch {
+	case errors.As(err, &verr):
+		return APIError{Code: codeInvalidRequest, Message: err.Error(), Details: verr.Errors}, http.StatusBadRequest
+	case errors.As(err, &synErr):
+		return APIError{
+			Code:    codeInvalidFilter,
+			Message: err.Error(),
+			Details: []FieldError{{Field: "filter", Message: synErr.Error()}},
+		}, http.StatusBadRequest
+	case errors.As(err, &closed) && !closed.opens.IsZero():
+		return APIError{Code: codeOutOfServiceHours, Message: err.Error(), OpensAt: &closed.opens}, http.StatusNotAcceptable
+	}
+
+	for _, known := range knownErrors {
+		if !errors.Is(err, known.err) {
+			continue
+		}
+
+		// storage paths are not shown to clients
+		if known.code == codeNoData {
+			return APIError{Code: known.code, Message: "no data for the day"}, known.status
+		}
+
+		return APIError{Code: known.code, Message: err.Error()}, known.status
+	}
+
+	return APIError{Code: codeInternal, Message: "internal error"}, http.StatusInternalServerError
+}
+
+func responseError(w http.ResponseWriter, err error) {
+	body, status := apiError(err)
+	body.RequestID = w.Header().Get(requestIDHeader)
+
+	if status >= http.StatusInternalServerError {
+		log.Printf("request %v failed: %v", body.RequestID, err)
+	}
+
+	resp, err := json.Marshal(errorResponse{Error: body})
+	if err != nil {
+		http.Error(w, "cannot serialize srv", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(resp)
+
+	if err != nil {
+		log.Println("unable write response:", err)
+	}
+}
+
+// validRequestID reports whether ID sent by client can be used in responses and logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestIDMiddleware sets ID of the request to the response header, so it is reported in error responses
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			b := make([]byte, 8)
+			if _, err := rand.Read(b); err != nil {
+				log.Println("unable generate request id:", err)
+			}
+
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/evidence"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// seal verifies evidence signature of registered fixation and attaches it to the fixation
+func (srv service) seal(fixation repo.SpeedFixation, signature string) (repo.SpeedFixation, error) {
+	if srv.evidence == nil {
+		return fixation, nil
+	}
+
+	var err error
+
+	fixation.Evidence, err = srv.evidence.Seal(fixation, signature)
+
+	return fixation, err
+}
+
+// publicKeyRequest is the public key registered by API
+type publicKeyRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+func (srv service) cameraPublicKeyAdd(w http.ResponseWriter, r *http.Request) {
+	var req publicKeyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responseError(w, fieldError("body", "unable parse json"))
+		return
+	}
+
+	key, err := srv.evidence.AddKey(r.FormValue("camera"), req.PublicKey)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeStatusResponse(w, key, http.StatusCreated)
+}
+
+func (srv service) cameraPublicKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := srv.evidence.RevokeKey(r.FormValue("camera"), r.FormValue("key")); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// evidenceVerify verifies signatures of stored fixations taken at the moment by camera
+func (srv service) evidenceVerify(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse(time.RFC3339Nano, r.FormValue("date"))
+	if err != nil {
+		responseError(w, fieldError("date", "unable parse datetime"))
+		return
+	}
+
+	fixations, err := srv.uc.LookUpFixationsByVehicleNumber(r.Context(), r.FormValue("vehicle_number"))
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	var (
+		camera = r.FormValue("camera")
+		resp   []evidence.Result
+	)
+
+	for _, fixation := range fixations {
+		if !fixation.Date.Equal(date) || fixation.Camera != camera {
+			continue
+		}
+
+		result, err := srv.evidence.Verify(fixation)
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+
+		resp = append(resp, result)
+	}
+
+	if len(resp) == 0 {
+		responseError(w, repo.ErrNotFound)
+		return
+	}
+
+	makeResponse(w, resp)
+}
@@ -0,0 +1,230 @@
+// Package evidence provides signing of fixations by cameras which took them
+package evidence
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// Errors of evidence verification
+var (
+	ErrInvalid    = errors.New("invalid evidence signature", errors.WithCode("invalid_evidence"))
+	ErrInvalidKey = errors.New("invalid public key", errors.WithCode("invalid_public_key"))
+)
+
+// canonical is the signed content of fixation, fields are ordered by name
+type canonical struct {
+	Camera        string  `json:"camera"`
+	Date          string  `json:"date"`
+	Speed         float64 `json:"speed"`
+	VehicleNumber string  `json:"vehicle_number"`
+}
+
+// Canonical returns signed encoding of fixation: JSON object without spaces with fields camera, date,
+// speed and vehicle_number in this order. Date is RFC 3339 in UTC with fractional seconds only when
+// they are not zero, vehicle number is the one sent by camera before normalization.
+func Canonical(fixation repo.SpeedFixation) []byte {
+	number := fixation.RawVehicleNumber
+	if number == "" {
+		number = fixation.VehicleNumber
+	}
+
+	// encoding of struct of strings and number can not fail
+	data, _ := json.Marshal(canonical{
+		Camera:        fixation.Camera,
+		Date:          fixation.Date.UTC().Format(time.RFC3339Nano),
+		Speed:         fixation.Speed,
+		VehicleNumber: number,
+	})
+
+	return data
+}
+
+// Sign returns base64 signature of fixation, it is made by camera and used in tests
+func Sign(key ed25519.PrivateKey, fixation repo.SpeedFixation) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Canonical(fixation)))
+}
+
+// KeyID returns ID of public key, it is the beginning of key hash
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Result is the result of verification of stored fixation
+type Result struct {
+	Fixation repo.SpeedFixation `json:"fixation"`
+	Valid    bool               `json:"valid"`
+	Reason   string             `json:"reason,omitempty"`
+}
+
+// Verifier verifies fixations by public keys of cameras
+type Verifier struct {
+	repo  repo.CameraRepo
+	clock clock.Clock
+}
+
+// NewVerifier creates verifier of cameras stored in repository
+func NewVerifier(cr repo.CameraRepo, clk clock.Clock) *Verifier {
+	return &Verifier{repo: cr, clock: clk}
+}
+
+// AddKey registers base64 Ed25519 public key of the camera
+func (v *Verifier) AddKey(id, key string) (repo.CameraPublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return repo.CameraPublicKey{}, errors.Wrap(ErrInvalidKey, "base64 Ed25519 public key expected")
+	}
+
+	var (
+		now = v.clock.Now().UTC()
+		pub = repo.CameraPublicKey{ID: KeyID(raw), Key: key, Created: now}
+	)
+
+	_, err = v.repo.UpdateCamera(id, func(camera *repo.Camera) error {
+		if camera.Created.IsZero() {
+			camera.Created = now
+		}
+
+		for _, known := range camera.PublicKeys {
+			if known.ID == pub.ID {
+				return errors.Wrap(repo.ErrDuplicate, "public key is already registered")
+			}
+		}
+
+		camera.PublicKeys = append(camera.PublicKeys, pub)
+
+		return nil
+	})
+	if err != nil {
+		return repo.CameraPublicKey{}, err
+	}
+
+	return pub, nil
+}
+
+// RevokeKey revokes public key of the camera, fixations signed by it are not accepted any more,
+// stored ones signed before revocation stay valid
+func (v *Verifier) RevokeKey(id, keyID string) error {
+	now := v.clock.Now().UTC()
+
+	_, err := v.repo.UpdateCamera(id, func(camera *repo.Camera) error {
+		for i, pub := range camera.PublicKeys {
+			if pub.ID != keyID {
+				continue
+			}
+
+			if pub.Revoked.IsZero() {
+				camera.PublicKeys[i].Revoked = now
+			}
+
+			return nil
+		}
+
+		// missing camera has no keys
+		return repo.ErrNotFound
+	})
+
+	return err
+}
+
+// Seal verifies signature of registered fixation and returns evidence stored with it.
+// Fixations of cameras with public keys must be signed, other fixations may be not signed.
+func (v *Verifier) Seal(fixation repo.SpeedFixation, signature string) (*repo.Evidence, error) {
+	var keys []repo.CameraPublicKey
+
+	camera, err := v.repo.GetCamera(fixation.Camera)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, err
+	}
+
+	for _, pub := range camera.PublicKeys {
+		if pub.Revoked.IsZero() {
+			keys = append(keys, pub)
+		}
+	}
+
+	switch {
+	case signature == "" && len(keys) == 0:
+		return nil, nil
+	case signature == "":
+		return nil, errors.Wrap(ErrInvalid, "fixation of the camera must be signed", j.KV("camera", fixation.Camera))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalid, "unable decode signature")
+	}
+
+	data := Canonical(fixation)
+
+	for _, pub := range keys {
+		if verify(pub, data, sig) {
+			return &repo.Evidence{Signature: signature, KeyID: pub.ID}, nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrInvalid, "signature is not made by public key of the camera", j.KV("camera", fixation.Camera))
+}
+
+func verify(pub repo.CameraPublicKey, data, sig []byte) bool {
+	key, err := base64.StdEncoding.DecodeString(pub.Key)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(key, data, sig)
+}
+
+// Verify checks signature of stored fixation by the key which verified it on registration
+func (v *Verifier) Verify(fixation repo.SpeedFixation) (Result, error) {
+	ret := Result{Fixation: fixation}
+
+	if fixation.Evidence == nil {
+		ret.Reason = "fixation is not signed"
+		return ret, nil
+	}
+
+	camera, err := v.repo.GetCamera(fixation.Camera)
+	if errors.Is(err, repo.ErrNotFound) {
+		ret.Reason = "camera is not registered"
+		return ret, nil
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(fixation.Evidence.Signature)
+	if err != nil {
+		ret.Reason = "unable decode signature"
+		return ret, nil
+	}
+
+	for _, pub := range camera.PublicKeys {
+		if pub.ID != fixation.Evidence.KeyID {
+			continue
+		}
+
+		ret.Valid = verify(pub, Canonical(fixation), sig)
+		if !ret.Valid {
+			ret.Reason = "signature does not match fixation"
+		}
+
+		return ret, nil
+	}
+
+	ret.Reason = "public key is not registered"
+
+	return ret, nil
+}
@@ -0,0 +1,101 @@
+package evidence
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func TestCanonical(t *testing.T) {
+	fixation := repo.SpeedFixation{
+		Date:             time.Date(2019, 12, 27, 18, 3, 27, 125000000, time.FixedZone("MSK", 3*60*60)),
+		VehicleNumber:    "6048EC3",
+		RawVehicleNumber: "6048 EC-3",
+		Camera:           "C12",
+		Speed:            100.5,
+		Flags:            []string{"clock_skew"},
+	}
+
+	require.Equal(t, `{"camera":"C12","date":"2019-12-27T15:03:27.125Z","speed":100.5,"vehicle_number":"6048 EC-3"}`,
+		string(Canonical(fixation)))
+}
+
+func TestVerifier(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "evidence")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	var (
+		now = time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+		cr  = repo.NewTestCameraRepository(tempDir)
+		v   = NewVerifier(cr, clock.NewFake(now))
+	)
+
+	_, err = v.AddKey("C12", "short")
+	require.True(t, errors.Is(err, ErrInvalidKey))
+
+	key, err := v.AddKey("C12", base64.StdEncoding.EncodeToString(pub))
+	require.NoError(t, err)
+	require.Equal(t, KeyID(pub), key.ID)
+	require.Equal(t, now, key.Created)
+
+	fixation := repo.SpeedFixation{
+		Date:          time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC),
+		VehicleNumber: "6048 EC-3",
+		Camera:        "C12",
+		Speed:         100,
+	}
+
+	_, err = v.Seal(fixation, "")
+	require.True(t, errors.Is(err, ErrInvalid))
+
+	tampered := fixation
+	tampered.Speed = 60
+	_, err = v.Seal(tampered, Sign(priv, fixation))
+	require.True(t, errors.Is(err, ErrInvalid))
+
+	fixation.Evidence, err = v.Seal(fixation, Sign(priv, fixation))
+	require.NoError(t, err)
+	require.Equal(t, key.ID, fixation.Evidence.KeyID)
+
+	// fixations of cameras without public keys are not signed
+	other := fixation
+	other.Camera = "C13"
+	evidence, err := v.Seal(other, "")
+	require.NoError(t, err)
+	require.Nil(t, evidence)
+
+	// stored fixation has normalized vehicle number and keeps the raw one
+	fixation.RawVehicleNumber, fixation.VehicleNumber = fixation.VehicleNumber, "6048EC3"
+
+	require.NoError(t, v.RevokeKey("C12", key.ID))
+
+	camera, err := cr.GetCamera("C12")
+	require.NoError(t, err)
+	require.Equal(t, now, camera.PublicKeys[0].Revoked)
+
+	result, err := v.Verify(fixation)
+	require.NoError(t, err)
+	require.True(t, result.Valid, result.Reason)
+
+	fixation.Speed = 60
+	result, err = v.Verify(fixation)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+}
@@ -0,0 +1,166 @@
+// Package feed provides live feed of stored fixations for subscribers
+package feed
+
+import (
+	"sync"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/platesearch"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// subscriberQueue is the number of events queued for subscriber, slower subscribers are dropped
+const subscriberQueue = 64
+
+// Event is the stored fixation published to subscribers
+type Event struct {
+	ID       uint64             `json:"id"`
+	Fixation repo.SpeedFixation `json:"fixation"`
+}
+
+// Filter selects events of subscription, zero values match everything
+type Filter struct {
+	Camera   string
+	MinSpeed float64
+	// Plate is the vehicle number or wildcard pattern
+	Plate string
+}
+
+// Match reports whether fixation is selected by filter
+func (f Filter) Match(fixation repo.SpeedFixation) bool {
+	switch {
+	case f.Camera != "" && fixation.Camera != f.Camera:
+		return false
+	case fixation.Speed < f.MinSpeed:
+		return false
+	case f.Plate == "":
+		return true
+	case platesearch.IsWildcard(f.Plate):
+		return platesearch.MatchWildcard(f.Plate, fixation.VehicleNumber, nil)
+	default:
+		return plate.Normalize(f.Plate) == plate.Normalize(fixation.VehicleNumber)
+	}
+}
+
+// Hub keeps recent events and publishes new ones to subscribers
+type Hub struct {
+	mu     sync.Mutex
+	last   uint64
+	size   int
+	recent []Event
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub creates hub which keeps size recent events for resumption,
+// event IDs start from the creation time of clock, so they grow across restarts too
+func NewHub(size int, clk clock.Clock) *Hub {
+	return &Hub{
+		last: uint64(clk.Now().UnixNano()),
+		size: size,
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Notify publishes fixation to subscribers, it implements usecase.Notifier
+func (h *Hub) Notify(fixation repo.SpeedFixation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.last++
+	event := Event{ID: h.last, Fixation: fixation}
+
+	h.recent = append(h.recent, event)
+	if len(h.recent) > h.size {
+		h.recent = h.recent[len(h.recent)-h.size:]
+	}
+
+	for sub := range h.subs {
+		if !sub.filter.Match(fixation) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber resumes from its last event after reconnect
+			h.drop(sub)
+		}
+	}
+}
+
+// Subscribe creates subscription, recent events after lastID are sent first when lastID is not zero
+func (h *Hub) Subscribe(f Filter, lastID uint64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var missed []Event
+
+	if lastID != 0 {
+		for _, event := range h.recent {
+			if event.ID > lastID && f.Match(event.Fixation) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		hub:    h,
+		filter: f,
+		events: make(chan Event, len(missed)+subscriberQueue),
+	}
+
+	for _, event := range missed {
+		sub.events <- event
+	}
+
+	// subscriber of closed hub gets only events it missed
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+
+	h.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Close ends all subscriptions and the ones created later, so streams finish on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Subscription receives events selected by its filter
+type Subscription struct {
+	hub    *Hub
+	filter Filter
+	events chan Event
+}
+
+// Events returns channel of events, it is closed when subscription is closed or dropped as too slow
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.drop(s)
+}
@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func TestFilter_Match(t *testing.T) {
+	fixation := repo.SpeedFixation{VehicleNumber: "6048EC3", Camera: "C12", Speed: 95}
+
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{filter: Filter{}, want: true},
+		{filter: Filter{Camera: "C12", MinSpeed: 90}, want: true},
+		{filter: Filter{Camera: "C14"}, want: false},
+		{filter: Filter{MinSpeed: 100}, want: false},
+		{filter: Filter{Plate: "6048 ec-3"}, want: true},
+		{filter: Filter{Plate: "6048*"}, want: true},
+		{filter: Filter{Plate: "0003 AE-3"}, want: false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tt.filter.Match(fixation), tt.filter)
+	}
+}
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		require.True(t, ok)
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "event not received")
+	}
+
+	return Event{}
+}
+
+func TestHub(t *testing.T) {
+	created := time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+	hub := NewHub(2, clock.NewFake(created))
+
+	fast := hub.Subscribe(Filter{MinSpeed: 90}, 0)
+	defer fast.Close()
+
+	hub.Notify(repo.SpeedFixation{VehicleNumber: "6048EC3", Speed: 95})
+	hub.Notify(repo.SpeedFixation{VehicleNumber: "0003AE3", Speed: 60})
+	hub.Notify(repo.SpeedFixation{VehicleNumber: "8911EE3", Speed: 120})
+
+	// event IDs start from the creation time of hub
+	first := receive(t, fast)
+	require.Equal(t, "6048EC3", first.Fixation.VehicleNumber)
+	require.Equal(t, uint64(created.UnixNano())+1, first.ID)
+	require.Equal(t, "8911EE3", receive(t, fast).Fixation.VehicleNumber)
+
+	// only the two recent events are kept for resumption
+	resumed := hub.Subscribe(Filter{}, first.ID)
+	require.Equal(t, "0003AE3", receive(t, resumed).Fixation.VehicleNumber)
+	require.Equal(t, "8911EE3", receive(t, resumed).Fixation.VehicleNumber)
+	resumed.Close()
+
+	_, ok := <-resumed.Events()
+	require.False(t, ok)
+
+	slow := hub.Subscribe(Filter{}, 0)
+	for i := 0; i <= subscriberQueue; i++ {
+		hub.Notify(repo.SpeedFixation{VehicleNumber: "6048EC3", Speed: 95})
+	}
+
+	for range slow.Events() {
+	}
+
+	// closing dropped subscription does nothing
+	slow.Close()
+
+	// closed hub ends subscriptions, the new ones get only missed events
+	open := hub.Subscribe(Filter{}, 0)
+	hub.Close()
+
+	_, ok = <-open.Events()
+	require.False(t, ok)
+
+	late := hub.Subscribe(Filter{}, first.ID)
+	require.Len(t, late.Events(), 2)
+
+	for range late.Events() {
+	}
+
+	late.Close()
+}
@@ -0,0 +1,436 @@
+// Package filter provides small expression language for searching speed fixations
+package filter
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/platesearch"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// Expr is parsed filter expression
+type Expr interface {
+	// Match reports whether fixation satisfies expression
+	Match(repo.SpeedFixation) bool
+}
+
+type field struct {
+	numeric bool
+	// cyclic fields like hour are compared with wrap-around in between, e.g. hour between 22 and 6
+	cyclic bool
+	// number returns value of numeric field, time fields are evaluated in loc
+	number func(sf repo.SpeedFixation, loc *time.Location) float64
+	text   func(repo.SpeedFixation) string
+}
+
+var fields = map[string]field{
+	"speed": {numeric: true, number: func(sf repo.SpeedFixation, _ *time.Location) float64 { return sf.Speed }},
+	"hour": {numeric: true, cyclic: true, number: func(sf repo.SpeedFixation, loc *time.Location) float64 {
+		return float64(sf.Date.In(loc).Hour())
+	}},
+	"plate":   {text: func(sf repo.SpeedFixation) string { return plate.Normalize(sf.VehicleNumber) }},
+	"camera":  {text: func(sf repo.SpeedFixation) string { return sf.Camera }},
+	"country": {text: func(sf repo.SpeedFixation) string { return sf.Country }},
+}
+
+type all struct{}
+
+func (all) Match(repo.SpeedFixation) bool { return true }
+
+type and struct{ left, right Expr }
+
+func (e and) Match(sf repo.SpeedFixation) bool { return e.left.Match(sf) && e.right.Match(sf) }
+
+type or struct{ left, right Expr }
+
+func (e or) Match(sf repo.SpeedFixation) bool { return e.left.Match(sf) || e.right.Match(sf) }
+
+type not struct{ expr Expr }
+
+func (e not) Match(sf repo.SpeedFixation) bool { return !e.expr.Match(sf) }
+
+type comparison struct {
+	name    string
+	field   field
+	op      string
+	numbers []float64
+	texts   []string
+	loc     *time.Location
+}
+
+func (c comparison) Match(sf repo.SpeedFixation) bool {
+	if c.field.numeric {
+		return c.matchNumber(c.field.number(sf, c.loc))
+	}
+
+	return c.matchText(c.field.text(sf))
+}
+
+func (c comparison) matchNumber(v float64) bool {
+	switch c.op {
+	case "=":
+		return v == c.numbers[0]
+	case "!=":
+		return v != c.numbers[0]
+	case "<":
+		return v < c.numbers[0]
+	case "<=":
+		return v <= c.numbers[0]
+	case ">":
+		return v > c.numbers[0]
+	case ">=":
+		return v >= c.numbers[0]
+	case "in":
+		for _, n := range c.numbers {
+			if v == n {
+				return true
+			}
+		}
+
+		return false
+	case "between":
+		lo, hi := c.numbers[0], c.numbers[1]
+		if c.field.cyclic && lo > hi {
+			return v >= lo || v <= hi
+		}
+
+		return v >= lo && v <= hi
+	}
+
+	return false
+}
+
+func (c comparison) matchText(v string) bool {
+	switch c.op {
+	case "=":
+		return v == c.texts[0]
+	case "!=":
+		return v != c.texts[0]
+	case "in":
+		for _, t := range c.texts {
+			if v == t {
+				return true
+			}
+		}
+
+		return false
+	case "like":
+		return platesearch.MatchWildcard(c.texts[0], v, nil)
+	}
+
+	return false
+}
+
+// SpeedBounds returns speed range which every fixation matched by expression belongs to,
+// it is used to push speed predicates down to the repository
+func SpeedBounds(e Expr) (lo, hi float64) {
+	lo, hi = math.Inf(-1), math.Inf(1)
+
+	switch e := e.(type) {
+	case and:
+		llo, lhi := SpeedBounds(e.left)
+		rlo, rhi := SpeedBounds(e.right)
+
+		return math.Max(llo, rlo), math.Min(lhi, rhi)
+	case comparison:
+		if e.name != "speed" {
+			return lo, hi
+		}
+
+		switch e.op {
+		case "=":
+			return e.numbers[0], e.numbers[0]
+		case ">", ">=":
+			return e.numbers[0], hi
+		case "<", "<=":
+			return lo, e.numbers[0]
+		case "between":
+			return e.numbers[0], e.numbers[1]
+		}
+	}
+
+	return lo, hi
+}
+
+// Uses reports whether expression checks the field
+func Uses(e Expr, name string) bool {
+	switch e := e.(type) {
+	case and:
+		return Uses(e.left, name) || Uses(e.right, name)
+	case or:
+		return Uses(e.left, name) || Uses(e.right, name)
+	case not:
+		return Uses(e.expr, name)
+	case comparison:
+		return e.name == name
+	}
+
+	return false
+}
+
+// Values returns texts which the field is compared with, e.g. plates looked up by expression
+func Values(e Expr, name string) []string {
+	switch e := e.(type) {
+	case and:
+		return append(Values(e.left, name), Values(e.right, name)...)
+	case or:
+		return append(Values(e.left, name), Values(e.right, name)...)
+	case not:
+		return Values(e.expr, name)
+	case comparison:
+		if e.name == name {
+			return append([]string(nil), e.texts...)
+		}
+	}
+
+	return nil
+}
+
+// Parse parses filter expression, e.g. `speed > 90 and camera in ("C12","C14") and hour between 22 and 6`,
+// empty expression matches all fixations. Hours are evaluated in UTC.
+func Parse(input string) (Expr, error) {
+	return ParseInLocation(input, time.UTC)
+}
+
+// ParseInLocation is like Parse but evaluates hours of fixations in loc
+func ParseInLocation(input string, loc *time.Location) (Expr, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokens[0].kind == tokenEOF {
+		return all{}, nil
+	}
+
+	p := parser{tokens: tokens, loc: loc}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, newSyntaxError(t, "unexpected token")
+	}
+
+	return e, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	loc    *time.Location
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenIdent && t.value == word {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = or{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = and{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.keyword("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return not{expr: e}, nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.next()
+
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, newSyntaxError(t, "expected )")
+		}
+
+		return e, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, newSyntaxError(t, "expected field name")
+	}
+
+	f, ok := fields[t.value]
+	if !ok {
+		return nil, newSyntaxError(t, "unknown field")
+	}
+
+	c := comparison{name: t.value, field: f, loc: p.loc}
+
+	op := p.next()
+
+	switch {
+	case op.kind == tokenOperator:
+		c.op = op.value
+
+		if !f.numeric && c.op != "=" && c.op != "!=" {
+			return nil, newSyntaxError(op, "operator is not applicable to field %s", c.name)
+		}
+
+		if err := p.value(&c); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	case op.kind == tokenIdent && op.value == "in":
+		c.op = op.value
+
+		if t := p.next(); t.kind != tokenLParen {
+			return nil, newSyntaxError(t, "expected (")
+		}
+
+		for {
+			if err := p.value(&c); err != nil {
+				return nil, err
+			}
+
+			t := p.next()
+			if t.kind == tokenRParen {
+				return c, nil
+			}
+
+			if t.kind != tokenComma {
+				return nil, newSyntaxError(t, "expected , or )")
+			}
+		}
+	case op.kind == tokenIdent && op.value == "between":
+		c.op = op.value
+
+		if !f.numeric {
+			return nil, newSyntaxError(op, "operator is not applicable to field %s", c.name)
+		}
+
+		if err := p.value(&c); err != nil {
+			return nil, err
+		}
+
+		if t := p.peek(); !p.keyword("and") {
+			return nil, newSyntaxError(t, "expected and")
+		}
+
+		if err := p.value(&c); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	case op.kind == tokenIdent && op.value == "like":
+		c.op = op.value
+
+		if f.numeric {
+			return nil, newSyntaxError(op, "operator is not applicable to field %s", c.name)
+		}
+
+		if err := p.value(&c); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	return nil, newSyntaxError(op, "expected operator")
+}
+
+// value parses the value of comparison according to the type of its field
+func (p *parser) value(c *comparison) error {
+	t := p.next()
+
+	if c.field.numeric {
+		if t.kind != tokenNumber {
+			return newSyntaxError(t, "expected number for field %s", c.name)
+		}
+
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return newSyntaxError(t, "invalid number")
+		}
+
+		if c.name == "hour" && (n < 0 || n > 23 || n != math.Trunc(n)) {
+			return newSyntaxError(t, "hour must be integer between 0 and 23")
+		}
+
+		c.numbers = append(c.numbers, n)
+
+		return nil
+	}
+
+	if t.kind != tokenString {
+		return newSyntaxError(t, "expected string for field %s", c.name)
+	}
+
+	v := t.value
+	if c.name == "plate" {
+		v = plate.Normalize(v)
+	}
+
+	c.texts = append(c.texts, v)
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+var testData = []repo.SpeedFixation{
+	{
+		Date:          time.Date(2019, 12, 27, 23, 10, 0, 0, time.UTC),
+		VehicleNumber: "6048EC3",
+		Camera:        "C12",
+		Speed:         94.2,
+	},
+	{
+		Date:          time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC),
+		VehicleNumber: "0003AE3",
+		Camera:        "C14",
+		Speed:         104.5,
+	},
+	{
+		Date:          time.Date(2019, 12, 27, 4, 0, 0, 0, time.UTC),
+		VehicleNumber: "8911EE3",
+		Camera:        "C15",
+		Speed:         65.7,
+	},
+}
+
+func match(t *testing.T, input string) []repo.SpeedFixation {
+	t.Helper()
+
+	expr, err := Parse(input)
+	require.NoError(t, err)
+
+	var ret []repo.SpeedFixation
+
+	for _, sf := range testData {
+		if expr.Match(sf) {
+			ret = append(ret, sf)
+		}
+	}
+
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []repo.SpeedFixation
+	}{
+		{input: "", want: testData},
+		{input: `speed > 90 and camera in ("C12","C14") and hour between 22 and 6`, want: testData[:1]},
+		{input: `hour between 22 and 6`, want: []repo.SpeedFixation{testData[0], testData[2]}},
+		{input: `not (speed <= 90) or plate = "8911 ЕЕ-3"`, want: testData},
+		{input: `plate like "*EC-3" OR camera = "C15"`, want: []repo.SpeedFixation{testData[0], testData[2]}},
+		{input: `speed between 60 and 100 and camera != "C12"`, want: testData[2:]},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, match(t, tt.input), tt.input)
+	}
+}
+
+func TestParse_SyntaxError(t *testing.T) {
+	tests := []struct {
+		input string
+		want  SyntaxError
+	}{
+		{input: `speed >`, want: SyntaxError{Position: 7, Message: "expected number for field speed"}},
+		{input: `sped > 90`, want: SyntaxError{Position: 0, Token: "sped", Message: "unknown field"}},
+		{input: `camera > "C12"`, want: SyntaxError{Position: 7, Token: ">", Message: "operator is not applicable to field camera"}},
+		{input: `camera in ("C12" "C14")`, want: SyntaxError{Position: 17, Token: `"C14"`, Message: "expected , or )"}},
+		{input: `hour between 22 or 6`, want: SyntaxError{Position: 16, Token: "or", Message: "expected and"}},
+		{input: `speed > 90 camera = "C12"`, want: SyntaxError{Position: 11, Token: "camera", Message: "unexpected token"}},
+		{input: `camera = "C12`, want: SyntaxError{Position: 9, Token: `"C12`, Message: "unterminated string"}},
+		{input: `speed > 90 & hour < 6`, want: SyntaxError{Position: 11, Token: "&", Message: "unexpected character"}},
+		{input: `hour > 24`, want: SyntaxError{Position: 7, Token: "24", Message: "hour must be integer between 0 and 23"}},
+		{input: `hour between 22 and 6.5`, want: SyntaxError{Position: 20, Token: "6.5", Message: "hour must be integer between 0 and 23"}},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		require.Equal(t, &tt.want, err, tt.input)
+	}
+}
+
+func TestParseInLocation(t *testing.T) {
+	// 23:10 and 04:00 UTC are 02:10 and 07:00 in Minsk
+	expr, err := ParseInLocation(`hour between 22 and 6`, time.FixedZone("Europe/Minsk", 3*60*60))
+	require.NoError(t, err)
+
+	var ret []repo.SpeedFixation
+
+	for _, sf := range testData {
+		if expr.Match(sf) {
+			ret = append(ret, sf)
+		}
+	}
+
+	require.Equal(t, []repo.SpeedFixation{testData[0]}, ret)
+}
+
+func TestSpeedBounds(t *testing.T) {
+	expr, err := Parse(`speed > 90 and speed <= 120 and hour < 6`)
+	require.NoError(t, err)
+
+	lo, hi := SpeedBounds(expr)
+	require.Equal(t, 90.0, lo)
+	require.Equal(t, 120.0, hi)
+
+	expr, err = Parse(`speed > 90 or camera = "C12"`)
+	require.NoError(t, err)
+
+	lo, hi = SpeedBounds(expr)
+	require.Equal(t, math.Inf(-1), lo)
+	require.Equal(t, math.Inf(1), hi)
+}
+
+func TestValues(t *testing.T) {
+	e, err := Parse(`(plate = "6048 EC-3" or plate in ("0003 AE-3")) and camera = "C12" and speed > 90`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{plate.Normalize("6048 EC-3"), plate.Normalize("0003 AE-3")}, Values(e, "plate"))
+	require.Equal(t, []string{"C12"}, Values(e, "camera"))
+	require.True(t, Uses(e, "speed"))
+	require.False(t, Uses(e, "hour"))
+}
@@ -0,0 +1,131 @@
+// Package filter provides small expression language for searching speed fixations
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value string
+	pos   int
+}
+
+// SyntaxError describes invalid filter expression and points at the offending token
+type SyntaxError struct {
+	Position int    `json:"position"`
+	Token    string `json:"token"`
+	Message  string `json:"message"`
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+	}
+
+	return fmt.Sprintf("%s at position %d near %q", e.Message, e.Position, e.Token)
+}
+
+func newSyntaxError(t token, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Position: t.pos, Token: t.text, Message: fmt.Sprintf(format, args...)}
+}
+
+func tokenize(input string) ([]token, error) {
+	var (
+		tokens []token
+		runes  = []rune(input)
+	)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			start := i
+			i++
+
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+
+			text := string(runes[start:i])
+			if text == "!" {
+				return nil, &SyntaxError{Position: start, Token: text, Message: "unknown operator"}
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: text, value: text, pos: start})
+		case r == '"':
+			start := i
+			i++
+
+			var sb strings.Builder
+
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+
+				sb.WriteRune(runes[i])
+				i++
+			}
+
+			if i == len(runes) {
+				return nil, &SyntaxError{Position: start, Token: string(runes[start:]), Message: "unterminated string"}
+			}
+
+			i++
+
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), value: sb.String(), pos: start})
+		case unicode.IsDigit(r) || r == '.' || r == '-':
+			start := i
+			i++
+
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: text, pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenIdent, text: text, value: strings.ToLower(text), pos: start})
+		default:
+			return nil, &SyntaxError{Position: i, Token: string(r), Message: "unexpected character"}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
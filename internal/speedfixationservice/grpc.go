@@ -0,0 +1,799 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/luno/jettison/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/evidence"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/usecase"
+	pb "github.com/IgorRybak2055/speed-control-service/pkg/speedcontrolpb"
+)
+
+// limitedMethods are gRPC methods which work only in service hours of HTTP routes they mirror
+var limitedMethods = map[string]string{
+	"/speedcontrol.v1.SpeedControl/OverSpeed":   "/overspeed",
+	"/speedcontrol.v1.SpeedControl/MinMaxSpeed": "/minmaxspeed",
+	"/speedcontrol.v1.SpeedControl/Query":       "/search",
+}
+
+// cameraMethods are gRPC registration methods, they are signed by camera like HTTP registrations
+var cameraMethods = map[string]bool{
+	"/speedcontrol.v1.SpeedControl/Register":      true,
+	"/speedcontrol.v1.SpeedControl/RegisterBatch": true,
+}
+
+var registerStatuses = map[string]pb.RegisterStatus{
+	"accepted":    pb.RegisterStatus_ACCEPTED,
+	"duplicate":   pb.RegisterStatus_DUPLICATE,
+	"rejected":    pb.RegisterStatus_REJECTED,
+	"quarantined": pb.RegisterStatus_QUARANTINED,
+}
+
+// grpcServer implements SpeedControlServer with the same usecase as HTTP handlers
+type grpcServer struct {
+	srv *service
+}
+
+// newGRPCServer creates gRPC server, it serves TLS with the same certificates as HTTP server
+func (srv *service) newGRPCServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(srv.unaryInterceptor),
+		grpc.StreamInterceptor(srv.streamInterceptor),
+	}
+
+	if srv.certs != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(srv.tlsConfig())))
+	}
+
+	s := grpc.NewServer(opts...)
+
+	pb.RegisterSpeedControlServer(s, grpcServer{srv: srv})
+
+	return s
+}
+
+// contextStream is the server stream with context of authenticated camera or user,
+// messages sent to analysts are pseudonymized, requests and sent records are audited
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	srv *service
+}
+
+func (cs contextStream) Context() context.Context {
+	return cs.ctx
+}
+
+func (cs contextStream) SendMsg(m interface{}) error {
+	if pseudonymous(cs.ctx) {
+		cs.srv.pseudonymizeMessage(m)
+	}
+
+	if err := cs.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+
+	auditRecords(cs.ctx, messageRecords(m))
+
+	return nil
+}
+
+func (cs contextStream) RecvMsg(m interface{}) error {
+	if err := cs.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	auditRequest(cs.ctx, m)
+
+	return nil
+}
+
+// authorizeCall verifies bearer token sent in authorization metadata of query call
+func (srv *service) authorizeCall(ctx context.Context) (context.Context, error) {
+	if srv.tokens == nil {
+		return ctx, nil
+	}
+
+	var token string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = bearerToken(values[0])
+		}
+	}
+
+	claims, err := srv.authorizeToken(token, queryRoles)
+	auditUser(ctx, claims)
+
+	switch {
+	case errors.Is(err, jwt.ErrInvalidToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+func (srv *service) pseudonymizeFixations(fixations ...*pb.Fixation) {
+	for _, f := range fixations {
+		if f != nil {
+			f.VehicleNumber, f.RawVehicleNumber = srv.pseudonym(f.VehicleNumber), srv.pseudonym(f.RawVehicleNumber)
+		}
+	}
+}
+
+// pseudonymizeMessage replaces plates in response message of analyst
+func (srv *service) pseudonymizeMessage(m interface{}) {
+	switch m := m.(type) {
+	case *pb.Fixation:
+		srv.pseudonymizeFixations(m)
+	case *pb.FixationList:
+		srv.pseudonymizeFixations(m.Fixations...)
+	case *pb.SpeedStatistics:
+		srv.pseudonymizeFixations(m.Min, m.Max)
+		srv.pseudonymizeFixations(m.MinTies...)
+		srv.pseudonymizeFixations(m.MaxTies...)
+	}
+}
+
+// signedRegistration returns the content camera signs for registration: canonical encoding of the fixation
+// as for evidence signatures followed by new line and idempotency key, protobuf encoding is not signed
+// because it is not stable between implementations
+func signedRegistration(req *pb.RegisterRequest) []byte {
+	f := req.GetFixation()
+
+	fixation := repo.SpeedFixation{
+		VehicleNumber:    f.GetVehicleNumber(),
+		RawVehicleNumber: f.GetRawVehicleNumber(),
+		Camera:           f.GetCamera(),
+		Speed:            f.GetSpeed(),
+	}
+
+	if date, err := ptypes.Timestamp(f.GetDate()); err == nil {
+		fixation.Date = date
+	}
+
+	return append(append(evidence.Canonical(fixation), '\n'), req.GetIdempotencyKey()...)
+}
+
+// callCamera returns context of call made by camera from metadata and function verifying camera
+// signature of the signed content, nil function means that the call is not signed and it is allowed.
+// In mutual TLS mode camera is authenticated by its client certificate.
+func (srv *service) callCamera(ctx context.Context) (context.Context, func(body []byte) error, error) {
+	if srv.clientCerts {
+		var state *tls.ConnectionState
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				state = &info.State
+			}
+		}
+
+		camera, err := srv.certificateCamera(state)
+		if errors.Is(err, camauth.ErrUnauthenticated) {
+			return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if err != nil {
+			return nil, nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return context.WithValue(ctx, cameraKey{}, camera), nil, nil
+	}
+
+	if !srv.cameraAuth {
+		return ctx, nil, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	get := func(header string) string {
+		if values := md.Get(header); len(values) > 0 {
+			return values[0]
+		}
+
+		return ""
+	}
+
+	camera := get(camauth.CameraHeader)
+	if camera == "" && !srv.cameraAuthRequired {
+		return ctx, nil, nil
+	}
+
+	return context.WithValue(ctx, cameraKey{}, camera), func(body []byte) error {
+		err := srv.cameras.Verify(camera, get(camauth.TimestampHeader), get(camauth.SignatureHeader), body)
+		if errors.Is(err, camauth.ErrUnauthenticated) {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		return nil
+	}, nil
+}
+
+// signedStream verifies camera signature of stream when the client closes it, the camera signs
+// the content of signedRegistration of every message followed by new line, so handler must not
+// store anything before the end of stream
+type signedStream struct {
+	grpc.ServerStream
+	verify func(body []byte) error
+	body   []byte
+}
+
+func (ss *signedStream) RecvMsg(m interface{}) error {
+	err := ss.ServerStream.RecvMsg(m)
+	if err == io.EOF {
+		if err := ss.verify(ss.body); err != nil {
+			return err
+		}
+
+		return io.EOF
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if req, ok := m.(*pb.RegisterRequest); ok {
+		ss.body = append(append(ss.body, signedRegistration(req)...), '\n')
+	}
+
+	return nil
+}
+
+func (srv *service) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if route, ok := limitedMethods[info.FullMethod]; ok {
+		ctx, entry := srv.callAudit(ctx, info.FullMethod)
+		auditRequest(ctx, req)
+
+		defer func() {
+			srv.finishCallAudit(entry, err)
+		}()
+
+		if ctx, err = srv.authorizeCall(ctx); err != nil {
+			return nil, err
+		}
+
+		if err := srv.allowCall(ctx, srv.queryLimits, clientKey); err != nil {
+			return nil, err
+		}
+
+		if err := srv.checkServiceHours(route); err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		ctx, cancel := srv.withTimeout(ctx, route)
+		defer cancel()
+
+		resp, err = handler(ctx, req)
+		if err == nil {
+			auditRecords(ctx, messageRecords(resp))
+
+			if pseudonymous(ctx) {
+				srv.pseudonymizeMessage(resp)
+			}
+		}
+
+		return resp, err
+	}
+
+	if msg, ok := req.(*pb.RegisterRequest); ok && cameraMethods[info.FullMethod] {
+		var verify func(body []byte) error
+
+		if ctx, verify, err = srv.callCamera(ctx); err != nil {
+			return nil, err
+		}
+
+		// budget is spent before the signature is verified
+		if err := srv.allowCall(ctx, srv.ingestionLimits, callCameraKey); err != nil {
+			return nil, err
+		}
+
+		if verify != nil {
+			if err := verify(signedRegistration(msg)); err != nil {
+				return nil, err
+			}
+		}
+
+		// Register is the only unary camera method
+		var cancel context.CancelFunc
+
+		ctx, cancel = srv.withTimeout(ctx, "/register")
+		defer cancel()
+	}
+
+	return handler(ctx, req)
+}
+
+func (srv *service) streamInterceptor(s interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+	if route, ok := limitedMethods[info.FullMethod]; ok {
+		ctx, entry := srv.callAudit(ss.Context(), info.FullMethod)
+
+		defer func() {
+			srv.finishCallAudit(entry, err)
+		}()
+
+		if ctx, err = srv.authorizeCall(ctx); err != nil {
+			return err
+		}
+
+		if err := srv.allowCall(ctx, srv.queryLimits, clientKey); err != nil {
+			return err
+		}
+
+		if err := srv.checkServiceHours(route); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		ctx, cancel := srv.withTimeout(ctx, route)
+		defer cancel()
+
+		ss = contextStream{ServerStream: ss, ctx: ctx, srv: srv}
+	}
+
+	if cameraMethods[info.FullMethod] {
+		ctx, verify, err := srv.callCamera(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		if err := srv.allowCall(ctx, srv.ingestionLimits, callCameraKey); err != nil {
+			return err
+		}
+
+		if verify != nil {
+			ss = &signedStream{ServerStream: ss, verify: verify}
+		}
+
+		ss = contextStream{ServerStream: ss, ctx: ctx, srv: srv}
+	}
+
+	return handler(s, ss)
+}
+
+func toProto(fixation repo.SpeedFixation) (*pb.Fixation, error) {
+	date, err := ptypes.TimestampProto(fixation.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Fixation{
+		Date:             date,
+		VehicleNumber:    fixation.VehicleNumber,
+		RawVehicleNumber: fixation.RawVehicleNumber,
+		Country:          fixation.Country,
+		Camera:           fixation.Camera,
+		Speed:            fixation.Speed,
+		Flags:            fixation.Flags,
+	}, nil
+}
+
+func toProtoList(fixations []repo.SpeedFixation) ([]*pb.Fixation, error) {
+	ret := make([]*pb.Fixation, 0, len(fixations))
+
+	for _, fixation := range fixations {
+		f, err := toProto(fixation)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, f)
+	}
+
+	return ret, nil
+}
+
+// fromProto validates fixation sent by camera the same way as HTTP registration
+func fromProto(f *pb.Fixation) (repo.SpeedFixation, error) {
+	var (
+		ret  = repo.SpeedFixation{VehicleNumber: f.GetVehicleNumber(), Camera: f.GetCamera(), Speed: f.GetSpeed()}
+		verr ValidationError
+		err  error
+	)
+
+	if f.GetDate() == nil {
+		verr.add("date", "datetime not defined in this request")
+	} else if ret.Date, err = ptypes.Timestamp(f.GetDate()); err != nil {
+		verr.add("date", "unable parse datetime")
+	}
+
+	if ret.VehicleNumber == "" {
+		verr.add("vehicle_number", "vehicle number not defined in this request")
+	}
+
+	if ret.Speed == 0 {
+		verr.add("speed", "speed not defined in this request")
+	}
+
+	if len(verr.Errors) > 0 {
+		return repo.SpeedFixation{}, &verr
+	}
+
+	ret.Date = ret.Date.UTC()
+
+	return ret, nil
+}
+
+// day returns the date of the day from timestamp in UTC
+func day(ts *timestamp.Timestamp) (date time.Time, err error) {
+	if ts == nil {
+		return time.Time{}, status.Error(codes.InvalidArgument, "datetime not defined in this request")
+	}
+
+	if date, err = ptypes.Timestamp(ts); err != nil {
+		return time.Time{}, status.Error(codes.InvalidArgument, "unable parse datetime")
+	}
+
+	return date, nil
+}
+
+// contextStatus converts errors of done context to gRPC status, nil is returned for other errors
+func contextStatus(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return nil
+	}
+}
+
+// lookUpError converts errors of look up methods to gRPC status
+func lookUpError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Error(codes.NotFound, "no data for the day")
+	}
+
+	if s := contextStatus(err); s != nil {
+		return s
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (gs grpcServer) register(ctx context.Context, req *pb.RegisterRequest) (resp *pb.RegisterResponse, err error) {
+	defer func() {
+		if status.Code(err) == codes.InvalidArgument {
+			gs.srv.deadLetterCall(ctx, req, status.Convert(err).Message())
+		}
+	}()
+
+	fixation, err := fromProto(req.GetFixation())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if fixation.Camera, err = checkCamera(ctx, fixation.Camera); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if fixation, err = gs.srv.seal(fixation, req.GetSignature()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = gs.srv.uc.CreateRecord(ctx, fixation)
+	if errors.Is(err, repo.ErrClosed) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if s := contextStatus(err); s != nil {
+		return nil, s
+	}
+
+	if err != nil && !errors.Is(err, usecase.ErrQuarantined) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp = &pb.RegisterResponse{Status: registerStatuses[registerStatus(err)]}
+	if err != nil {
+		resp.Reason = err.Error()
+	}
+
+	return resp, nil
+}
+
+// Register stores fixation, requests with the same idempotency key get the original result
+func (gs grpcServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	key := req.GetIdempotencyKey()
+	if md, ok := metadata.FromIncomingContext(ctx); ok && key == "" {
+		if keys := md.Get(strings.ToLower(idempotencyKeyHeader)); len(keys) > 0 {
+			key = keys[0]
+		}
+	}
+
+	if key == "" || gs.srv.keys == nil {
+		return gs.register(ctx, req)
+	}
+
+	key = scopedKey(authenticatedCamera(ctx), "grpc:/Register", key)
+
+	hash, err := messageHash(req.GetFixation())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	stored, err := gs.srv.keys.Reserve(key)
+	if err != nil {
+		if errors.Is(err, repo.ErrKeyInProgress) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if stored != nil {
+		if stored.RequestHash != hash {
+			return nil, status.Error(codes.InvalidArgument, errKeyReused.Error())
+		}
+
+		return replayRegister(stored)
+	}
+
+	resp, err := gs.register(ctx, req)
+
+	code := status.Code(err)
+	if code == codes.Internal {
+		gs.srv.keys.Release(key)
+		return resp, err
+	}
+
+	body, merr := registerBody(resp, err)
+	if merr != nil {
+		gs.srv.keys.Release(key)
+		return resp, err
+	}
+
+	serr := gs.srv.keys.Save(repo.StoredResponse{Key: key, Status: int(code), Body: body, Created: gs.srv.now(), RequestHash: hash})
+	if serr != nil {
+		gs.srv.keys.Release(key)
+	}
+
+	return resp, err
+}
+
+// messageHash returns hash of deterministic protobuf encoding of message
+func messageHash(msg proto.Message) (string, error) {
+	var buf proto.Buffer
+
+	buf.SetDeterministic(true)
+
+	if err := buf.Marshal(msg); err != nil {
+		return "", err
+	}
+
+	return requestHash(buf.Bytes()), nil
+}
+
+// registerBody encodes the result of registration for idempotency storage
+func registerBody(resp *pb.RegisterResponse, err error) (json.RawMessage, error) {
+	if err != nil {
+		return json.Marshal(status.Convert(err).Message())
+	}
+
+	body, err := (&jsonpb.Marshaler{}).MarshalToString(resp)
+
+	return json.RawMessage(body), err
+}
+
+func replayRegister(stored *repo.StoredResponse) (*pb.RegisterResponse, error) {
+	if code := codes.Code(stored.Status); code != codes.OK {
+		var msg string
+
+		if err := json.Unmarshal(stored.Body, &msg); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return nil, status.Error(code, msg)
+	}
+
+	var resp pb.RegisterResponse
+
+	if err := jsonpb.UnmarshalString(string(stored.Body), &resp); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &resp, nil
+}
+
+// RegisterBatch receives all fixations of the stream and stores them in one storage transaction
+func (gs grpcServer) RegisterBatch(stream pb.SpeedControl_RegisterBatchServer) error {
+	var (
+		maxSize   = gs.srv.batchMaxSize
+		reqs      []*pb.RegisterRequest
+		results   []*pb.RegisterResult
+		fixations []repo.SpeedFixation
+		pos       []int
+	)
+
+	for i := 0; ; i++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if maxSize > 0 && i >= maxSize {
+			return status.Errorf(codes.InvalidArgument, "batch is larger than %d items", maxSize)
+		}
+
+		reqs = append(reqs, req)
+		results = append(results, &pb.RegisterResult{Index: int32(i)})
+
+		fixation, err := fromProto(req.GetFixation())
+		if err == nil {
+			fixation.Camera, err = checkCamera(stream.Context(), fixation.Camera)
+		}
+
+		if err == nil {
+			fixation, err = gs.srv.seal(fixation, req.GetSignature())
+		}
+
+		if err != nil {
+			results[i].Status, results[i].Reason = pb.RegisterStatus_REJECTED, err.Error()
+			continue
+		}
+
+		fixations = append(fixations, fixation)
+		pos = append(pos, i)
+	}
+
+	errs, err := gs.srv.uc.CreateRecords(stream.Context(), fixations)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for i, err := range errs {
+		r := results[pos[i]]
+		r.Status = registerStatuses[registerStatus(err)]
+
+		if err != nil && !errors.Is(err, repo.ErrDuplicate) {
+			r.Reason = err.Error()
+		}
+	}
+
+	for i, r := range results {
+		if r.Status == pb.RegisterStatus_REJECTED {
+			gs.srv.deadLetterCall(stream.Context(), reqs[i], r.Reason)
+		}
+	}
+
+	return stream.SendAndClose(&pb.RegisterBatchResponse{Results: results})
+}
+
+// OverSpeed returns fixations of the day with speed greater than the limit
+func (gs grpcServer) OverSpeed(ctx context.Context, req *pb.OverSpeedRequest) (*pb.FixationList, error) {
+	date, err := day(req.GetDate())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetSpeed() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "speed not defined in this request")
+	}
+
+	violators, err := gs.srv.uc.LookUpOverSpeedByDate(ctx, repo.SpeedFixation{Date: date, Speed: req.GetSpeed()})
+	if err != nil {
+		return nil, lookUpError(err)
+	}
+
+	fixations, err := toProtoList(violators)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.FixationList{Fixations: fixations}, nil
+}
+
+// MinMaxSpeed returns speed statistics of the day
+func (gs grpcServer) MinMaxSpeed(ctx context.Context, req *pb.MinMaxSpeedRequest) (*pb.SpeedStatistics, error) {
+	date, err := day(req.GetDate())
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := gs.srv.uc.LookUpSpeedStatisticsByDate(ctx, date)
+	if err != nil {
+		return nil, lookUpError(err)
+	}
+
+	resp := &pb.SpeedStatistics{Date: req.GetDate(), Count: int64(stats.Count), Mean: stats.Mean}
+
+	if stats.Min != nil {
+		if resp.Min, err = toProto(*stats.Min); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if stats.Max != nil {
+		if resp.Max, err = toProto(*stats.Max); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if resp.MinTies, err = toProtoList(stats.MinTies); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if resp.MaxTies, err = toProtoList(stats.MaxTies); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+// Query streams fixations of the date range matched by filter expression
+func (gs grpcServer) Query(req *pb.QueryRequest, stream pb.SpeedControl_QueryServer) error {
+	from, err := day(req.GetFrom())
+	if err != nil {
+		return err
+	}
+
+	to, err := day(req.GetTo())
+	if err != nil {
+		return err
+	}
+
+	if !gs.srv.searchRange(from, to) {
+		return status.Error(codes.InvalidArgument, "incorrect date range")
+	}
+
+	expr, err := filter.ParseInLocation(req.GetFilter(), gs.srv.schedules.Location())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if filter.Uses(expr, "plate") && pseudonymous(stream.Context()) {
+		return status.Error(codes.PermissionDenied, errForbidden.Error())
+	}
+
+	fixations, err := gs.srv.uc.SearchFixations(stream.Context(), from, to, expr)
+	if err != nil {
+		return lookUpError(err)
+	}
+
+	for _, fixation := range fixations {
+		f, err := toProto(fixation)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		if err := stream.Send(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
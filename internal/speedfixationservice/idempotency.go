@@ -0,0 +1,141 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// idempotencyKeyHeader is the header with client-supplied key, e.g. camera ID plus sequence number
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// responseCapture remembers status and body written by handler
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	rc.status = status
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.status = http.StatusOK
+	}
+
+	rc.body.Write(b)
+
+	return rc.ResponseWriter.Write(b)
+}
+
+// idempotencyKey returns key from header or from idempotency_key field of form or JSON body
+func idempotencyKey(r *http.Request, body []byte) string {
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		return key
+	}
+
+	if !isJSON(r) {
+		return r.FormValue("idempotency_key")
+	}
+
+	var field struct {
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+
+	// the body is validated by handler, here only the key is looked for
+	_ = json.Unmarshal(body, &field)
+
+	return field.IdempotencyKey
+}
+
+// requestHash returns hash of request body, responses are replayed only to the same requests
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// scopedKey returns idempotency key of the camera, so cameras do not see responses of each other
+func scopedKey(camera, route, key string) string {
+	return camera + "|" + route + "|" + key
+}
+
+// idempotentMiddleware replays the stored response to requests repeated with the same idempotency key,
+// the key reused for other request gets 422
+func (srv *service) idempotentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responseError(w, fieldError("body", "unable read request body"))
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		key := idempotencyKey(r, body)
+		if key == "" {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		key = scopedKey(authenticatedCamera(r.Context()), routePath(r.URL.Path), key)
+		hash := requestHash(body)
+
+		stored, err := srv.keys.Reserve(key)
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+
+		if stored != nil {
+			if stored.RequestHash != hash {
+				responseError(w, errKeyReused)
+				return
+			}
+
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			_, _ = w.Write(stored.Body)
+
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		rc := &responseCapture{ResponseWriter: w}
+		next.ServeHTTP(rc, r)
+
+		// server errors and canceled requests are not remembered, so the camera is able to retry the request
+		if rc.status >= http.StatusInternalServerError || rc.status == statusClientClosedRequest ||
+			!json.Valid(rc.body.Bytes()) {
+			srv.keys.Release(key)
+			return
+		}
+
+		err = srv.keys.Save(repo.StoredResponse{
+			Key:         key,
+			Status:      rc.status,
+			ContentType: rc.Header().Get("Content-Type"),
+			Body:        rc.body.Bytes(),
+			Created:     srv.now(),
+			RequestHash: hash,
+		})
+		if err != nil {
+			srv.keys.Release(key)
+		}
+	})
+}
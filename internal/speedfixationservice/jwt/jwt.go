@@ -0,0 +1,293 @@
+// Package jwt provides validation of JWT bearer tokens by local JSON Web Key Set
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrInvalidToken is returned for token which is malformed, expired or not signed by key of the set
+var ErrInvalidToken = errors.New("invalid token", errors.WithCode("unauthenticated"))
+
+// Supported signature algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// leeway is the allowed clock difference with token issuer
+const leeway = time.Minute
+
+// Audience is aud claim, it is string or array of strings
+type Audience []string
+
+// UnmarshalJSON decodes both forms of audience
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Claims are the claims of token used by the service
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	Expires   int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// HasRole reports whether token grants one of roles
+func (c Claims) HasRole(roles ...string) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// jwk is JSON Web Key of set, only symmetric, RSA and Ed25519 keys are supported
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+// key is the parsed key of set
+type key struct {
+	alg    string
+	secret []byte
+	rsa    *rsa.PublicKey
+	ed     ed25519.PublicKey
+}
+
+// Config describes accepted tokens, empty issuer and audience are not checked
+type Config struct {
+	Issuer   string
+	Audience string
+}
+
+// KeySet validates tokens by keys loaded from JSON Web Key Set
+type KeySet struct {
+	config Config
+	keys   map[string]key
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func parseKey(k jwk) (key, error) {
+	var (
+		ret key
+		err error
+	)
+
+	switch k.Kty {
+	case "oct":
+		ret.alg = HS256
+		ret.secret, err = decode(k.K)
+	case "RSA":
+		var n, e []byte
+
+		ret.alg = RS256
+
+		if n, err = decode(k.N); err == nil {
+			e, err = decode(k.E)
+		}
+
+		if err == nil {
+			ret.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		}
+	case "OKP":
+		ret.alg = EdDSA
+
+		if k.Crv != "Ed25519" {
+			return key{}, errors.New("unsupported curve", j.KV("kid", k.Kid), j.KV("crv", k.Crv))
+		}
+
+		if ret.ed, err = decode(k.X); err == nil && len(ret.ed) != ed25519.PublicKeySize {
+			err = errors.New("invalid Ed25519 key size")
+		}
+	default:
+		return key{}, errors.New("unsupported key type", j.KV("kid", k.Kid), j.KV("kty", k.Kty))
+	}
+
+	if err != nil {
+		return key{}, errors.Wrap(err, "invalid key", j.KV("kid", k.Kid))
+	}
+
+	if k.Alg != "" && k.Alg != ret.alg {
+		return key{}, errors.New("unsupported key algorithm", j.KV("kid", k.Kid), j.KV("alg", k.Alg))
+	}
+
+	return ret, nil
+}
+
+// LoadKeySet reads JSON Web Key Set
+func LoadKeySet(r io.Reader, config Config) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{config: config, keys: make(map[string]key, len(set.Keys))}
+
+	for _, k := range set.Keys {
+		parsed, err := parseKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		ks.keys[k.Kid] = parsed
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("key set is empty")
+	}
+
+	return ks, nil
+}
+
+// Sign returns HS256 token with claims, it is used in tests and by tools issuing tokens
+func Sign(kid string, secret []byte, claims Claims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": HS256, "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (k key) verify(signed, sig []byte) bool {
+	switch k.alg {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+
+		return hmac.Equal(mac.Sum(nil), sig)
+	case RS256:
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, sum[:], sig) == nil
+	case EdDSA:
+		return ed25519.Verify(k.ed, signed, sig)
+	}
+
+	return false
+}
+
+// Verify checks signature and validity of token and returns its claims
+func (ks *KeySet) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.Wrap(ErrInvalidToken, "malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	data, err := decode(parts[0])
+	if err == nil {
+		err = json.Unmarshal(data, &header)
+	}
+
+	if err != nil {
+		return Claims{}, errors.Wrap(ErrInvalidToken, "malformed header")
+	}
+
+	k, ok := ks.keys[header.Kid]
+	if !ok && header.Kid == "" && len(ks.keys) == 1 {
+		for _, k = range ks.keys {
+			ok = true
+		}
+	}
+
+	// algorithm is defined by key, so token can not choose weaker one
+	if !ok || k.alg != header.Alg {
+		return Claims{}, errors.Wrap(ErrInvalidToken, "unknown signing key")
+	}
+
+	sig, err := decode(parts[2])
+	if err != nil || !k.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return Claims{}, errors.Wrap(ErrInvalidToken, "invalid signature")
+	}
+
+	var claims Claims
+
+	data, err = decode(parts[1])
+	if err == nil {
+		err = json.Unmarshal(data, &claims)
+	}
+
+	if err != nil {
+		return Claims{}, errors.Wrap(ErrInvalidToken, "malformed claims")
+	}
+
+	return claims, ks.check(claims, now)
+}
+
+// check validates registered claims
+func (ks *KeySet) check(claims Claims, now time.Time) error {
+	switch {
+	case claims.Expires == 0 || now.Add(-leeway).Unix() >= claims.Expires:
+		return errors.Wrap(ErrInvalidToken, "token is expired")
+	case claims.NotBefore != 0 && now.Add(leeway).Unix() < claims.NotBefore:
+		return errors.Wrap(ErrInvalidToken, "token is not valid yet")
+	case ks.config.Issuer != "" && claims.Issuer != ks.config.Issuer:
+		return errors.Wrap(ErrInvalidToken, "unexpected issuer")
+	}
+
+	if ks.config.Audience == "" {
+		return nil
+	}
+
+	for _, aud := range claims.Audience {
+		if aud == ks.config.Audience {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrInvalidToken, "unexpected audience")
+}
@@ -0,0 +1,94 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet_Verify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	set := `{"keys":[
+		{"kid":"hs","kty":"oct","k":"` + base64.RawURLEncoding.EncodeToString(secret) + `"},
+		{"kid":"ed","kty":"OKP","crv":"Ed25519","x":"` + base64.RawURLEncoding.EncodeToString(pub) + `"}
+	]}`
+
+	ks, err := LoadKeySet(strings.NewReader(set), Config{Issuer: "idp", Audience: "speed-control"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := Claims{
+		Subject:  "alice",
+		Issuer:   "idp",
+		Audience: Audience{"speed-control"},
+		Expires:  now.Add(time.Hour).Unix(),
+		Roles:    []string{"analyst"},
+	}
+
+	token, err := Sign("hs", secret, claims)
+	require.NoError(t, err)
+
+	got, err := ks.Verify(token, now)
+	require.NoError(t, err)
+	require.Equal(t, claims, got)
+	require.True(t, got.HasRole("officer", "analyst"))
+	require.False(t, got.HasRole("admin"))
+
+	edToken := func(claims Claims) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"ed"}`))
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+
+		signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+		return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(signed)))
+	}
+
+	_, err = ks.Verify(edToken(claims), now)
+	require.NoError(t, err)
+
+	expired := claims
+	expired.Expires = now.Add(-time.Hour).Unix()
+
+	wrongAudience := claims
+	wrongAudience.Audience = Audience{"other"}
+
+	forged, err := Sign("hs", []byte("other secret"), claims)
+	require.NoError(t, err)
+
+	// HS256 token with kid of Ed25519 key must not be verified by public key used as secret
+	confused, err := Sign("ed", pub, claims)
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"malformed":      "abc",
+		"expired":        edToken(expired),
+		"wrong audience": edToken(wrongAudience),
+		"forged":         forged,
+		"alg confusion":  confused,
+	} {
+		_, err := ks.Verify(token, now)
+		require.True(t, errors.Is(err, ErrInvalidToken), name)
+	}
+}
+
+func TestAudience_UnmarshalJSON(t *testing.T) {
+	var claims Claims
+
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":"one"}`), &claims))
+	require.Equal(t, Audience{"one"}, claims.Audience)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":["one","two"]}`), &claims))
+	require.Equal(t, Audience{"one", "two"}, claims.Audience)
+}
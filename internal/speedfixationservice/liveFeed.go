@@ -0,0 +1,199 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"golang.org/x/net/websocket"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/feed"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+const defaultFeedHeartbeat = 15 * time.Second
+
+// feedMessage is the message of WebSocket feed
+type feedMessage struct {
+	Type     string              `json:"type"`
+	ID       uint64              `json:"id,omitempty"`
+	Fixation *repo.SpeedFixation `json:"fixation,omitempty"`
+}
+
+// feedSubscription reads filter and the last received event ID of subscription from request,
+// the ID is sent in Last-Event-ID header by reconnecting EventSource or in last_event_id parameter
+func feedSubscription(r *http.Request) (feed.Filter, uint64, error) {
+	var (
+		f      = feed.Filter{Camera: r.FormValue("camera"), Plate: r.FormValue("plate")}
+		verr   ValidationError
+		lastID uint64
+		err    error
+	)
+
+	if minSpeed := r.FormValue("min_speed"); minSpeed != "" {
+		if f.MinSpeed, err = strconv.ParseFloat(minSpeed, 64); err != nil {
+			verr.add("min_speed", "unable parse speed")
+		}
+	}
+
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.FormValue("last_event_id")
+	}
+
+	if id != "" {
+		if lastID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			verr.add("last_event_id", "unable parse event id")
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return feed.Filter{}, 0, &verr
+	}
+
+	// plates are not known to analysts, so they can not look for them
+	if f.Plate != "" && pseudonymous(r.Context()) {
+		return feed.Filter{}, 0, errForbidden
+	}
+
+	return f, lastID, nil
+}
+
+func (srv service) heartbeat() time.Duration {
+	if srv.feedHeartbeat > 0 {
+		return srv.feedHeartbeat
+	}
+
+	return defaultFeedHeartbeat
+}
+
+// feedEvents streams stored fixations as Server-Sent Events
+func (srv service) feedEvents(w http.ResponseWriter, r *http.Request) {
+	f, lastID, err := feedSubscription(r)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responseError(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	sub := srv.feed.Subscribe(f, lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(srv.heartbeat())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event.Fixation)
+			if err == nil {
+				data, err = srv.pseudonymizeJSON(r.Context(), data)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: fixation\ndata: %s\n\n", event.ID, data); err != nil {
+				return
+			}
+
+			auditRecords(r.Context(), 1)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// feedWebSocket streams stored fixations as WebSocket JSON messages
+func (srv service) feedWebSocket(w http.ResponseWriter, r *http.Request) {
+	f, lastID, err := feedSubscription(r)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	// subscription starts before handshake, so client does not miss events stored right after it connects
+	sub := srv.feed.Subscribe(f, lastID)
+	defer sub.Close()
+
+	// the handshake does not check origin, access is controlled like for other query endpoints
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		closed := make(chan struct{})
+
+		// client messages are ignored, reading detects closed connection
+		go func() {
+			defer close(closed)
+
+			var msg string
+
+			for {
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(srv.heartbeat())
+		defer ticker.Stop()
+
+		for {
+			var msg feedMessage
+
+			select {
+			case <-closed:
+				return
+			case <-ticker.C:
+				msg = feedMessage{Type: "heartbeat"}
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				msg = feedMessage{Type: "fixation", ID: event.ID, Fixation: &event.Fixation}
+			}
+
+			data, err := json.Marshal(msg)
+			if err == nil {
+				data, err = srv.pseudonymizeJSON(r.Context(), data)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if err := websocket.Message.Send(ws, string(data)); err != nil {
+				return
+			}
+
+			if msg.Fixation != nil {
+				auditRecords(r.Context(), 1)
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
@@ -0,0 +1,1139 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// openAPISpec is the OpenAPI 3 specification of the current API version,
+// routes are registered and parameters and request bodies are validated by it
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Speed control service",
+    "description": "Registration of traffic camera speed fixations and queries on them. Query endpoints work only in service hours of their route and answer 406 outside of them with Retry-After header and opens_at of the error when the route opens again. Unversioned paths are deprecated aliases of /v1 paths. Registrations are signed by camera keys issued through the admin API, in mutual TLS mode they are authorized by client certificate of camera instead, its subject common name is the ID of registered camera. Other endpoints except this specification require bearer token. Cameras and query users are rate limited by separate budgets and get 429 with Retry-After when they spend them. Errors are returned in the Error envelope with a stable code, every response has X-Request-ID header.",
+    "version": "1.0.0"
+  },
+  "servers": [{"url": "/v1"}],
+  "paths": {
+    "/register": {
+      "post": {
+        "operationId": "register",
+        "summary": "Register speed fixation",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"},
+          {"$ref": "#/components/parameters/CameraID"},
+          {"$ref": "#/components/parameters/CameraTimestamp"},
+          {"$ref": "#/components/parameters/CameraSignature"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/Registration"}},
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/Registration"}}
+          }
+        },
+        "responses": {
+          "200": {"description": "Fixation is stored", "content": {"application/json": {"schema": {"type": "string", "example": "register success"}}}},
+          "202": {"description": "Fixation is quarantined by validation rules", "content": {"application/json": {"schema": {"type": "string", "example": "register quarantined"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "409": {"$ref": "#/components/responses/Conflict"},
+          "413": {"$ref": "#/components/responses/PayloadTooLarge"},
+          "422": {"$ref": "#/components/responses/KeyReused"},
+          "429": {"$ref": "#/components/responses/TooManyRequests"},
+          "500": {"$ref": "#/components/responses/Internal"}
+        }
+      }
+    },
+    "/register/batch": {
+      "post": {
+        "operationId": "registerBatch",
+        "summary": "Register fixations buffered by camera",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"},
+          {"$ref": "#/components/parameters/CameraID"},
+          {"$ref": "#/components/parameters/CameraTimestamp"},
+          {"$ref": "#/components/parameters/CameraSignature"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Registration"}}},
+            "application/x-ndjson": {"schema": {"$ref": "#/components/schemas/Registration"}}
+          }
+        },
+        "responses": {
+          "200": {"description": "Result of every item", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/BatchResult"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "409": {"$ref": "#/components/responses/Conflict"},
+          "413": {"$ref": "#/components/responses/PayloadTooLarge"},
+          "422": {"$ref": "#/components/responses/KeyReused"},
+          "429": {"$ref": "#/components/responses/TooManyRequests"}
+        }
+      }
+    },
+    "/overspeed": {
+      "get": {
+        "operationId": "overSpeed",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Fixations of the day with speed greater than the limit",
+        "parameters": [
+          {"$ref": "#/components/parameters/Date"},
+          {"name": "speed", "in": "query", "required": true, "schema": {"type": "number", "minimum": 0, "exclusiveMinimum": true}}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Fixations"},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/minmaxspeed": {
+      "get": {
+        "operationId": "minMaxSpeed",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Fixations with minimal and maximal speed of the day",
+        "parameters": [{"$ref": "#/components/parameters/Date"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Fixations"},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/statistics": {
+      "get": {
+        "operationId": "speedStatistics",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Speed statistics of the day",
+        "parameters": [{"$ref": "#/components/parameters/Date"}],
+        "responses": {
+          "200": {"description": "Statistics", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SpeedStatistics"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/repeatoffenders": {
+      "get": {
+        "operationId": "repeatOffenders",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Vehicles which exceeded the speed limit repeatedly",
+        "parameters": [
+          {"$ref": "#/components/parameters/Date"},
+          {"name": "speed", "in": "query", "required": true, "schema": {"type": "number"}},
+          {"name": "days", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1, "maximum": 366}},
+          {"name": "violations", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1}}
+        ],
+        "responses": {
+          "200": {"description": "Offenders", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Offender"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/platesearch": {
+      "get": {
+        "operationId": "plateSearch",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["officer", "admin"],
+        "summary": "Vehicles with plates similar to the pattern",
+        "parameters": [
+          {"name": "plate", "in": "query", "required": true, "description": "Plate or wildcard pattern with * and ?", "schema": {"type": "string"}},
+          {"name": "distance", "in": "query", "schema": {"type": "number", "minimum": 0}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 0}}
+        ],
+        "responses": {
+          "200": {"description": "Candidates", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/PlateCandidate"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/search": {
+      "get": {
+        "operationId": "search",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Fixations of the date range matched by filter expression",
+        "parameters": [
+          {"name": "from", "in": "query", "required": true, "schema": {"$ref": "#/components/schemas/Day"}},
+          {"name": "to", "in": "query", "required": true, "schema": {"$ref": "#/components/schemas/Day"}},
+          {"name": "filter", "in": "query", "description": "Filter expression, e.g. speed > 90 and camera in (\"C12\",\"C14\"), hour is evaluated in the service time zone", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Fixations"},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/flagged": {
+      "get": {
+        "operationId": "flagged",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Fixations of the day which broke validation rules",
+        "parameters": [{"$ref": "#/components/parameters/Date"}],
+        "responses": {
+          "200": {"description": "Flagged and quarantined fixations", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/validationstats": {
+      "get": {
+        "operationId": "validationStats",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Counters of validation rules",
+        "responses": {
+          "200": {"description": "Counters by rule name", "content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    },
+    "/admin/deadletters": {
+      "get": {
+        "operationId": "deadLetterList",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Rejected registration requests",
+        "description": "Rejected requests and rejected items of batches, items are kept as single registrations.",
+        "parameters": [
+          {"name": "from", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "to", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "camera", "in": "query", "description": "Authenticated camera which sent the request", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Dead letters", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "object"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/admin/deadletters/replay": {
+      "post": {
+        "operationId": "deadLetterReplay",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Send rejected registration request again",
+        "parameters": [{"name": "id", "in": "query", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "Response of registration handler", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/admin/ratelimits": {
+      "get": {
+        "operationId": "rateLimitStats",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Counters of rate limits",
+        "description": "Requests allowed and throttled by ingestion and query budgets, clients are throttled requests by key: camera, token subject or client address.",
+        "responses": {
+          "200": {"description": "Counters by budget", "content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/RateLimitStats"}}}}}
+        }
+      }
+    },
+    "/admin/audit": {
+      "get": {
+        "operationId": "auditList",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Audit log of data access",
+        "description": "Every request to query endpoints, including denied ones, is recorded with user, parameters, looked up plates and the number of returned records. gRPC calls are recorded with method GRPC, full method name as path and gRPC code as status.",
+        "parameters": [
+          {"name": "user", "in": "query", "schema": {"type": "string"}},
+          {"name": "plate", "in": "query", "schema": {"type": "string"}},
+          {"name": "from", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "to", "in": "query", "schema": {"type": "string", "format": "date-time"}}
+        ],
+        "responses": {
+          "200": {"description": "Audit entries ordered by time", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/AuditEntry"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/admin/webhooks": {
+      "get": {
+        "operationId": "webhookList",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Webhook subscriptions, secrets are not shown",
+        "responses": {
+          "200": {"description": "Subscriptions", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookSubscription"}}}}}
+        }
+      },
+      "post": {
+        "operationId": "webhookCreate",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Subscribe receiver to violations",
+        "description": "Violation is the stored fixation with speed greater than min_speed. Receiver gets POST with JSON payload and headers X-Webhook-Delivery, X-Webhook-Timestamp and X-Webhook-Signature, the signature is sha256= followed by hex HMAC-SHA256 of timestamp, dot and body with the subscription secret. Failed deliveries are retried with exponential backoff, after the last attempt delivery becomes dead.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookSubscription"}}}
+        },
+        "responses": {
+          "201": {"description": "Subscription with secret, the secret is generated when it is not sent", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookSubscription"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      },
+      "delete": {
+        "operationId": "webhookDelete",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Delete subscription",
+        "parameters": [{"name": "id", "in": "query", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "204": {"description": "Subscription deleted"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "409": {"$ref": "#/components/responses/Conflict"}
+        }
+      }
+    },
+    "/admin/webhooks/deliveries": {
+      "get": {
+        "operationId": "webhookDeliveries",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Delivery log, dead deliveries are the dead-letter list",
+        "parameters": [
+          {"name": "state", "in": "query", "schema": {"type": "string", "enum": ["held", "pending", "delivered", "dead", "canceled"]}},
+          {"name": "subscription_id", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Deliveries", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookDelivery"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/admin/webhooks/deliveries/retry": {
+      "post": {
+        "operationId": "webhookRetry",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Schedule dead delivery again",
+        "parameters": [{"name": "id", "in": "query", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "Scheduled delivery", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookDelivery"}}}},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "409": {"$ref": "#/components/responses/Conflict"}
+        }
+      }
+    },
+    "/admin/cameras": {
+      "get": {
+        "operationId": "cameraList",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Registered cameras and their keys, secrets are not shown",
+        "responses": {
+          "200": {"description": "Cameras", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Camera"}}}}}
+        }
+      }
+    },
+    "/admin/cameras/keys": {
+      "post": {
+        "operationId": "cameraKeyIssue",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Issue new key of the camera, the camera is registered by its first key",
+        "parameters": [{"$ref": "#/components/parameters/Camera"}],
+        "responses": {
+          "201": {"description": "Key with secret, the secret is shown only once", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CameraKey"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      },
+      "delete": {
+        "operationId": "cameraKeyRevoke",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Revoke key of the camera, all keys are revoked when key is not set",
+        "parameters": [
+          {"$ref": "#/components/parameters/Camera"},
+          {"name": "key", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "204": {"description": "Key revoked"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/admin/cameras/keys/rotate": {
+      "post": {
+        "operationId": "cameraKeyRotate",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Issue new key of the camera, other keys expire after grace period",
+        "parameters": [
+          {"$ref": "#/components/parameters/Camera"},
+          {"name": "grace", "in": "query", "description": "Go duration, e.g. 24h, old keys expire immediately by default", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "201": {"description": "Key with secret, the secret is shown only once", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CameraKey"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/admin/cameras/publickeys": {
+      "post": {
+        "operationId": "cameraPublicKeyAdd",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Register Ed25519 public key which verifies evidence signatures of the camera",
+        "parameters": [{"$ref": "#/components/parameters/Camera"}],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "object", "required": ["public_key"], "properties": {"public_key": {"type": "string", "description": "Base64 Ed25519 public key"}}}}}
+        },
+        "responses": {
+          "201": {"description": "Registered key", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CameraPublicKey"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "409": {"$ref": "#/components/responses/Conflict"}
+        }
+      },
+      "delete": {
+        "operationId": "cameraPublicKeyRevoke",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["admin"],
+        "summary": "Revoke public key, stored fixations signed by it stay verifiable",
+        "parameters": [
+          {"$ref": "#/components/parameters/Camera"},
+          {"name": "key", "in": "query", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "204": {"description": "Key revoked"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/evidence/verify": {
+      "get": {
+        "operationId": "evidenceVerify",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["officer", "admin"],
+        "summary": "Verify evidence signatures of stored fixations",
+        "parameters": [
+          {"name": "date", "in": "query", "required": true, "schema": {"type": "string", "format": "date-time"}},
+          {"name": "vehicle_number", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "camera", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Result of every matched fixation", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/EvidenceResult"}}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/feed": {
+      "get": {
+        "operationId": "feedEvents",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Live feed of stored fixations as Server-Sent Events",
+        "description": "Every fixation is sent as event of type fixation with JSON data, comments are sent as heartbeat. Reconnecting client gets recent events after Last-Event-ID.",
+        "parameters": [
+          {"$ref": "#/components/parameters/FeedCamera"},
+          {"$ref": "#/components/parameters/FeedMinSpeed"},
+          {"$ref": "#/components/parameters/FeedPlate"},
+          {"$ref": "#/components/parameters/LastEventIDHeader"},
+          {"$ref": "#/components/parameters/LastEventID"}
+        ],
+        "responses": {
+          "200": {"description": "Event stream", "content": {"text/event-stream": {}}},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/feed/ws": {
+      "get": {
+        "operationId": "feedWebSocket",
+        "security": [{"bearerAuth": []}],
+        "x-roles": ["analyst", "officer", "admin"],
+        "summary": "Live feed of stored fixations over WebSocket",
+        "description": "Every message is JSON object with type fixation or heartbeat, fixation messages have id and fixation fields.",
+        "parameters": [
+          {"$ref": "#/components/parameters/FeedCamera"},
+          {"$ref": "#/components/parameters/FeedMinSpeed"},
+          {"$ref": "#/components/parameters/FeedPlate"},
+          {"$ref": "#/components/parameters/LastEventID"}
+        ],
+        "responses": {
+          "101": {"description": "Switching to WebSocket protocol"},
+          "400": {"$ref": "#/components/responses/BadRequest"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "operationId": "openAPI",
+        "summary": "This specification",
+        "responses": {"200": {"description": "OpenAPI 3 specification", "content": {"application/json": {}}}}
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "Token signed by key of the configured key set with roles claim, x-roles of operation lists roles allowed to use it. Analysts see pseudonyms instead of plates and can not filter by plate."}
+    },
+    "parameters": {
+      "Date": {"name": "date", "in": "query", "required": true, "schema": {"$ref": "#/components/schemas/Day"}},
+      "FeedCamera": {"name": "camera", "in": "query", "schema": {"type": "string"}},
+      "FeedMinSpeed": {"name": "min_speed", "in": "query", "description": "Only fixations with speed not less than this one", "schema": {"type": "number", "minimum": 0}},
+      "FeedPlate": {"name": "plate", "in": "query", "description": "Vehicle number or wildcard pattern with * and ?", "schema": {"type": "string"}},
+      "LastEventIDHeader": {"name": "Last-Event-ID", "in": "header", "schema": {"type": "integer", "minimum": 0}},
+      "LastEventID": {"name": "last_event_id", "in": "query", "description": "ID of the last received event, recent events after it are sent first", "schema": {"type": "integer", "minimum": 0}},
+      "Camera": {"name": "camera", "in": "query", "required": true, "schema": {"type": "string"}},
+      "CameraID": {"name": "X-Camera-ID", "in": "header", "description": "Camera which signed the request, fixations without camera get this one", "schema": {"type": "string"}},
+      "CameraTimestamp": {"name": "X-Camera-Timestamp", "in": "header", "description": "Unix time of signing, it must be within the replay window of the service clock", "schema": {"type": "integer"}},
+      "CameraSignature": {"name": "X-Camera-Signature", "in": "header", "description": "sha256= followed by hex HMAC-SHA256 of timestamp, dot and body with the camera key secret, query string is signed when the body is empty", "schema": {"type": "string"}},
+      "IdempotencyKey": {"name": "Idempotency-Key", "in": "header", "description": "The original response is returned for retries of the same request with the same key, keys are separate for every camera", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "BadRequest": {"description": "Invalid request, codes invalid_request, invalid_filter, unknown_plate_format, invalid_evidence, invalid_public_key, rejected", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Unauthorized": {"description": "Registration is not signed by active key of the camera or is replayed, or bearer token is missing or invalid, code unauthenticated", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Forbidden": {"description": "Token does not grant role of the operation, code forbidden", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "NotFound": {"description": "Record or data of the day not found, codes not_found, no_data", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Conflict": {"description": "Fixation already registered, idempotency key in progress or resource can not be changed, codes duplicate, key_in_progress, static_subscription, delivery_not_dead", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "KeyReused": {"description": "Idempotency key is already used by the camera for other request, code key_reused", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "PayloadTooLarge": {"description": "Request body is larger than the configured limit, code body_too_large", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "TooManyRequests": {
+        "description": "Client spent its budget, cameras and query users have separate budgets, code rate_limited",
+        "headers": {"Retry-After": {"description": "Seconds after which request is allowed", "schema": {"type": "integer"}}},
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      },
+      "Internal": {"description": "Service failure, code internal, the request can be retried", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Fixations": {"description": "Fixations", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Fixation"}}}}}
+    },
+    "schemas": {
+      "Day": {"type": "string", "pattern": "^[0-9]{2}\\.[0-9]{2}\\.[0-9]{4}$", "example": "27.12.2019"},
+      "Registration": {
+        "type": "object",
+        "required": ["date", "vehicle_number", "speed"],
+        "properties": {
+          "date": {"type": "string", "description": "RFC 3339 or 02.01.2006 15:04:05", "example": "2019-12-27T15:03:27Z"},
+          "vehicle_number": {"type": "string", "example": "6048 EC-3"},
+          "speed": {"type": "number", "example": 84.5},
+          "camera": {"type": "string", "example": "C12"},
+          "idempotency_key": {"type": "string"},
+          "signature": {"type": "string", "description": "Base64 Ed25519 signature of canonical encoding of fixation: JSON object without spaces with fields camera, date, speed and vehicle_number in this order, date is RFC 3339 in UTC. Required for cameras with public keys."}
+        }
+      },
+      "Fixation": {
+        "type": "object",
+        "properties": {
+          "date": {"type": "string", "format": "date-time"},
+          "vehicle_number": {"type": "string"},
+          "raw_vehicle_number": {"type": "string"},
+          "country": {"type": "string"},
+          "camera": {"type": "string"},
+          "speed": {"type": "number"},
+          "flags": {"type": "array", "items": {"type": "string"}},
+          "evidence": {"$ref": "#/components/schemas/Evidence"}
+        }
+      },
+      "Evidence": {
+        "type": "object",
+        "properties": {
+          "signature": {"type": "string"},
+          "key_id": {"type": "string"}
+        }
+      },
+      "EvidenceResult": {
+        "type": "object",
+        "properties": {
+          "fixation": {"$ref": "#/components/schemas/Fixation"},
+          "valid": {"type": "boolean"},
+          "reason": {"type": "string"}
+        }
+      },
+      "SpeedStatistics": {
+        "type": "object",
+        "properties": {
+          "date": {"type": "string", "format": "date-time"},
+          "count": {"type": "integer"},
+          "mean": {"type": "number"},
+          "min": {"$ref": "#/components/schemas/Fixation"},
+          "max": {"$ref": "#/components/schemas/Fixation"},
+          "min_ties": {"type": "array", "items": {"$ref": "#/components/schemas/Fixation"}},
+          "max_ties": {"type": "array", "items": {"$ref": "#/components/schemas/Fixation"}}
+        }
+      },
+      "Offender": {
+        "type": "object",
+        "properties": {
+          "vehicle_number": {"type": "string"},
+          "violations": {"type": "array", "items": {"$ref": "#/components/schemas/Fixation"}}
+        }
+      },
+      "PlateCandidate": {
+        "type": "object",
+        "properties": {
+          "vehicle_number": {"type": "string"},
+          "distance": {"type": "number"},
+          "fixations": {"type": "array", "items": {"$ref": "#/components/schemas/Fixation"}}
+        }
+      },
+      "BatchResult": {
+        "type": "object",
+        "properties": {
+          "index": {"type": "integer"},
+          "status": {"type": "string", "enum": ["accepted", "duplicate", "quarantined", "rejected"]},
+          "reason": {"type": "string"},
+          "errors": {"type": "array", "items": {"$ref": "#/components/schemas/FieldError"}}
+        }
+      },
+      "WebhookSubscription": {
+        "type": "object",
+        "required": ["url"],
+        "properties": {
+          "id": {"type": "string", "readOnly": true},
+          "url": {"type": "string", "format": "uri"},
+          "secret": {"type": "string"},
+          "min_speed": {"type": "number", "minimum": 0},
+          "camera": {"type": "string"},
+          "created": {"type": "string", "format": "date-time", "readOnly": true},
+          "static": {"type": "boolean", "readOnly": true}
+        }
+      },
+      "Camera": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "keys": {"type": "array", "items": {"$ref": "#/components/schemas/CameraKey"}},
+          "public_keys": {"type": "array", "items": {"$ref": "#/components/schemas/CameraPublicKey"}},
+          "created": {"type": "string", "format": "date-time"}
+        }
+      },
+      "CameraPublicKey": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "key": {"type": "string"},
+          "created": {"type": "string", "format": "date-time"},
+          "revoked": {"type": "string", "format": "date-time"}
+        }
+      },
+      "CameraKey": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "secret": {"type": "string"},
+          "created": {"type": "string", "format": "date-time"},
+          "expires": {"type": "string", "format": "date-time"},
+          "revoked": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "subscription_id": {"type": "string"},
+          "url": {"type": "string"},
+          "payload": {"type": "object"},
+          "state": {"type": "string", "enum": ["held", "pending", "delivered", "dead", "canceled"]},
+          "attempts": {"type": "integer"},
+          "next_attempt": {"type": "string", "format": "date-time"},
+          "created": {"type": "string", "format": "date-time"},
+          "updated": {"type": "string", "format": "date-time"},
+          "last_status": {"type": "integer"},
+          "last_error": {"type": "string"}
+        }
+      },
+      "RateLimitStats": {
+        "type": "object",
+        "properties": {
+          "allowed": {"type": "integer"},
+          "throttled": {"type": "integer"},
+          "clients": {"type": "object", "additionalProperties": {"type": "integer"}}
+        }
+      },
+      "AuditEntry": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "user": {"type": "string"},
+          "roles": {"type": "array", "items": {"type": "string"}},
+          "method": {"type": "string"},
+          "path": {"type": "string"},
+          "params": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}},
+          "plates": {"type": "array", "items": {"type": "string"}},
+          "status": {"type": "integer"},
+          "records": {"type": "integer"},
+          "request_id": {"type": "string"},
+          "remote_addr": {"type": "string"}
+        }
+      },
+      "FieldError": {
+        "type": "object",
+        "properties": {
+          "field": {"type": "string"},
+          "message": {"type": "string"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "object",
+            "required": ["code", "message"],
+            "properties": {
+              "code": {
+                "type": "string",
+                "description": "Stable machine-readable code: invalid_request (400, details describe invalid fields), invalid_filter (400), unknown_plate_format (400), rejected (400, validation rules), invalid_evidence (400, evidence signature is not valid), invalid_public_key (400), unauthenticated (401, camera signature or bearer token is not valid), forbidden (403, token does not grant role of the route), not_found (404), no_data (404, no fixations of the day), method_not_allowed (405), out_of_service_hours (406), duplicate (409), key_in_progress (409), static_subscription (409, webhook configured by file), delivery_not_dead (409, only dead delivery is retried), body_too_large (413), key_reused (422, idempotency key of other request), rate_limited (429), internal (500), shutting_down (503, service is stopping), timeout (504, endpoint timeout passed), canceled (499, client closed the request, it is only logged)",
+                "enum": ["invalid_request", "invalid_filter", "unknown_plate_format", "rejected", "invalid_evidence", "invalid_public_key", "unauthenticated", "forbidden", "not_found", "no_data", "method_not_allowed", "out_of_service_hours", "duplicate", "key_in_progress", "static_subscription", "delivery_not_dead", "body_too_large", "key_reused", "rate_limited", "internal", "shutting_down", "timeout", "canceled"]
+              },
+              "message": {"type": "string"},
+              "details": {"type": "array", "items": {"$ref": "#/components/schemas/FieldError"}},
+              "opens_at": {"type": "string", "format": "date-time", "description": "Next opening of route closed by service hours"},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+// apiSpec is the part of OpenAPI specification used for routing and validation
+type apiSpec struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    map[string]*schema   `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+// requestBody is the body of operation, its schema depends on media type
+type requestBody struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Ref              string             `json:"$ref"`
+	Type             string             `json:"type"`
+	Format           string             `json:"format"`
+	Pattern          string             `json:"pattern"`
+	Minimum          *float64           `json:"minimum"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum"`
+	Maximum          *float64           `json:"maximum"`
+	Enum             []string           `json:"enum"`
+	Required         []string           `json:"required"`
+	Properties       map[string]*schema `json:"properties"`
+	Items            *schema            `json:"items"`
+
+	pattern *regexp.Regexp
+}
+
+// parseSpec parses specification and resolves references of parameters and schemas
+func parseSpec(doc string) (*apiSpec, error) {
+	var spec apiSpec
+
+	if err := json.Unmarshal([]byte(doc), &spec); err != nil {
+		return nil, err
+	}
+
+	for path, ops := range spec.Paths {
+		byMethod := make(map[string]*operation, len(ops))
+
+		for method, op := range ops {
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					ref, ok := spec.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+					if !ok {
+						return nil, errors.New("unknown parameter reference", j.KV("ref", p.Ref))
+					}
+
+					p = ref
+				}
+
+				var err error
+
+				if p.Schema, err = spec.resolve(p.Schema); err != nil {
+					return nil, errors.Wrap(err, "invalid parameter schema", j.KV("parameter", p.Name))
+				}
+
+				op.Parameters[i] = p
+			}
+
+			if op.RequestBody != nil {
+				for mt, content := range op.RequestBody.Content {
+					var err error
+
+					if content.Schema, err = spec.resolve(content.Schema); err != nil {
+						return nil, errors.Wrap(err, "invalid request body schema", j.KV("operation", op.OperationID))
+					}
+
+					op.RequestBody.Content[mt] = content
+				}
+			}
+
+			byMethod[strings.ToUpper(method)] = op
+		}
+
+		spec.Paths[path] = byMethod
+	}
+
+	return &spec, nil
+}
+
+// resolve returns schema with resolved references and compiled patterns, schema of any value is returned for nil
+func (s *apiSpec) resolve(sch *schema) (*schema, error) {
+	if sch == nil {
+		return &schema{}, nil
+	}
+
+	if sch.Ref != "" {
+		ref, ok := s.Components.Schemas[strings.TrimPrefix(sch.Ref, "#/components/schemas/")]
+		if !ok {
+			return nil, errors.New("unknown schema reference", j.KV("ref", sch.Ref))
+		}
+
+		return s.resolve(ref)
+	}
+
+	ret := *sch
+
+	if ret.Pattern != "" {
+		var err error
+
+		if ret.pattern, err = regexp.Compile(ret.Pattern); err != nil {
+			return nil, errors.Wrap(err, "invalid pattern", j.KV("pattern", ret.Pattern))
+		}
+	}
+
+	if ret.Properties != nil {
+		ret.Properties = make(map[string]*schema, len(sch.Properties))
+
+		for name, prop := range sch.Properties {
+			var err error
+
+			if ret.Properties[name], err = s.resolve(prop); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ret.Items != nil {
+		var err error
+
+		if ret.Items, err = s.resolve(sch.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ret, nil
+}
+
+// operation returns operation of the path and method, path is relative to API version
+func (s *apiSpec) operation(path, method string) (*operation, error) {
+	op, ok := s.Paths[path][method]
+	if !ok {
+		return nil, errors.New("operation not described in specification", j.KV("path", path), j.KV("method", method))
+	}
+
+	return op, nil
+}
+
+// value returns value of the parameter in request, ok is false when parameter is not sent
+func (p parameter) value(r *http.Request) (string, bool) {
+	switch p.In {
+	case "header":
+		v := r.Header.Get(p.Name)
+		return v, v != ""
+	case "query":
+		vs, ok := r.URL.Query()[p.Name]
+		if !ok || len(vs) == 0 || vs[0] == "" {
+			return "", false
+		}
+
+		return vs[0], true
+	}
+
+	return "", false
+}
+
+// check returns description of the problem when value does not match the schema
+func (s *schema) check(value string) string {
+	var (
+		number float64
+		err    error
+	)
+
+	switch s.Type {
+	case "integer":
+		var i int
+
+		i, err = strconv.Atoi(value)
+		number = float64(i)
+	case "number":
+		number, err = strconv.ParseFloat(value, 64)
+	}
+
+	if err != nil {
+		return "must be " + s.Type
+	}
+
+	if min := s.Minimum; min != nil {
+		if s.ExclusiveMinimum && number <= *min {
+			return "must be greater than " + strconv.FormatFloat(*min, 'f', -1, 64)
+		}
+
+		if number < *min {
+			return "must not be less than " + strconv.FormatFloat(*min, 'f', -1, 64)
+		}
+	}
+
+	if max := s.Maximum; max != nil && number > *max {
+		return "must not be greater than " + strconv.FormatFloat(*max, 'f', -1, 64)
+	}
+
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		return "must match " + s.Pattern
+	}
+
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "must be RFC 3339 date-time"
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, v := range s.Enum {
+			if v == value {
+				return ""
+			}
+		}
+
+		return "must be one of " + strings.Join(s.Enum, ", ")
+	}
+
+	return ""
+}
+
+// fieldName returns name of the property of field, properties of the body are named without prefix
+func fieldName(field, property string) string {
+	if field == "" {
+		return property
+	}
+
+	return field + "." + property
+}
+
+// checkValue adds problems of decoded JSON value to verr, null value is treated as not sent
+func (s *schema) checkValue(field string, value interface{}, verr *ValidationError) {
+	if value == nil {
+		return
+	}
+
+	name := field
+	if name == "" {
+		name = "body"
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			verr.add(name, "must be object")
+			return
+		}
+
+		for _, property := range s.Required {
+			if _, ok := obj[property]; !ok {
+				verr.add(fieldName(field, property), "required property not defined in this request")
+			}
+		}
+
+		properties := make([]string, 0, len(s.Properties))
+		for property := range s.Properties {
+			properties = append(properties, property)
+		}
+
+		sort.Strings(properties)
+
+		for _, property := range properties {
+			s.Properties[property].checkValue(fieldName(field, property), obj[property], verr)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			verr.add(name, "must be array")
+			return
+		}
+
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.checkValue(field+"["+strconv.Itoa(i)+"]", item, verr)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			verr.add(name, "must be boolean")
+		}
+	case "number", "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			verr.add(name, "must be "+s.Type)
+			return
+		}
+
+		if msg := s.check(number.String()); msg != "" {
+			verr.add(name, msg)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			verr.add(name, "must be string")
+			return
+		}
+
+		if msg := s.check(str); msg != "" {
+			verr.add(name, msg)
+		}
+	}
+}
+
+// checkForm adds problems of form values to verr, values of object properties are checked as parameters
+func (s *schema) checkForm(values url.Values, verr *ValidationError) {
+	for _, property := range s.Required {
+		if values.Get(property) == "" {
+			verr.add(property, "required property not defined in this request")
+		}
+	}
+
+	properties := make([]string, 0, len(s.Properties))
+	for property := range s.Properties {
+		properties = append(properties, property)
+	}
+
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		if value := values.Get(property); value != "" {
+			if msg := s.Properties[property].check(value); msg != "" {
+				verr.add(property, msg)
+			}
+		}
+	}
+}
+
+// checkBody adds problems of request body to verr. Only bodies of single object are checked:
+// items of batch are checked one by one by its handler, so valid items are stored, and empty body
+// is left to the handler, because old cameras send registration in query string.
+func (b *requestBody) checkBody(r *http.Request, verr *ValidationError) error {
+	content, ok := b.Content[mediaType(r)]
+	if !ok || content.Schema.Type != "object" || r.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return fieldError("body", "unable read request body")
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	if !isJSON(r) {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return fieldError("body", "unable parse form")
+		}
+
+		for k, vs := range r.URL.Query() {
+			values[k] = append(values[k], vs...)
+		}
+
+		content.Schema.checkForm(values, verr)
+
+		return nil
+	}
+
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return fieldError("body", "unable parse json")
+	}
+
+	content.Schema.checkValue("", value, verr)
+
+	return nil
+}
+
+// validate checks request parameters and body against the operation before passing request to the handler
+func (op *operation) validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var verr ValidationError
+
+		for _, p := range op.Parameters {
+			value, ok := p.value(r)
+
+			switch {
+			case !ok && p.Required:
+				verr.add(p.Name, "required parameter not defined in this request")
+			case !ok:
+			default:
+				if msg := p.Schema.check(value); msg != "" {
+					verr.add(p.Name, msg)
+				}
+			}
+		}
+
+		if op.RequestBody != nil {
+			if err := op.RequestBody.checkBody(r, &verr); err != nil {
+				responseError(w, err)
+				return
+			}
+		}
+
+		if len(verr.Errors) > 0 {
+			responseError(w, &verr)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+// Package plate provides normalization and format validation of vehicle numbers
+package plate
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// DefaultRules are the formats of Belarusian vehicle numbers in normalized form:
+// "6048 EC-3" for cars, "AB 1234-5" for trailers and "1ABC 2345" for motorcycles and transit numbers
+const DefaultRules = "BY:^[0-9]{4}[ABEIKMHOPCTX]{2}[0-8]$ " +
+	"BY:^[ABEIKMHOPCTX]{2}[0-9]{4}[0-8]$ " +
+	"BY:^[0-9][ABEIKMHOPCTX]{3}[0-9]{4}$"
+
+// ErrUnknownFormat is returned when vehicle number does not match any format rule
+var ErrUnknownFormat = errors.New("unknown vehicle number format", errors.WithCode("unknown_plate_format"))
+
+// lookalikes maps Cyrillic letters to Latin letters with the same glyph
+var lookalikes = map[rune]rune{
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'І': 'I',
+}
+
+// Normalize changes letters to upper case, replaces Cyrillic letters with Latin lookalikes
+// and drops whitespaces and dashes, so "6048 ЕС-3" and "6048ec3" both become "6048EC3"
+func Normalize(raw string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.Is(unicode.Pd, r) {
+			return -1
+		}
+
+		r = unicode.ToUpper(r)
+
+		if l, ok := lookalikes[r]; ok {
+			return l
+		}
+
+		return r
+	}, raw)
+}
+
+type rule struct {
+	country string
+	pattern *regexp.Regexp
+}
+
+// Validator checks normalized vehicle numbers against per-country format rules
+type Validator struct {
+	rules []rule
+}
+
+// NewValidator parses whitespace separated rules in the "COUNTRY:REGEXP" form,
+// regular expressions are matched against normalized vehicle numbers
+func NewValidator(rules string) (*Validator, error) {
+	var v Validator
+
+	for _, r := range strings.Fields(rules) {
+		parts := strings.SplitN(r, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("invalid vehicle number rule", j.KV("rule", r))
+		}
+
+		pattern, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid vehicle number rule", j.KV("rule", r))
+		}
+
+		v.rules = append(v.rules, rule{country: parts[0], pattern: pattern})
+	}
+
+	return &v, nil
+}
+
+// Validate returns country of normalized vehicle number, validator without rules accepts any number
+func (v *Validator) Validate(normalized string) (string, error) {
+	if len(v.rules) == 0 {
+		return "", nil
+	}
+
+	for _, r := range v.rules {
+		if r.pattern.MatchString(normalized) {
+			return r.country, nil
+		}
+	}
+
+	return "", ErrUnknownFormat
+}
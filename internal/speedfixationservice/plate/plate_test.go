@@ -0,0 +1,57 @@
+package plate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, raw := range []string{"6048 EC-3", "6048ec3", "6048 ЕС-3", " 6048\tEc–3 "} {
+		require.Equal(t, "6048EC3", Normalize(raw), raw)
+	}
+}
+
+func TestValidator_Validate(t *testing.T) {
+	v, err := NewValidator(DefaultRules)
+	require.NoError(t, err)
+
+	tests := []struct {
+		number  string
+		country string
+		wantErr bool
+	}{
+		{number: "6048 EC-3", country: "BY"},
+		{number: "AB 1234-7", country: "BY"},
+		{number: "1ABC 2345", country: "BY"},
+		{number: "6048 EC-9", wantErr: true},
+		{number: "6048 ЯС-3", wantErr: true},
+		{number: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		country, err := v.Validate(Normalize(tt.number))
+		if tt.wantErr {
+			require.Error(t, err, tt.number)
+			continue
+		}
+
+		require.NoError(t, err, tt.number)
+		require.Equal(t, tt.country, country, tt.number)
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	_, err := NewValidator("BY")
+	require.Error(t, err)
+
+	_, err = NewValidator("BY:[")
+	require.Error(t, err)
+
+	v, err := NewValidator("")
+	require.NoError(t, err)
+
+	country, err := v.Validate("ANYTHING")
+	require.NoError(t, err)
+	require.Equal(t, "", country)
+}
@@ -0,0 +1,207 @@
+// Package platesearch provides wildcard and fuzzy matching of vehicle numbers tolerant to OCR errors
+package platesearch
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+)
+
+// DefaultConfusions is the list of character groups which cameras OCR usually confuses
+const DefaultConfusions = "0O,8B,1I,5S,2Z"
+
+// confusionCost is the cost of substitution of one character with confusable one
+const confusionCost = 0.5
+
+// ConfusionTable maps every confusable character to the representative of its group
+type ConfusionTable map[rune]rune
+
+// ParseConfusionTable parses comma separated groups of confusable characters, e.g. "0O,8B"
+func ParseConfusionTable(groups string) (ConfusionTable, error) {
+	ct := make(ConfusionTable)
+
+	for _, group := range strings.Split(groups, ",") {
+		chars := []rune(strings.ToUpper(strings.TrimSpace(group)))
+		if len(chars) == 0 {
+			continue
+		}
+
+		if len(chars) < 2 {
+			return nil, errors.New("confusion group must contain at least two characters")
+		}
+
+		for _, c := range chars {
+			ct[c] = chars[0]
+		}
+	}
+
+	return ct, nil
+}
+
+func (ct ConfusionTable) fold(r rune) rune {
+	if c, ok := ct[r]; ok {
+		return c
+	}
+
+	return r
+}
+
+// Query describes plate search criteria
+type Query struct {
+	// Pattern is a vehicle number, it may contain wildcards '?' for one character and '*' for any characters
+	Pattern string
+	// MaxDistance is the maximal edit distance between pattern and vehicle number
+	MaxDistance float64
+	// Limit is the maximal number of returned candidates, zero means no limit
+	Limit int
+	// Confusions is the table of characters confused by OCR
+	Confusions ConfusionTable
+}
+
+// Candidate is a vehicle number matched by query
+type Candidate struct {
+	VehicleNumber string
+	Distance      float64
+}
+
+// IsWildcard reports whether pattern contains wildcards
+func IsWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "?*")
+}
+
+// Search returns vehicle numbers matched by query ranked by distance
+func Search(q Query, vehicleNumbers []string) []Candidate {
+	var (
+		ret     []Candidate
+		pattern = plate.Normalize(q.Pattern)
+	)
+
+	for _, number := range vehicleNumbers {
+		if IsWildcard(pattern) {
+			if MatchWildcard(pattern, number, q.Confusions) {
+				ret = append(ret, Candidate{VehicleNumber: number})
+			}
+
+			continue
+		}
+
+		distance := Distance(pattern, number, q.Confusions)
+
+		// cameras often drop the region suffix, so the number is compared without it too
+		if !strings.Contains(q.Pattern, "-") {
+			if d := Distance(pattern, stripRegion(number), q.Confusions); d < distance {
+				distance = d
+			}
+		}
+
+		if distance <= q.MaxDistance {
+			ret = append(ret, Candidate{VehicleNumber: number, Distance: distance})
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Distance != ret[j].Distance {
+			return ret[i].Distance < ret[j].Distance
+		}
+
+		return ret[i].VehicleNumber < ret[j].VehicleNumber
+	})
+
+	if q.Limit > 0 && len(ret) > q.Limit {
+		ret = ret[:q.Limit]
+	}
+
+	return ret
+}
+
+// MatchWildcard reports whether vehicle number matches pattern with wildcards
+func MatchWildcard(pattern, vehicleNumber string, ct ConfusionTable) bool {
+	p, s := []rune(plate.Normalize(pattern)), []rune(plate.Normalize(vehicleNumber))
+
+	// match[i][j] reports whether p[:i] matches s[:j]
+	match := make([][]bool, len(p)+1)
+	for i := range match {
+		match[i] = make([]bool, len(s)+1)
+	}
+
+	match[0][0] = true
+
+	for i := 1; i <= len(p); i++ {
+		if p[i-1] == '*' {
+			match[i][0] = match[i-1][0]
+		}
+
+		for j := 1; j <= len(s); j++ {
+			switch p[i-1] {
+			case '*':
+				match[i][j] = match[i-1][j] || match[i][j-1]
+			case '?':
+				match[i][j] = match[i-1][j-1]
+			default:
+				match[i][j] = match[i-1][j-1] && ct.fold(p[i-1]) == ct.fold(s[j-1])
+			}
+		}
+	}
+
+	return match[len(p)][len(s)]
+}
+
+// Distance returns edit distance between two vehicle numbers where substitution
+// of confusable characters costs less than other edits
+func Distance(a, b string, ct ConfusionTable) float64 {
+	s, t := []rune(plate.Normalize(a)), []rune(plate.Normalize(b))
+
+	prev := make([]float64, len(t)+1)
+	cur := make([]float64, len(t)+1)
+
+	for j := range prev {
+		prev[j] = float64(j)
+	}
+
+	for i := 1; i <= len(s); i++ {
+		cur[0] = float64(i)
+
+		for j := 1; j <= len(t); j++ {
+			substitution := 1.0
+
+			switch {
+			case s[i-1] == t[j-1]:
+				substitution = 0
+			case ct.fold(s[i-1]) == ct.fold(t[j-1]):
+				substitution = confusionCost
+			}
+
+			cur[j] = minOf(prev[j]+1, cur[j-1]+1, prev[j-1]+substitution)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(t)]
+}
+
+func minOf(values ...float64) float64 {
+	ret := values[0]
+
+	for _, v := range values[1:] {
+		if v < ret {
+			ret = v
+		}
+	}
+
+	return ret
+}
+
+// stripRegion drops the region digit which ends normalized vehicle number
+func stripRegion(vehicleNumber string) string {
+	number := plate.Normalize(vehicleNumber)
+	if n := len(number); n > 0 && unicode.IsDigit(rune(number[n-1])) {
+		return number[:n-1]
+	}
+
+	return number
+}
@@ -0,0 +1,67 @@
+package platesearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var vehicleNumbers = []string{"6048 EC-3", "6048 EE-3", "0003 AE-3", "8911 EE-3", "6O48 EC-7"}
+
+func TestParseConfusionTable(t *testing.T) {
+	ct, err := ParseConfusionTable("0O, 8b")
+	require.NoError(t, err)
+	require.Equal(t, ConfusionTable{'0': '0', 'O': '0', '8': '8', 'B': '8'}, ct)
+
+	_, err = ParseConfusionTable("0O,8")
+	require.Error(t, err)
+}
+
+func TestMatchWildcard(t *testing.T) {
+	ct, err := ParseConfusionTable(DefaultConfusions)
+	require.NoError(t, err)
+
+	tests := []struct {
+		pattern string
+		number  string
+		want    bool
+	}{
+		{pattern: "6048 E?-3", number: "6048 EC-3", want: true},
+		{pattern: "6048 E?-3", number: "6048 EC-7", want: false},
+		{pattern: "*EC-3", number: "6048 EC-3", want: true},
+		{pattern: "*ec-3", number: "6048 EC-3", want: true},
+		{pattern: "6O48*", number: "6048 EC-3", want: true},
+		{pattern: "6048*", number: "0003 AE-3", want: false},
+		{pattern: "*", number: "", want: true},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, MatchWildcard(tt.pattern, tt.number, ct), "%q ~ %q", tt.pattern, tt.number)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	ct, err := ParseConfusionTable(DefaultConfusions)
+	require.NoError(t, err)
+
+	require.Equal(t, 0.0, Distance("6048 EC-3", "6048ec-3", ct))
+	require.Equal(t, confusionCost, Distance("6O48 EC-3", "6048 EC-3", ct))
+	require.Equal(t, 2*confusionCost, Distance("6O4B EC-3", "6048 EC-3", ct))
+	require.Equal(t, 1.0, Distance("6048 EE-3", "6048 EC-3", ct))
+	require.Equal(t, 1.0, Distance("6048 EC", "6048 EC-3", ct))
+	require.Equal(t, 0.0, Distance("6048 ЕС-3", "6048 EC-3", ct))
+}
+
+func TestSearch(t *testing.T) {
+	ct, err := ParseConfusionTable(DefaultConfusions)
+	require.NoError(t, err)
+
+	got := Search(Query{Pattern: "6O48 EC", MaxDistance: 1, Confusions: ct}, vehicleNumbers)
+	require.Equal(t, []Candidate{
+		{VehicleNumber: "6O48 EC-7", Distance: 0},
+		{VehicleNumber: "6048 EC-3", Distance: confusionCost},
+	}, got)
+
+	got = Search(Query{Pattern: "*EE-3", Limit: 1, Confusions: ct}, vehicleNumbers)
+	require.Equal(t, []Candidate{{VehicleNumber: "6048 EE-3"}}, got)
+}
@@ -0,0 +1,151 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/ratelimit"
+)
+
+// clientKey returns the key of rate limit budget: authenticated camera, token subject or address of client
+func clientKey(ctx context.Context, remoteAddr string) string {
+	if camera := authenticatedCamera(ctx); camera != "" {
+		return "camera:" + camera
+	}
+
+	if claims, ok := ctx.Value(claimsKey{}).(jwt.Claims); ok && claims.Subject != "" {
+		return "user:" + claims.Subject
+	}
+
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return "ip:" + host
+	}
+
+	return "ip:" + remoteAddr
+}
+
+// ingestionKey returns the key of ingestion budget. It is checked before the camera is authenticated,
+// so the camera named by client is paired with client address, and client naming other camera
+// does not spend the budget of that camera.
+func ingestionKey(camera, remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	if camera == "" {
+		return "ip:" + host
+	}
+
+	return "camera:" + camera + "@" + host
+}
+
+// requestCamera returns camera named by subject of client certificate or by camera header,
+// the camera is not authenticated yet
+func requestCamera(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	return r.Header.Get(camauth.CameraHeader)
+}
+
+// callCameraKey returns the key of ingestion budget of gRPC call with camera named in context
+func callCameraKey(ctx context.Context, addr string) string {
+	return ingestionKey(authenticatedCamera(ctx), addr)
+}
+
+// rateLimit answers 429 with Retry-After when client spent its budget
+func (srv *service) rateLimit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return srv.limitRequests(limiter, func(r *http.Request) string {
+		return clientKey(r.Context(), r.RemoteAddr)
+	}, next)
+}
+
+// ingestionLimit answers 429 to registrations before their body is read and their signature is verified
+func (srv *service) ingestionLimit(next http.Handler) http.Handler {
+	return srv.limitRequests(srv.ingestionLimits, func(r *http.Request) string {
+		return ingestionKey(requestCamera(r), r.RemoteAddr)
+	}, next)
+}
+
+// limitRequests answers 429 with Retry-After when client named by key spent its budget
+func (srv *service) limitRequests(limiter *ratelimit.Limiter, key func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retry := limiter.Allow(key(r), srv.now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			responseError(w, errRateLimited)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody rejects requests with body larger than maxBodySize, zero size does not limit bodies
+func (srv *service) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.maxBodySize <= 0 || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > srv.maxBodySize {
+			responseError(w, errBodyTooLarge)
+			return
+		}
+
+		// body without length is read to know its size, registration middlewares keep it in memory anyway
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, srv.maxBodySize+1))
+		if err != nil {
+			responseError(w, fieldError("body", "unable read request body"))
+			return
+		}
+
+		if int64(len(body)) > srv.maxBodySize {
+			responseError(w, errBodyTooLarge)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowCall checks rate limit of gRPC client named by key
+func (srv *service) allowCall(ctx context.Context, limiter *ratelimit.Limiter,
+	key func(ctx context.Context, addr string) string) error {
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+
+	if ok, retry := limiter.Allow(key(ctx, addr), srv.now()); !ok {
+		return status.Errorf(codes.ResourceExhausted, "%v, retry after %v", errRateLimited.Error(), retry.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+func (srv service) rateLimitStats(w http.ResponseWriter, _ *http.Request) {
+	makeResponse(w, map[string]ratelimit.Stats{
+		"ingestion": srv.ingestionLimits.Stats(),
+		"query":     srv.queryLimits.Stats(),
+	})
+}
@@ -0,0 +1,126 @@
+// Package ratelimit provides token bucket rate limiting of clients
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Config is the budget of every client, client spends one token per request and gets Rate tokens
+// per second up to Burst
+type Config struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Stats are counters of limiter, Clients are throttled requests by key of client which was active recently
+type Stats struct {
+	Allowed   uint64            `json:"allowed"`
+	Throttled uint64            `json:"throttled"`
+	Clients   map[string]uint64 `json:"clients"`
+}
+
+// Limiter keeps token bucket of every client
+type Limiter struct {
+	config Config
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	swept     time.Time
+	allowed   uint64
+	throttled uint64
+	clients   map[string]uint64
+}
+
+// NewLimiter creates limiter, nil limiter is returned when rate is not positive, it allows everything
+func NewLimiter(config Config) *Limiter {
+	if config.Rate <= 0 {
+		return nil
+	}
+
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+
+	return &Limiter{config: config, buckets: make(map[string]*bucket), clients: make(map[string]uint64)}
+}
+
+// full is the time in which empty bucket is filled
+func (l *Limiter) full() time.Duration {
+	return time.Duration(float64(l.config.Burst) / l.config.Rate * float64(time.Second))
+}
+
+// sweep drops buckets which are full, they are the same as missing ones,
+// counters of idle clients are dropped with them
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.full() {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.full() {
+			delete(l.buckets, key)
+			delete(l.clients, key)
+		}
+	}
+
+	l.swept = now
+}
+
+// Allow takes token of client, when bucket is empty it returns false and time after which token is available
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.config.Burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.config.Burst), b.tokens+elapsed*l.config.Rate)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		l.allowed++
+
+		return true, 0
+	}
+
+	l.throttled++
+	l.clients[key]++
+
+	return false, time.Duration((1 - b.tokens) / l.config.Rate * float64(time.Second))
+}
+
+// Stats returns counters of limiter
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{Clients: map[string]uint64{}}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	clients := make(map[string]uint64, len(l.clients))
+	for key, n := range l.clients {
+		clients[key] = n
+	}
+
+	return Stats{Allowed: l.allowed, Throttled: l.throttled, Clients: clients}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Config{Rate: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("C12", now)
+		require.True(t, ok)
+	}
+
+	ok, retry := l.Allow("C12", now)
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retry)
+
+	// clients have separate buckets
+	ok, _ = l.Allow("C14", now)
+	require.True(t, ok)
+
+	ok, _ = l.Allow("C12", now.Add(500*time.Millisecond))
+	require.True(t, ok)
+
+	ok, retry = l.Allow("C12", now.Add(750*time.Millisecond))
+	require.False(t, ok)
+	require.Equal(t, 250*time.Millisecond, retry)
+
+	require.Equal(t, Stats{Allowed: 5, Throttled: 2, Clients: map[string]uint64{"C12": 2}}, l.Stats())
+
+	// full buckets are dropped
+	ok, _ = l.Allow("C14", now.Add(time.Hour))
+	require.True(t, ok)
+	require.Len(t, l.buckets, 1)
+	require.Equal(t, Stats{Allowed: 6, Throttled: 2, Clients: map[string]uint64{}}, l.Stats())
+
+	disabled := NewLimiter(Config{})
+
+	ok, _ = disabled.Allow("C12", now)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), disabled.Stats().Throttled)
+}
@@ -0,0 +1,255 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// auditLayout is the layout of audit file names, files are rotated daily
+const auditLayout = "2006-01-02"
+
+// AuditEntry records one access to data
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// User is the subject of token, it is empty when the request is not authenticated
+	User  string   `json:"user"`
+	Roles []string `json:"roles,omitempty"`
+	// Method is HTTP method or GRPC for gRPC calls
+	Method string              `json:"method"`
+	Path   string              `json:"path"`
+	Params map[string][]string `json:"params,omitempty"`
+	// Plates are normalized vehicle numbers looked up by request
+	Plates []string `json:"plates,omitempty"`
+	// Status is HTTP status or gRPC code for gRPC calls
+	Status     int    `json:"status"`
+	Records    int    `json:"records"`
+	RequestID  string `json:"request_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// AuditConditions describes search criteria of audit entries, zero values match everything
+type AuditConditions struct {
+	User  string    `json:"user,omitempty"`
+	Plate string    `json:"plate,omitempty"`
+	From  time.Time `json:"from,omitempty"`
+	To    time.Time `json:"to,omitempty"`
+}
+
+// AuditRepo represent the append-only storage of audit log
+type AuditRepo interface {
+	Append(AuditEntry) error
+	LookUp(AuditConditions) ([]AuditEntry, error)
+}
+
+type auditRepo struct {
+	storage   string
+	retention time.Duration
+	clock     clock.Clock
+
+	mu sync.Mutex
+	// cleaned is the day of the last removal of expired files
+	cleaned string
+}
+
+// NewTestAuditRepository will create an object that represent the AuditRepo interface for testing
+func NewTestAuditRepository(tempDir string, retention time.Duration, clk clock.Clock) AuditRepo {
+	return &auditRepo{storage: tempDir, retention: retention, clock: clk}
+}
+
+// NewAuditRepository will create an object that represent the AuditRepo interface, the log is kept
+// in its own directory apart from fixations and its files are removed after retention
+func NewAuditRepository(storage string, retention time.Duration, clk clock.Clock) (AuditRepo, error) {
+	if err := os.MkdirAll(storage, 0700); err != nil {
+		return nil, err
+	}
+
+	return &auditRepo{storage: storage, retention: retention, clock: clk}, nil
+}
+
+// clean removes files of days older than retention, it runs once a day
+func (ar *auditRepo) clean(now time.Time) error {
+	day := now.UTC().Format(auditLayout)
+	if ar.cleaned == day {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(ar.storage)
+	if err != nil {
+		return err
+	}
+
+	oldest := now.UTC().Add(-ar.retention).Format(auditLayout)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".log")
+		if _, err := time.Parse(auditLayout, name); err != nil || name >= oldest {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(ar.storage, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	ar.cleaned = day
+
+	return nil
+}
+
+func (ar *auditRepo) Append(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if err := ar.clean(ar.clock.Now()); err != nil {
+		return err
+	}
+
+	path := filepath.Join(ar.storage, entry.Time.UTC().Format(auditLayout)+".log")
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// line cut by crash is terminated, so it does not swallow the entry
+	if cut, err := unterminated(file); err != nil {
+		_ = file.Close()
+		return err
+	} else if cut {
+		data = append([]byte{'\n'}, data...)
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// unterminated reports whether the last line of file has no line feed
+func unterminated(file *os.File) (bool, error) {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+
+	return last[0] != '\n', nil
+}
+
+func (c AuditConditions) match(entry AuditEntry) bool {
+	switch {
+	case c.User != "" && entry.User != c.User:
+		return false
+	case !c.From.IsZero() && entry.Time.Before(c.From):
+		return false
+	case !c.To.IsZero() && entry.Time.After(c.To):
+		return false
+	case c.Plate == "":
+		return true
+	}
+
+	number := plate.Normalize(c.Plate)
+
+	for _, p := range entry.Plates {
+		if p == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ar *auditRepo) LookUp(conditions AuditConditions) ([]AuditEntry, error) {
+	files, err := ioutil.ReadDir(ar.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]AuditEntry, 0)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".log")
+
+		day, err := time.Parse(auditLayout, name)
+		if err != nil {
+			continue
+		}
+
+		if (!conditions.From.IsZero() && day.AddDate(0, 0, 1).Before(conditions.From)) ||
+			(!conditions.To.IsZero() && day.After(conditions.To)) {
+			continue
+		}
+
+		if err := ar.read(filepath.Join(ar.storage, file.Name()), conditions, &ret); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret, nil
+}
+
+func (ar *auditRepo) read(path string, conditions AuditConditions, ret *[]AuditEntry) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var entry AuditEntry
+
+		// the last line can be cut by crash during append, it is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if conditions.match(entry) {
+			*ret = append(*ret, entry)
+		}
+	}
+
+	return scanner.Err()
+}
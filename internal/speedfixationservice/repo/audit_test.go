@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func Test_auditRepo(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	var (
+		now = time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+		clk = clock.NewFake(now)
+		ar  = NewTestAuditRepository(tempDir, 72*time.Hour, clk)
+	)
+
+	entries := []AuditEntry{
+		{Time: now.Add(-50 * time.Hour), User: "alice", Method: "GET", Path: "/search", Status: 200, Records: 3},
+		{Time: now.Add(-time.Hour), User: "bob", Method: "GET", Path: "/platesearch", Plates: []string{"6048EC3"}, Status: 200, Records: 1},
+		{Time: now, User: "alice", Method: "GRPC", Path: "/speedcontrol.v1.SpeedControl/Query", Status: 0},
+	}
+
+	// entries are appended in any order, look up returns them by time
+	for _, i := range []int{2, 0, 1} {
+		require.NoError(t, ar.Append(entries[i]))
+	}
+
+	// line cut by crash is skipped
+	file, err := os.OpenFile(filepath.Join(tempDir, now.Format(auditLayout)+".log"), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"time":"`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	got, err := ar.LookUp(AuditConditions{User: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, []AuditEntry{entries[0], entries[2]}, got)
+
+	got, err = ar.LookUp(AuditConditions{Plate: "6048 EC-3"})
+	require.NoError(t, err)
+	require.Equal(t, entries[1:2], got)
+
+	got, err = ar.LookUp(AuditConditions{From: now.Add(-2 * time.Hour), To: now.Add(-time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, entries[1:2], got)
+
+	// files older than retention are removed by the first append of a day
+	old := filepath.Join(tempDir, now.Add(-100*time.Hour).Format(auditLayout)+".log")
+	require.NoError(t, ioutil.WriteFile(old, []byte("{}\n"), 0600))
+
+	ar = NewTestAuditRepository(tempDir, 72*time.Hour, clk)
+	require.NoError(t, ar.Append(AuditEntry{Time: now, User: "carol"}))
+
+	_, err = os.Stat(old)
+	require.True(t, os.IsNotExist(err))
+
+	got, err = ar.LookUp(AuditConditions{})
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+}
@@ -0,0 +1,234 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+)
+
+const camerasFile = "cameras.json"
+
+// CameraKey is the secret used by camera to sign requests
+type CameraKey struct {
+	ID      string    `json:"id"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+	// Expires is set when key is rotated, the old key works till this time
+	Expires time.Time `json:"expires,omitempty"`
+	Revoked time.Time `json:"revoked,omitempty"`
+}
+
+// Active reports whether the key can be used at the moment
+func (k CameraKey) Active(now time.Time) bool {
+	return k.Revoked.IsZero() && (k.Expires.IsZero() || now.Before(k.Expires))
+}
+
+// CameraPublicKey is the Ed25519 public key which verifies fixations signed by camera
+type CameraPublicKey struct {
+	ID      string    `json:"id"`
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	Revoked time.Time `json:"revoked,omitempty"`
+}
+
+// Camera is the registered camera with its keys
+type Camera struct {
+	ID         string            `json:"id"`
+	Keys       []CameraKey       `json:"keys"`
+	PublicKeys []CameraPublicKey `json:"public_keys,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// CameraRepo represent the storage of registered cameras
+type CameraRepo interface {
+	// SaveCamera creates camera or replaces stored one
+	SaveCamera(Camera) error
+	// UpdateCamera changes camera by update and saves it, the changes of cameras are serialized,
+	// so concurrent ones are not lost. Missing camera is passed with ID only, nothing is saved
+	// when update fails.
+	UpdateCamera(id string, update func(camera *Camera) error) (Camera, error)
+	GetCamera(id string) (Camera, error)
+	Cameras() ([]Camera, error)
+}
+
+type cameraRepo struct {
+	path string
+
+	mu      sync.Mutex
+	once    sync.Once
+	loadErr error
+	cameras map[string]Camera
+}
+
+// NewTestCameraRepository will create an object that represent the CameraRepo interface for testing
+func NewTestCameraRepository(tempDir string) CameraRepo {
+	return newCameraRepo(tempDir)
+}
+
+// NewCameraRepository will create an object that represent the CameraRepo interface
+func NewCameraRepository() CameraRepo {
+	return newCameraRepo(filepath.Join("internal", "speedfixationservice", "data"))
+}
+
+func newCameraRepo(storage string) *cameraRepo {
+	return &cameraRepo{
+		path:    filepath.Join(storage, camerasFile),
+		cameras: make(map[string]Camera),
+	}
+}
+
+func (cr *cameraRepo) load() error {
+	cr.once.Do(func() {
+		cr.mu.Lock()
+		defer cr.mu.Unlock()
+
+		data, err := ioutil.ReadFile(cr.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+
+		if err != nil {
+			cr.loadErr = err
+			return
+		}
+
+		var cameras []Camera
+
+		if cr.loadErr = json.Unmarshal(data, &cameras); cr.loadErr != nil {
+			return
+		}
+
+		for _, camera := range cameras {
+			cr.cameras[camera.ID] = camera
+		}
+	})
+
+	return cr.loadErr
+}
+
+// list returns cameras ordered by ID
+func (cr *cameraRepo) list() []Camera {
+	ret := make([]Camera, 0, len(cr.cameras))
+	for _, camera := range cr.cameras {
+		ret = append(ret, camera)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+
+	return ret
+}
+
+func (cr *cameraRepo) SaveCamera(camera Camera) error {
+	if err := cr.load(); err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.save(camera)
+}
+
+// save stores camera in memory and in the file, it must be called under the lock
+func (cr *cameraRepo) save(camera Camera) error {
+	prev, existed := cr.cameras[camera.ID]
+	cr.cameras[camera.ID] = camera
+
+	data, err := json.Marshal(cr.list())
+	if err == nil {
+		// the file keeps secrets, so only the service user can read it
+		err = ioutil.WriteFile(cr.path+".tmp", data, 0600)
+	}
+
+	if err == nil {
+		err = os.Rename(cr.path+".tmp", cr.path)
+	}
+
+	if err != nil {
+		if existed {
+			cr.cameras[camera.ID] = prev
+		} else {
+			delete(cr.cameras, camera.ID)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (cr *cameraRepo) UpdateCamera(id string, update func(camera *Camera) error) (Camera, error) {
+	if err := cr.load(); err != nil {
+		return Camera{}, err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	camera, ok := cr.get(id)
+	if !ok {
+		camera = Camera{ID: id}
+	}
+
+	if err := update(&camera); err != nil {
+		return Camera{}, err
+	}
+
+	camera.ID = id
+
+	if err := cr.save(camera); err != nil {
+		return Camera{}, err
+	}
+
+	return camera, nil
+}
+
+func (cr *cameraRepo) GetCamera(id string) (Camera, error) {
+	if err := cr.load(); err != nil {
+		return Camera{}, err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	camera, ok := cr.get(id)
+	if !ok {
+		return Camera{}, ErrNotFound
+	}
+
+	return camera, nil
+}
+
+// get returns copy of stored camera, it must be called under the lock
+func (cr *cameraRepo) get(id string) (Camera, bool) {
+	camera, ok := cr.cameras[id]
+	if !ok {
+		return Camera{}, false
+	}
+
+	// keys are copied, so changes of returned camera do not touch the stored one before it is saved
+	camera.Keys = append([]CameraKey(nil), camera.Keys...)
+	camera.PublicKeys = append([]CameraPublicKey(nil), camera.PublicKeys...)
+
+	return camera, true
+}
+
+func (cr *cameraRepo) Cameras() ([]Camera, error) {
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.list(), nil
+}
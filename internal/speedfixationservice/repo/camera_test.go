@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_cameraRepo(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	cr := NewTestCameraRepository(tempDir)
+
+	_, err := cr.GetCamera("C12")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	camera := Camera{ID: "C12", Created: now, Keys: []CameraKey{{ID: "k1", Secret: "s1", Created: now}}}
+	require.NoError(t, cr.SaveCamera(camera))
+	require.NoError(t, cr.SaveCamera(Camera{ID: "A1", Created: now}))
+
+	// cameras are read from file after restart
+	cr = NewTestCameraRepository(tempDir)
+
+	got, err := cr.GetCamera("C12")
+	require.NoError(t, err)
+	require.Equal(t, camera, got)
+
+	cameras, err := cr.Cameras()
+	require.NoError(t, err)
+	require.Len(t, cameras, 2)
+	require.Equal(t, "A1", cameras[0].ID)
+
+	require.True(t, camera.Keys[0].Active(now))
+	camera.Keys[0].Expires = now.Add(-time.Second)
+	require.False(t, camera.Keys[0].Active(now))
+}
+
+func Test_cameraRepo_UpdateCamera(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	cr := NewTestCameraRepository(tempDir)
+
+	// concurrent changes of the same camera are not lost
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := cr.UpdateCamera("C12", func(camera *Camera) error {
+				if i%2 == 0 {
+					camera.Keys = append(camera.Keys, CameraKey{ID: strconv.Itoa(i)})
+				} else {
+					camera.PublicKeys = append(camera.PublicKeys, CameraPublicKey{ID: strconv.Itoa(i)})
+				}
+
+				return nil
+			})
+			require.NoError(t, err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	camera, err := NewTestCameraRepository(tempDir).GetCamera("C12")
+	require.NoError(t, err)
+	require.Len(t, camera.Keys, 10)
+	require.Len(t, camera.PublicKeys, 10)
+
+	// failed update changes nothing
+	_, err = cr.UpdateCamera("C12", func(camera *Camera) error {
+		camera.Keys = nil
+		return ErrNotFound
+	})
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = cr.UpdateCamera("C14", func(camera *Camera) error {
+		return ErrNotFound
+	})
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	got, err := cr.GetCamera("C12")
+	require.NoError(t, err)
+	require.Equal(t, camera, got)
+
+	_, err = cr.GetCamera("C14")
+	require.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,283 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+const deadLetterFile = "deadletters.log"
+
+// ErrNotFound is returned when requested record does not exist
+var ErrNotFound = errors.New("record not found", errors.WithCode("not_found"))
+
+// DeadLetter is the rejected registration request kept for diagnostics and replay
+type DeadLetter struct {
+	ID          string          `json:"id"`
+	Received    time.Time       `json:"received"`
+	RemoteAddr  string          `json:"remote_addr,omitempty"`
+	Camera      string          `json:"camera,omitempty"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"content_type,omitempty"`
+	Payload     string          `json:"payload"`
+	Status      int             `json:"status"`
+	Reason      json.RawMessage `json:"reason,omitempty"`
+}
+
+// DeadLetterConditions describes search criteria of dead letters, zero values match everything
+type DeadLetterConditions struct {
+	From   time.Time `json:"from,omitempty"`
+	To     time.Time `json:"to,omitempty"`
+	Camera string    `json:"camera,omitempty"`
+}
+
+// DeadLetterRepo represent the storage of rejected registration requests
+type DeadLetterRepo interface {
+	Add(DeadLetter) (DeadLetter, error)
+	LookUp(DeadLetterConditions) ([]DeadLetter, error)
+	Get(id string) (DeadLetter, error)
+	Delete(id string) error
+}
+
+type deadLetterRepo struct {
+	path      string
+	retention time.Duration
+	maxCount  int
+	clock     clock.Clock
+
+	mu sync.Mutex
+	// loaded is set when the file is read, failed load is retried by the next call
+	loaded  bool
+	letters []DeadLetter
+}
+
+// NewTestDeadLetterRepository will create an object that represent the DeadLetterRepo interface for testing
+func NewTestDeadLetterRepository(tempDir string, retention time.Duration, maxCount int, clk clock.Clock) DeadLetterRepo {
+	return newDeadLetterRepo(tempDir, retention, maxCount, clk)
+}
+
+// NewDeadLetterRepository will create an object that represent the DeadLetterRepo interface,
+// letters are kept for retention and no more than maxCount newest letters are kept
+func NewDeadLetterRepository(retention time.Duration, maxCount int, clk clock.Clock) DeadLetterRepo {
+	return newDeadLetterRepo(filepath.Join("internal", "speedfixationservice", "data"), retention, maxCount, clk)
+}
+
+func newDeadLetterRepo(storage string, retention time.Duration, maxCount int, clk clock.Clock) *deadLetterRepo {
+	return &deadLetterRepo{
+		path:      filepath.Join(storage, deadLetterFile),
+		retention: retention,
+		maxCount:  maxCount,
+		clock:     clk,
+	}
+}
+
+func (dl *deadLetterRepo) load() error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	if dl.loaded {
+		return nil
+	}
+
+	dl.letters = nil
+
+	if err := dl.read(); err != nil {
+		return err
+	}
+
+	// compaction also drops torn last line, so the next append starts a new line
+	if err := dl.compact(); err != nil {
+		return err
+	}
+
+	dl.loaded = true
+
+	return nil
+}
+
+func (dl *deadLetterRepo) read() error {
+	return readLines(dl.path, func(line []byte) error {
+		var letter DeadLetter
+
+		if err := json.Unmarshal(line, &letter); err != nil {
+			return err
+		}
+
+		dl.letters = append(dl.letters, letter)
+
+		return nil
+	})
+}
+
+// compact drops letters exceeding retention limits and rewrites the file
+func (dl *deadLetterRepo) compact() error {
+	var (
+		kept   = dl.letters[:0]
+		oldest = dl.clock.Now().Add(-dl.retention)
+	)
+
+	for _, letter := range dl.letters {
+		if letter.Received.After(oldest) {
+			kept = append(kept, letter)
+		}
+	}
+
+	if dl.maxCount > 0 && len(kept) > dl.maxCount {
+		kept = kept[len(kept)-dl.maxCount:]
+	}
+
+	dl.letters = kept
+
+	return dl.rewrite()
+}
+
+func (dl *deadLetterRepo) rewrite() error {
+	tmp := dl.path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+
+	for _, letter := range dl.letters {
+		if err := encoder.Encode(letter); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dl.path)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (dl *deadLetterRepo) Add(letter DeadLetter) (DeadLetter, error) {
+	var err error
+
+	if err = dl.load(); err != nil {
+		return DeadLetter{}, err
+	}
+
+	if letter.ID, err = newID(); err != nil {
+		return DeadLetter{}, err
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	file, err := os.OpenFile(dl.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if err = json.NewEncoder(file).Encode(letter); err != nil {
+		return DeadLetter{}, err
+	}
+
+	dl.letters = append(dl.letters, letter)
+
+	// the file is compacted when it exceeds the limit by a tenth, so it is not rewritten on every add
+	if dl.maxCount > 0 && len(dl.letters) > dl.maxCount+dl.maxCount/10 {
+		if err = dl.compact(); err != nil {
+			return DeadLetter{}, err
+		}
+	}
+
+	return letter, nil
+}
+
+func (dl *deadLetterRepo) LookUp(conditions DeadLetterConditions) ([]DeadLetter, error) {
+	if err := dl.load(); err != nil {
+		return nil, err
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	var (
+		ret    []DeadLetter
+		oldest = dl.clock.Now().Add(-dl.retention)
+	)
+
+	for _, letter := range dl.letters {
+		switch {
+		case !letter.Received.After(oldest):
+		case !conditions.From.IsZero() && letter.Received.Before(conditions.From):
+		case !conditions.To.IsZero() && letter.Received.After(conditions.To):
+		case conditions.Camera != "" && letter.Camera != conditions.Camera:
+		default:
+			ret = append(ret, letter)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Received.Before(ret[j].Received)
+	})
+
+	return ret, nil
+}
+
+func (dl *deadLetterRepo) Get(id string) (DeadLetter, error) {
+	if err := dl.load(); err != nil {
+		return DeadLetter{}, err
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	for _, letter := range dl.letters {
+		if letter.ID == id {
+			return letter, nil
+		}
+	}
+
+	return DeadLetter{}, ErrNotFound
+}
+
+func (dl *deadLetterRepo) Delete(id string) error {
+	if err := dl.load(); err != nil {
+		return err
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	for i, letter := range dl.letters {
+		if letter.ID == id {
+			dl.letters = append(dl.letters[:i], dl.letters[i+1:]...)
+			return dl.rewrite()
+		}
+	}
+
+	return ErrNotFound
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func Test_deadLetterRepo(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	var (
+		clk = clock.NewFake(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+		dl  = NewTestDeadLetterRepository(tempDir, time.Hour, 10, clk)
+	)
+
+	var letters []DeadLetter
+
+	for i, camera := range []string{"C12", "C14", "C12"} {
+		letter, err := dl.Add(DeadLetter{
+			Received: clk.Now().Add(time.Duration(i-3) * time.Minute),
+			Camera:   camera,
+			Path:     "/register",
+			Payload:  "speed=abc",
+			Status:   400,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, letter.ID)
+
+		letters = append(letters, letter)
+	}
+
+	_, err := dl.Add(DeadLetter{Received: clk.Now().Add(-2 * time.Hour), Camera: "C12"})
+	require.NoError(t, err)
+
+	got, err := dl.LookUp(DeadLetterConditions{Camera: "C12"})
+	require.NoError(t, err)
+	require.Equal(t, []DeadLetter{letters[0], letters[2]}, got)
+
+	require.NoError(t, dl.Delete(letters[0].ID))
+	require.True(t, errors.Is(dl.Delete(letters[0].ID), ErrNotFound))
+
+	// after restart expired letters and letters over the limit are dropped
+	dl = NewTestDeadLetterRepository(tempDir, time.Hour, 1, clk)
+
+	got, err = dl.LookUp(DeadLetterConditions{})
+	require.NoError(t, err)
+	require.Equal(t, []DeadLetter{letters[2]}, got)
+
+	letter, err := dl.Get(letters[2].ID)
+	require.NoError(t, err)
+	require.Equal(t, letters[2], letter)
+
+	_, err = dl.Get(letters[1].ID)
+	require.True(t, errors.Is(err, ErrNotFound))
+}
+
+func Test_deadLetterRepo_TornLine(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	var (
+		clk = clock.NewFake(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+		dl  = NewTestDeadLetterRepository(tempDir, time.Hour, 10, clk)
+	)
+
+	// file which can not be read fails load, the failure is not remembered
+	path := filepath.Join(tempDir, deadLetterFile)
+	require.NoError(t, os.Mkdir(path, 0700))
+
+	_, err := dl.LookUp(DeadLetterConditions{})
+	require.Error(t, err)
+
+	require.NoError(t, os.Remove(path))
+
+	first, err := dl.Add(DeadLetter{Received: clk.Now(), Camera: "C12", Path: "/register", Status: 400})
+	require.NoError(t, err)
+
+	// crash during append cuts the last line, it is skipped and dropped by compaction
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	dl = NewTestDeadLetterRepository(tempDir, time.Hour, 10, clk)
+
+	second, err := dl.Add(DeadLetter{Received: clk.Now(), Camera: "C14", Path: "/register", Status: 400})
+	require.NoError(t, err)
+
+	got, err := NewTestDeadLetterRepository(tempDir, time.Hour, 10, clk).LookUp(DeadLetterConditions{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []DeadLetter{first, second}, got)
+
+	// broken line in the middle of the file is not skipped
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, append([]byte("{\"id\":\n"), data...), 0644))
+
+	_, err = NewTestDeadLetterRepository(tempDir, time.Hour, 10, clk).LookUp(DeadLetterConditions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,244 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+const idempotencyFile = "idempotency.log"
+
+// ErrKeyInProgress is returned when request with the same idempotency key is being processed
+var ErrKeyInProgress = errors.New("request with this idempotency key is in progress", errors.WithCode("key_in_progress"))
+
+// StoredResponse is the response of request made with idempotency key
+type StoredResponse struct {
+	Key         string          `json:"key"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body"`
+	Created     time.Time       `json:"created"`
+	// RequestHash is the hash of request which got the response, retries with other requests are rejected
+	RequestHash string `json:"request_hash,omitempty"`
+}
+
+// IdempotencyRepo represent the storage of responses of requests made with idempotency keys
+type IdempotencyRepo interface {
+	// Reserve returns stored response of the key or marks key as being processed when the key is not seen yet
+	Reserve(key string) (*StoredResponse, error)
+	// Save stores response and finishes processing of its key
+	Save(StoredResponse) error
+	// Release finishes processing of the key without storing response, so request can be retried
+	Release(key string)
+}
+
+type idempotencyRepo struct {
+	path  string
+	ttl   time.Duration
+	clock clock.Clock
+	// mu guards all fields below
+	mu       sync.Mutex
+	loaded   bool
+	stored   map[string]StoredResponse
+	inFlight map[string]bool
+	// nextCompaction is the time when expired responses are dropped from memory and the file
+	nextCompaction time.Time
+}
+
+// NewTestIdempotencyRepository will create an object that represent the IdempotencyRepo interface for testing
+func NewTestIdempotencyRepository(tempDir string, ttl time.Duration, clk clock.Clock) IdempotencyRepo {
+	return newIdempotencyRepo(tempDir, ttl, clk)
+}
+
+// NewIdempotencyRepository will create an object that represent the IdempotencyRepo interface,
+// keys are remembered for ttl
+func NewIdempotencyRepository(ttl time.Duration, clk clock.Clock) IdempotencyRepo {
+	return newIdempotencyRepo(filepath.Join("internal", "speedfixationservice", "data"), ttl, clk)
+}
+
+func newIdempotencyRepo(storage string, ttl time.Duration, clk clock.Clock) *idempotencyRepo {
+	return &idempotencyRepo{
+		path:     filepath.Join(storage, idempotencyFile),
+		ttl:      ttl,
+		clock:    clk,
+		stored:   make(map[string]StoredResponse),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// load reads not expired responses and rewrites the file without expired ones, failed load
+// is retried by the next call. It is called under mu.
+func (ir *idempotencyRepo) load() error {
+	if ir.loaded {
+		return nil
+	}
+
+	if err := ir.read(); err != nil {
+		return err
+	}
+
+	if err := ir.compact(); err != nil {
+		return err
+	}
+
+	ir.loaded = true
+
+	return nil
+}
+
+// read reads responses which are not expired from the file
+func (ir *idempotencyRepo) read() error {
+	return readLines(ir.path, func(line []byte) error {
+		var resp StoredResponse
+
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return err
+		}
+
+		if !ir.expired(resp) {
+			ir.stored[resp.Key] = resp
+		}
+
+		return nil
+	})
+}
+
+// compact drops expired responses from memory and rewrites the file with the rest of them,
+// it is called under mu
+func (ir *idempotencyRepo) compact() error {
+	kept := make([]StoredResponse, 0, len(ir.stored))
+
+	for key, resp := range ir.stored {
+		if ir.expired(resp) {
+			delete(ir.stored, key)
+			continue
+		}
+
+		kept = append(kept, resp)
+	}
+
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Created.Before(kept[j].Created) })
+
+	tmp := ir.path + ".tmp"
+	if err := writeResponses(tmp, kept); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, ir.path); err != nil {
+		return err
+	}
+
+	// the file keeps at most responses of two ttl periods
+	ir.nextCompaction = ir.clock.Now().Add(ir.ttl)
+
+	return nil
+}
+
+func writeResponses(path string, responses []StoredResponse) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+
+	for _, resp := range responses {
+		if err := encoder.Encode(resp); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (ir *idempotencyRepo) expired(resp StoredResponse) bool {
+	return ir.clock.Now().Sub(resp.Created) > ir.ttl
+}
+
+func (ir *idempotencyRepo) Reserve(key string) (*StoredResponse, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	if err := ir.load(); err != nil {
+		return nil, err
+	}
+
+	if resp, ok := ir.stored[key]; ok {
+		if !ir.expired(resp) {
+			return &resp, nil
+		}
+
+		delete(ir.stored, key)
+	}
+
+	if ir.inFlight[key] {
+		return nil, ErrKeyInProgress
+	}
+
+	ir.inFlight[key] = true
+
+	return nil, nil
+}
+
+func (ir *idempotencyRepo) Save(resp StoredResponse) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	delete(ir.inFlight, resp.Key)
+
+	if err := ir.load(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(ir.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if err := json.NewEncoder(file).Encode(resp); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	ir.stored[resp.Key] = resp
+
+	if ir.clock.Now().After(ir.nextCompaction) {
+		// the response is already stored, failed compaction is retried by the next save
+		if err := ir.compact(); err != nil {
+			log.Println("unable compact idempotency keys:", err)
+		}
+	}
+
+	return nil
+}
+
+func (ir *idempotencyRepo) Release(key string) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	delete(ir.inFlight, key)
+}
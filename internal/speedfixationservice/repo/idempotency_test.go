@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func Test_idempotencyRepo(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	now := time.Date(2020, 3, 14, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+
+	ir := NewTestIdempotencyRepository(tempDir, time.Hour, fake)
+
+	stored, err := ir.Reserve("C12-1")
+	require.NoError(t, err)
+	require.Nil(t, stored)
+
+	_, err = ir.Reserve("C12-1")
+	require.True(t, errors.Is(err, ErrKeyInProgress))
+
+	resp := StoredResponse{
+		Key:         "C12-1",
+		Status:      200,
+		Body:        json.RawMessage(`"register success"`),
+		Created:     now,
+		RequestHash: "h1",
+	}
+	require.NoError(t, ir.Save(resp))
+
+	require.NoError(t, ir.Save(StoredResponse{
+		Key:     "C12-0",
+		Status:  200,
+		Body:    json.RawMessage(`"register success"`),
+		Created: now.Add(-2 * time.Hour),
+	}))
+
+	_, err = ir.Reserve("C12-2")
+	require.NoError(t, err)
+	ir.Release("C12-2")
+
+	// keys survive restart of the service, expired keys are forgotten
+	ir = NewTestIdempotencyRepository(tempDir, time.Hour, fake)
+
+	stored, err = ir.Reserve("C12-1")
+	require.NoError(t, err)
+	require.Equal(t, &resp, stored)
+
+	for _, key := range []string{"C12-0", "C12-2"} {
+		stored, err = ir.Reserve(key)
+		require.NoError(t, err)
+		require.Nil(t, stored)
+	}
+}
+
+func Test_idempotencyRepo_Compaction(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	now := time.Date(2020, 3, 14, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+
+	ir := NewTestIdempotencyRepository(tempDir, time.Hour, fake)
+
+	save := func(key string) {
+		t.Helper()
+
+		_, err := ir.Reserve(key)
+		require.NoError(t, err)
+		require.NoError(t, ir.Save(StoredResponse{Key: key, Status: 200, Body: json.RawMessage(`{}`), Created: fake.Now()}))
+	}
+
+	save("C12-1")
+	save("C12-2")
+	require.Equal(t, []string{"C12-1", "C12-2"}, storedKeys(t, tempDir))
+
+	// expired keys are dropped while the service runs
+	fake.Advance(90 * time.Minute)
+	save("C12-3")
+
+	require.Equal(t, []string{"C12-3"}, storedKeys(t, tempDir))
+
+	stored, err := ir.Reserve("C12-1")
+	require.NoError(t, err)
+	require.Nil(t, stored)
+}
+
+func storedKeys(t *testing.T, tempDir string) []string {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join(tempDir, idempotencyFile))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	var keys []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var resp StoredResponse
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &resp))
+		keys = append(keys, resp.Key)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return keys
+}
+
+func Test_idempotencyRepo_TornLine(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	fake := clock.NewFake(time.Date(2020, 3, 14, 12, 0, 0, 0, time.UTC))
+
+	ir := NewTestIdempotencyRepository(tempDir, time.Hour, fake)
+
+	_, err := ir.Reserve("C12-1")
+	require.NoError(t, err)
+	require.NoError(t, ir.Save(StoredResponse{Key: "C12-1", Status: 200, Body: json.RawMessage(`{}`), Created: fake.Now()}))
+
+	// crash during append cuts the last line, it is skipped and dropped by compaction
+	path := filepath.Join(tempDir, idempotencyFile)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"key":"C12-2","sta`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	ir = NewTestIdempotencyRepository(tempDir, time.Hour, fake)
+
+	stored, err := ir.Reserve("C12-1")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+
+	_, err = ir.Reserve("C12-3")
+	require.NoError(t, err)
+	require.NoError(t, ir.Save(StoredResponse{Key: "C12-3", Status: 200, Body: json.RawMessage(`{}`), Created: fake.Now()}))
+	require.Equal(t, []string{"C12-1", "C12-3"}, storedKeys(t, tempDir))
+
+	// broken line in the middle of the file is not skipped
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, append([]byte("{\"key\":\n"), data...), 0644))
+
+	_, err = NewTestIdempotencyRepository(tempDir, time.Hour, fake).Reserve("C12-1")
+	require.Error(t, err)
+}
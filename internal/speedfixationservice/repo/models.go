@@ -9,7 +9,78 @@ type dataSlice []SpeedFixation
 
 // SpeedFixation for working with data and storing it
 type SpeedFixation struct {
-	Date          time.Time `json:"date,omitempty"`
-	VehicleNumber string    `json:"vehicle_number,omitempty"`
-	Speed         float64   `json:"speed,omitempty"`
+	Date             time.Time `json:"date,omitempty"`
+	VehicleNumber    string    `json:"vehicle_number,omitempty"`
+	RawVehicleNumber string    `json:"raw_vehicle_number,omitempty"`
+	Country          string    `json:"country,omitempty"`
+	Camera           string    `json:"camera,omitempty"`
+	Speed            float64   `json:"speed,omitempty"`
+	Flags            []string  `json:"flags,omitempty"`
+	Evidence         *Evidence `json:"evidence,omitempty"`
+}
+
+// Evidence is the signature of fixation made by camera which took it
+type Evidence struct {
+	// Signature is base64 Ed25519 signature of canonical encoding of fixation
+	Signature string `json:"signature"`
+	// KeyID is ID of camera public key which verified the signature on registration
+	KeyID string `json:"key_id"`
+}
+
+// RepeatOffenderConditions describes search criteria of vehicles which exceed the speed limit repeatedly
+type RepeatOffenderConditions struct {
+	Date       time.Time `json:"date,omitempty"`
+	Days       int       `json:"days,omitempty"`
+	Speed      float64   `json:"speed,omitempty"`
+	Violations int       `json:"violations,omitempty"`
+}
+
+// Offender for representing vehicle with all its violations
+type Offender struct {
+	VehicleNumber string          `json:"vehicle_number,omitempty"`
+	Violations    []SpeedFixation `json:"violations,omitempty"`
+}
+
+// PlateCandidate for representing vehicle found by plate search with all its fixations
+type PlateCandidate struct {
+	VehicleNumber string          `json:"vehicle_number,omitempty"`
+	Distance      float64         `json:"distance"`
+	Fixations     []SpeedFixation `json:"fixations,omitempty"`
+}
+
+// SearchConditions describes fixations search criteria which are checked by the storage
+type SearchConditions struct {
+	From     time.Time `json:"from,omitempty"`
+	To       time.Time `json:"to,omitempty"`
+	MinSpeed float64   `json:"min_speed,omitempty"`
+	MaxSpeed float64   `json:"max_speed,omitempty"`
+}
+
+// SpeedStatistics for representing speed statistics of the day, Min and Max are nil when the day has no fixations
+type SpeedStatistics struct {
+	Date    time.Time       `json:"date"`
+	Count   int             `json:"count"`
+	Mean    float64         `json:"mean"`
+	Min     *SpeedFixation  `json:"min"`
+	Max     *SpeedFixation  `json:"max"`
+	MinTies []SpeedFixation `json:"min_ties,omitempty"`
+	MaxTies []SpeedFixation `json:"max_ties,omitempty"`
+}
+
+// Empty reports whether the day has no fixations
+func (s SpeedStatistics) Empty() bool {
+	return s.Count == 0
+}
+
+// QuarantinedFixation for representing fixation held aside from day data by validation rules
+type QuarantinedFixation struct {
+	Fixation    SpeedFixation `json:"fixation"`
+	Reasons     []string      `json:"reasons"`
+	Quarantined time.Time     `json:"quarantined"`
+}
+
+// FlaggedRecords for representing fixations of the day which broke validation rules
+type FlaggedRecords struct {
+	Flagged     []SpeedFixation       `json:"flagged"`
+	Quarantined []QuarantinedFixation `json:"quarantined"`
 }
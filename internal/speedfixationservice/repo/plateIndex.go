@@ -0,0 +1,368 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+)
+
+const plateIndexFile = "plates.idx"
+
+// plateIndexEntry is one line of the plate index file. Entries without vehicle number mark that the index
+// covers the day file of Size bytes, they are written after entries of every write.
+type plateIndexEntry struct {
+	Day           string  `json:"day"`
+	VehicleNumber string  `json:"vehicle_number,omitempty"`
+	Speed         float64 `json:"speed,omitempty"`
+	Size          int64   `json:"size,omitempty"`
+}
+
+// plateIndex keeps speeds of every vehicle grouped by the day file they are stored in,
+// so that questions about a vehicle do not require reading all day files
+type plateIndex struct {
+	storage string
+	mu      sync.RWMutex
+	loaded  bool
+	plates  map[string]map[string][]float64
+}
+
+func newPlateIndex(storage string) *plateIndex {
+	return &plateIndex{
+		storage: storage,
+		plates:  make(map[string]map[string][]float64),
+	}
+}
+
+// load reads index file, the index is rebuilt from day files when index file does not exist, is corrupt
+// or does not cover day files as they are. Failed load is retried by the next call.
+func (pi *plateIndex) load() error {
+	pi.mu.RLock()
+	loaded := pi.loaded
+	pi.mu.RUnlock()
+
+	if loaded {
+		return nil
+	}
+
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if pi.loaded {
+		return nil
+	}
+
+	sizes, err := pi.readIndex()
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = pi.rebuild()
+	case err != nil:
+		log.Println("plate index is corrupt, it is rebuilt:", err)
+		err = pi.rebuild()
+	default:
+		var stale bool
+
+		if stale, err = pi.stale(sizes); err == nil && stale {
+			log.Println("plate index does not cover day files, it is rebuilt")
+			err = pi.rebuild()
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	pi.loaded = true
+
+	return nil
+}
+
+// readIndex reads index file and returns sizes of day files it covers
+func (pi *plateIndex) readIndex() (map[string]int64, error) {
+	pi.plates = make(map[string]map[string][]float64)
+	sizes := make(map[string]int64)
+
+	file, err := os.Open(filepath.Join(pi.storage, plateIndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var entry plateIndexEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+
+		if entry.VehicleNumber == "" {
+			sizes[entry.Day] = entry.Size
+			continue
+		}
+
+		pi.put(entry)
+	}
+
+	return sizes, scanner.Err()
+}
+
+// dayFiles returns sizes of day files in storage
+func (pi *plateIndex) dayFiles() (map[string]int64, error) {
+	files, err := ioutil.ReadDir(pi.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]int64)
+
+	for _, fi := range files {
+		day := strings.TrimSuffix(fi.Name(), ".json")
+		if fi.IsDir() || day == fi.Name() {
+			continue
+		}
+
+		if _, err := time.Parse("02.01.2006", day); err != nil {
+			continue
+		}
+
+		ret[day] = fi.Size()
+	}
+
+	return ret, nil
+}
+
+// stale reports whether index does not cover day files, it happens when process stops
+// between writes of day file and index
+func (pi *plateIndex) stale(sizes map[string]int64) (bool, error) {
+	files, err := pi.dayFiles()
+	if err != nil {
+		return false, err
+	}
+
+	if len(files) != len(sizes) {
+		return true, nil
+	}
+
+	for day, size := range files {
+		if covered, ok := sizes[day]; !ok || covered != size {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// rebuild indexes all day files and replaces index file, unreadable day files are skipped
+func (pi *plateIndex) rebuild() error {
+	pi.plates = make(map[string]map[string][]float64)
+
+	files, err := pi.dayFiles()
+	if err != nil {
+		return err
+	}
+
+	var entries []plateIndexEntry
+
+	for day, size := range files {
+		var dayEntries []plateIndexEntry
+
+		// index is loaded once, so rebuild is not cancelled by request which happened to trigger it
+		err = eachFixation(context.Background(), filepath.Join(pi.storage, day+".json"), func(data SpeedFixation) error {
+			dayEntries = append(dayEntries, plateIndexEntry{Day: day, VehicleNumber: data.VehicleNumber, Speed: data.Speed})
+			return nil
+		})
+		if err != nil {
+			log.Println("unable index day file, it is skipped:", day, err)
+			dayEntries = nil
+		}
+
+		// skipped day is marked as covered too, so it is not read on every start
+		entries = append(append(entries, dayEntries...), plateIndexEntry{Day: day, Size: size})
+	}
+
+	for _, entry := range entries {
+		if entry.VehicleNumber != "" {
+			pi.put(entry)
+		}
+	}
+
+	tmp := filepath.Join(pi.storage, plateIndexFile+".tmp")
+
+	if err := writeIndexEntries(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entries); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(pi.storage, plateIndexFile))
+}
+
+func (pi *plateIndex) put(entry plateIndexEntry) {
+	number := plate.Normalize(entry.VehicleNumber)
+
+	days, ok := pi.plates[number]
+	if !ok {
+		days = make(map[string][]float64)
+		pi.plates[number] = days
+	}
+
+	days[entry.Day] = append(days[entry.Day], entry.Speed)
+}
+
+func writeIndexEntries(path string, flag int, entries []plateIndexEntry) error {
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// add stores fixations written to the day file in the index file and in memory,
+// it is called after the day file is written
+func (pi *plateIndex) add(day string, fixations ...SpeedFixation) error {
+	if err := pi.load(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filepath.Join(pi.storage, day+".json"))
+	if err != nil {
+		return err
+	}
+
+	entries := make([]plateIndexEntry, 0, len(fixations)+1)
+	for _, fixation := range fixations {
+		entries = append(entries, plateIndexEntry{Day: day, VehicleNumber: fixation.VehicleNumber, Speed: fixation.Speed})
+	}
+
+	entries = append(entries, plateIndexEntry{Day: day, Size: info.Size()})
+
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if err := writeIndexEntries(filepath.Join(pi.storage, plateIndexFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries[:len(fixations)] {
+		pi.put(entry)
+	}
+
+	return nil
+}
+
+// violations returns number of violations of every vehicle which exceed speedLimit
+// at least minViolations times during passed days
+func (pi *plateIndex) violations(days []string, speedLimit float64, minViolations int) (map[string]int, error) {
+	if err := pi.load(); err != nil {
+		return nil, err
+	}
+
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+
+	ret := make(map[string]int)
+
+	for number, numberDays := range pi.plates {
+		var count int
+
+		for _, day := range days {
+			for _, speed := range numberDays[day] {
+				if speed > speedLimit {
+					count++
+				}
+			}
+		}
+
+		if count >= minViolations {
+			ret[number] = count
+		}
+	}
+
+	return ret, nil
+}
+
+// vehicleNumbers returns all normalized vehicle numbers stored in the index
+func (pi *plateIndex) vehicleNumbers() ([]string, error) {
+	if err := pi.load(); err != nil {
+		return nil, err
+	}
+
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+
+	ret := make([]string, 0, len(pi.plates))
+	for number := range pi.plates {
+		ret = append(ret, number)
+	}
+
+	return ret, nil
+}
+
+// days returns sorted names of day files which contain fixations of passed vehicles
+func (pi *plateIndex) days(vehicleNumbers []string) ([]string, error) {
+	if err := pi.load(); err != nil {
+		return nil, err
+	}
+
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+
+	set := make(map[string]time.Time)
+
+	for _, number := range vehicleNumbers {
+		for day := range pi.plates[plate.Normalize(number)] {
+			date, err := time.Parse("02.01.2006", day)
+			if err != nil {
+				return nil, err
+			}
+
+			set[day] = date
+		}
+	}
+
+	ret := make([]string, 0, len(set))
+	for day := range set {
+		ret = append(ret, day)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return set[ret[i]].Before(set[ret[j]])
+	})
+
+	return ret, nil
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func TestPlateIndex_Rebuild(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	day := time.Date(2020, 3, 14, 12, 0, 0, 0, time.Local)
+	fixation := SpeedFixation{Date: day.UTC(), VehicleNumber: "6048 EC-3", Speed: 62.8}
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.NewFake(day))
+	require.NoError(t, sf.CreateRecord(context.Background(), fixation))
+
+	// corrupt day file is skipped, so it does not break the repository
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "13.03.2020.json"), []byte("[{"), 0644))
+
+	sf = NewTestSpeedFixationRepository(tempDir, clock.NewFake(day))
+	got, err := sf.LookUpFixationsByVehicleNumbers(context.Background(), []string{"6048 EC-3"})
+	require.NoError(t, err)
+	require.Equal(t, []SpeedFixation{fixation}, got[plate.Normalize("6048 EC-3")])
+
+	// process stopped after the day file was written, but before the index was
+	index := filepath.Join(tempDir, plateIndexFile)
+	data, err := ioutil.ReadFile(index)
+	require.NoError(t, err)
+
+	sf = NewTestSpeedFixationRepository(tempDir, clock.NewFake(day))
+	later := SpeedFixation{Date: day.UTC(), VehicleNumber: "6048 EC-3", Speed: 71.2}
+	require.NoError(t, sf.CreateRecord(context.Background(), later))
+	require.NoError(t, ioutil.WriteFile(index, data, 0644))
+
+	sf = NewTestSpeedFixationRepository(tempDir, clock.NewFake(day))
+	got, err = sf.LookUpFixationsByVehicleNumbers(context.Background(), []string{"6048 EC-3"})
+	require.NoError(t, err)
+	require.Equal(t, []SpeedFixation{fixation, later}, got[plate.Normalize("6048 EC-3")])
+}
+
+func TestPlateIndex_LoadRetry(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	pi := newPlateIndex(filepath.Join(tempDir, "missing"))
+	require.Error(t, pi.load())
+
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "missing"), 0755))
+	require.NoError(t, pi.load())
+}
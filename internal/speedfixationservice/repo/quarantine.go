@@ -0,0 +1,86 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/luno/jettison/errors"
+)
+
+const quarantineDir = "quarantine"
+
+func (sf *speedFixationRepo) QuarantineRecord(ctx context.Context, fixation QuarantinedFixation) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.isClosed() {
+		return ErrClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(sf.storage, quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, fixationDay(fixation.Fixation)+".json"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	return json.NewEncoder(file).Encode(fixation)
+}
+
+func (sf speedFixationRepo) LookUpQuarantinedByDate(ctx context.Context, date time.Time) ([]QuarantinedFixation, error) {
+	var ret []QuarantinedFixation
+
+	file, err := os.Open(filepath.Join(sf.storage, quarantineDir, date.Format("02.01.2006")+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var fixation QuarantinedFixation
+
+		if err := json.Unmarshal(scanner.Bytes(), &fixation); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, fixation)
+	}
+
+	return ret, scanner.Err()
+}
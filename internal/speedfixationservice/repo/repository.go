@@ -2,12 +2,65 @@
 package repo
 
 import (
+	"bufio"
+	"context"
+	"log"
+	"os"
 	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 )
 
-// SpeedControlRepo represent the speedFixationRepo repository contract
+// SpeedControlRepo represent the speedFixationRepo repository contract, look ups stop reading
+// day files when context is done, writes check context only before they start
 type SpeedControlRepo interface {
-	CreateRecord(SpeedFixation) error
-	LookUpOverSpeedByDate(SpeedFixation) ([]SpeedFixation, error)
-	LookUpMinMaxSpeedByDate(time.Time) ([]SpeedFixation, error)
+	CreateRecord(context.Context, SpeedFixation) error
+	CreateRecords(context.Context, []SpeedFixation) ([]error, error)
+	QuarantineRecord(context.Context, QuarantinedFixation) error
+	LookUpQuarantinedByDate(context.Context, time.Time) ([]QuarantinedFixation, error)
+	LookUpOverSpeedByDate(context.Context, SpeedFixation) ([]SpeedFixation, error)
+	LookUpMinMaxSpeedByDate(context.Context, time.Time) ([]SpeedFixation, error)
+	LookUpSpeedStatisticsByDate(context.Context, time.Time) (SpeedStatistics, error)
+	LookUpRepeatOffenders(context.Context, RepeatOffenderConditions) ([]Offender, error)
+	LookUpVehicleNumbers(context.Context) ([]string, error)
+	LookUpFixationsByVehicleNumbers(context.Context, []string) (map[string][]SpeedFixation, error)
+	LookUpFixations(context.Context, SearchConditions) ([]SpeedFixation, error)
+	Close() error
+}
+
+// readLines calls decode for every line of append-only file. The last line can be cut by crash during
+// append, so it is skipped when it can not be decoded, callers rewrite the file after reading it.
+func readLines(path string, decode func(line []byte) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var torn error
+
+	for scanner.Scan() {
+		if torn != nil {
+			return errors.Wrap(torn, "broken line", j.KV("path", path))
+		}
+
+		torn = decode(scanner.Bytes())
+	}
+
+	if torn != nil {
+		log.Println("torn last line of", path, "is skipped:", torn)
+	}
+
+	return scanner.Err()
 }
@@ -2,40 +2,125 @@
 package repo
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
 )
 
+// ErrDuplicate is returned for fixation which is already stored
+var ErrDuplicate = errors.New("duplicate fixation", errors.WithCode("duplicate"))
+
+// ErrClosed is returned for writes to closed repository
+var ErrClosed = errors.New("repository is closed", errors.WithCode("closed"))
+
 // ContactRepo representations ContractRepository interface
 type speedFixationRepo struct {
 	storage string
 	mu      *sync.Mutex
+	index   *plateIndex
+	// clock tells which days are recent enough to keep their fixation keys in memory
+	clock clock.Clock
+	// closed is guarded by mu, nil closed means repository is open
+	closed *bool
+	// seen keeps keys of stored fixations by day file for duplicates detection, it is guarded by mu
+	seen map[string]map[string]bool
+	// unsynced are day files written without flushing to disk, they are flushed by Close
+	unsynced map[string]bool
 }
 
+// seenDays is the number of recent days whose fixation keys are kept in memory
+const seenDays = 7
+
 // NewTestSpeedFixationRepository will create an object that represent the SpeedControlRepo interface for testing
-func NewTestSpeedFixationRepository(tempDir string) SpeedControlRepo {
+func NewTestSpeedFixationRepository(tempDir string, clk clock.Clock) SpeedControlRepo {
 	return &speedFixationRepo{
 		storage: tempDir,
 		mu:      &sync.Mutex{},
+		index:   newPlateIndex(tempDir),
+		clock:   clk,
+		closed:  new(bool),
+		seen:    make(map[string]map[string]bool),
 	}
 }
 
 // NewSpeedFixationRepository will create an object that represent the SpeedControlRepo interface
-func NewSpeedFixationRepository() SpeedControlRepo {
+func NewSpeedFixationRepository(clk clock.Clock) SpeedControlRepo {
+	storage := filepath.Join("internal", "speedfixationservice", "data")
+
 	return &speedFixationRepo{
-		storage: filepath.Join("internal", "speedfixationservice", "data"),
+		storage: storage,
 		mu:      &sync.Mutex{},
+		index:   newPlateIndex(storage),
+		clock:   clk,
+		closed:  new(bool),
+		seen:    make(map[string]map[string]bool),
 	}
 }
 
-func (sf speedFixationRepo) createFile() error {
-	file, err := os.Create(filepath.Join(sf.storage, time.Now().Format("02.01.2006")+".json"))
+// isClosed reports whether repository is closed, it is called under mu
+func (sf speedFixationRepo) isClosed() bool {
+	return sf.closed != nil && *sf.closed
+}
+
+// Close waits for the current write, flushes written day files and the plate index to disk
+// and rejects further writes with ErrClosed
+func (sf *speedFixationRepo) Close() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.closed == nil {
+		sf.closed = new(bool)
+	}
+
+	if *sf.closed {
+		return nil
+	}
+
+	*sf.closed = true
+
+	for day := range sf.unsynced {
+		if err := syncFile(filepath.Join(sf.storage, day+".json")); err != nil {
+			return err
+		}
+
+		delete(sf.unsynced, day)
+	}
+
+	return syncFile(filepath.Join(sf.storage, plateIndexFile))
+}
+
+// syncFile flushes file to disk, missing file is skipped
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (sf speedFixationRepo) createFile(day string) error {
+	file, err := os.Create(filepath.Join(sf.storage, day+".json"))
 	if err != nil {
 		return err
 	}
@@ -47,25 +132,25 @@ func (sf speedFixationRepo) createFile() error {
 	return nil
 }
 
-func (sf speedFixationRepo) openFile() (*os.File, error) {
-	file, err := os.OpenFile(filepath.Join(sf.storage, time.Now().Format("02.01.2006")+".json"),
+func (sf speedFixationRepo) openFile(day string) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(sf.storage, day+".json"),
 		os.O_WRONLY, os.ModeAppend)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, err
 		}
 
-		if err = sf.createFile(); err != nil {
+		if err = sf.createFile(day); err != nil {
 			return nil, err
 		}
 
-		return sf.openFile()
+		return sf.openFile(day)
 	}
 
 	return file, nil
 }
 
-func (sf *speedFixationRepo) CreateRecord(fixation SpeedFixation) error {
+func (sf *speedFixationRepo) CreateRecord(ctx context.Context, fixation SpeedFixation) error {
 	var (
 		file   *os.File
 		err    error
@@ -75,7 +160,22 @@ func (sf *speedFixationRepo) CreateRecord(fixation SpeedFixation) error {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
 
-	if file, err = sf.openFile(); err != nil {
+	if sf.isClosed() {
+		return ErrClosed
+	}
+
+	// write is not interrupted once started, so file is never left half written
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if err = sf.index.load(); err != nil {
+		return err
+	}
+
+	day := fixationDay(fixation)
+
+	if file, err = sf.openFile(day); err != nil {
 		return err
 	}
 
@@ -116,20 +216,253 @@ func (sf *speedFixationRepo) CreateRecord(fixation SpeedFixation) error {
 		return err
 	}
 
-	return nil
+	if keys, ok := sf.seen[day]; ok {
+		keys[fixationKey(fixation)] = true
+	}
+
+	if sf.unsynced == nil {
+		sf.unsynced = make(map[string]bool)
+	}
+
+	sf.unsynced[day] = true
+
+	return sf.index.add(day, fixation)
+}
+
+// fixationKey identifies fixation for duplicates detection
+func fixationKey(fixation SpeedFixation) string {
+	return fmt.Sprintf("%s|%s|%s|%v", fixation.Date.UTC().Format(time.RFC3339Nano),
+		plate.Normalize(fixation.VehicleNumber), fixation.Camera, fixation.Speed)
+}
+
+// fixationDay returns name of the day file of fixation
+func fixationDay(fixation SpeedFixation) string {
+	return fixation.Date.UTC().Format("02.01.2006")
+}
+
+// seenKeys returns keys of fixations stored in the day file, keys of recent days are read
+// from the file once and kept in memory. It is called under mu.
+func (sf *speedFixationRepo) seenKeys(ctx context.Context, day string) (map[string]bool, error) {
+	if keys, ok := sf.seen[day]; ok {
+		return keys, nil
+	}
+
+	keys := make(map[string]bool)
+
+	// the day file is only read before the write, so reading can be cancelled
+	err := eachFixation(ctx, filepath.Join(sf.storage, day+".json"), func(data SpeedFixation) error {
+		keys[fixationKey(data)] = true
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if sf.seen == nil {
+		sf.seen = make(map[string]map[string]bool)
+	}
+
+	// late fixations of older days are checked against their files every time
+	for d := range sf.seen {
+		if !sf.recent(d) {
+			delete(sf.seen, d)
+		}
+	}
+
+	if sf.recent(day) {
+		sf.seen[day] = keys
+	}
+
+	return keys, nil
+}
+
+// recent reports whether day is one of the last seenDays days or tomorrow, which is today
+// in time zones ahead of UTC
+func (sf speedFixationRepo) recent(day string) bool {
+	t, err := time.Parse("02.01.2006", day)
+	if err != nil {
+		return false
+	}
+
+	now := sf.clock.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	return t.After(today.AddDate(0, 0, -seenDays)) && !t.After(today.AddDate(0, 0, 1))
+}
+
+// dayWrite is chunk of fixations appended to one day file
+type dayWrite struct {
+	day       string
+	chunk     []byte
+	keys      []string
+	fixations []SpeedFixation
+	file      *os.File
+	size      int64
 }
 
-func (sf speedFixationRepo) selectViolators(fileName string, speedLimit float64) ([]SpeedFixation, error) {
+// CreateRecords stores all fixations which are not stored yet in one write to day files of
+// their dates, if write fails the day files are restored and none of fixations is stored.
+// It returns ErrDuplicate for every fixation already stored or repeated in the batch.
+func (sf *speedFixationRepo) CreateRecords(ctx context.Context, fixations []SpeedFixation) ([]error, error) {
 	var (
-		violators []SpeedFixation
-		data      SpeedFixation
+		err    error
+		ret    = make([]error, len(fixations))
+		writes []*dayWrite
+		byDay  = make(map[string]*dayWrite)
+		batch  = make(map[string]bool)
 	)
 
-	path := filepath.Join(sf.storage, fileName+".json")
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.isClosed() {
+		return nil, ErrClosed
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = sf.index.load(); err != nil {
+		return nil, err
+	}
+
+	for i, fixation := range fixations {
+		day := fixationDay(fixation)
+
+		seen, err := sf.seenKeys(ctx, day)
+		if err != nil {
+			return nil, err
+		}
+
+		key := fixationKey(fixation)
+		if seen[key] || batch[key] {
+			ret[i] = ErrDuplicate
+			continue
+		}
+
+		batch[key] = true
+
+		jsf, err := json.Marshal(fixation)
+		if err != nil {
+			return nil, err
+		}
+
+		w, ok := byDay[day]
+		if !ok {
+			w = &dayWrite{day: day}
+			byDay[day] = w
+			writes = append(writes, w)
+		}
+
+		w.chunk = append(append(w.chunk, ','), jsf...)
+		w.keys = append(w.keys, key)
+		w.fixations = append(w.fixations, fixation)
+	}
+
+	defer func() {
+		for _, w := range writes {
+			if w.file == nil {
+				continue
+			}
+
+			if err := w.file.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}()
+
+	for i, w := range writes {
+		if err = sf.appendChunk(w); err != nil {
+			if rerr := sf.rollbackWrites(writes[:i+1]); rerr != nil {
+				return nil, errors.Wrap(rerr, err.Error())
+			}
+
+			return nil, err
+		}
+	}
+
+	for _, w := range writes {
+		if err = w.file.Sync(); err != nil {
+			return nil, err
+		}
+
+		if keys, ok := sf.seen[w.day]; ok {
+			for _, key := range w.keys {
+				keys[key] = true
+			}
+		}
+
+		if err = sf.index.add(w.day, w.fixations...); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// appendChunk opens day file of write and appends its fixations before the closing bracket
+func (sf *speedFixationRepo) appendChunk(w *dayWrite) error {
+	file, err := sf.openFile(w.day)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// rollback restores only files whose size is known
+	w.file, w.size = file, fileInfo.Size()
+
+	chunk := w.chunk
+
+	// the first comma replaces closing bracket of an empty file
+	if w.size <= 2 {
+		chunk = chunk[1:]
+	}
+
+	chunk = append(chunk, ']')
+
+	_, err = w.file.WriteAt(chunk, w.size-1)
 
+	return err
+}
+
+// rollbackWrites restores day files of writes which are opened
+func (sf *speedFixationRepo) rollbackWrites(writes []*dayWrite) error {
+	for _, w := range writes {
+		if w.file == nil {
+			continue
+		}
+
+		if err := sf.rollback(w.file, w.size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollback restores day file which had fileSize before the failed write
+func (sf *speedFixationRepo) rollback(file *os.File, fileSize int64) error {
+	if err := file.Truncate(fileSize); err != nil {
+		return err
+	}
+
+	_, err := file.WriteAt([]byte("]"), fileSize-1)
+
+	return err
+}
+
+// eachFixation decodes day file record by record and passes every record to fn,
+// decoding stops with error of context when it is done
+func eachFixation(ctx context.Context, path string, fn func(SpeedFixation) error) error {
 	file, err := os.Open(filepath.Clean(path))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer func() {
@@ -141,71 +474,218 @@ func (sf speedFixationRepo) selectViolators(fileName string, speedLimit float64)
 	decoder := json.NewDecoder(file)
 
 	if _, err := decoder.Token(); err != nil {
-		return nil, err
+		return err
 	}
 
 	for decoder.More() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var data SpeedFixation
+
 		if err := decoder.Decode(&data); err != nil {
-			return nil, err
+			return err
+		}
+
+		if err := fn(data); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
+func (sf speedFixationRepo) selectViolators(ctx context.Context, fileName string, speedLimit float64) ([]SpeedFixation, error) {
+	var violators []SpeedFixation
+
+	path := filepath.Join(sf.storage, fileName+".json")
+
+	err := eachFixation(ctx, path, func(data SpeedFixation) error {
 		if data.Speed > speedLimit {
 			violators = append(violators, data)
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return violators, nil
 }
 
-func (sf speedFixationRepo) selectMinMaxSpeed(fileName string) ([]SpeedFixation, error) {
+func (sf speedFixationRepo) selectSpeedStatistics(ctx context.Context, fileName string) (SpeedStatistics, error) {
 	var (
-		ret                = make([]SpeedFixation, 2)
-		data               SpeedFixation
-		minSpeed, maxSpeed = 200.0, 0.0
+		ret SpeedStatistics
+		sum float64
 	)
 
 	path := filepath.Join(sf.storage, fileName+".json")
 
-	file, err := os.Open(filepath.Clean(path))
+	err := eachFixation(ctx, path, func(data SpeedFixation) error {
+		ret.Count++
+		sum += data.Speed
+
+		switch {
+		case ret.Min == nil || data.Speed < ret.Min.Speed:
+			ret.Min, ret.MinTies = &data, nil
+		case data.Speed == ret.Min.Speed:
+			ret.MinTies = append(ret.MinTies, data)
+		}
+
+		switch {
+		case ret.Max == nil || data.Speed > ret.Max.Speed:
+			ret.Max, ret.MaxTies = &data, nil
+		case data.Speed == ret.Max.Speed:
+			ret.MaxTies = append(ret.MaxTies, data)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return SpeedStatistics{}, err
+	}
+
+	if ret.Count > 0 {
+		ret.Mean = sum / float64(ret.Count)
+	}
+
+	return ret, nil
+}
+
+func (sf speedFixationRepo) selectMinMaxSpeed(ctx context.Context, fileName string) ([]SpeedFixation, error) {
+	ret := make([]SpeedFixation, 2)
+
+	stats, err := sf.selectSpeedStatistics(ctx, fileName)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Fatal(err)
-		}
-	}()
+	if !stats.Empty() {
+		ret[0], ret[1] = *stats.Min, *stats.Max
+	}
 
-	decoder := json.NewDecoder(file)
+	return ret, nil
+}
 
-	if _, err := decoder.Token(); err != nil {
+func (sf speedFixationRepo) LookUpOverSpeedByDate(ctx context.Context, fixation SpeedFixation) ([]SpeedFixation, error) {
+	return sf.selectViolators(ctx, fixation.Date.Format("02.01.2006"), fixation.Speed)
+}
+
+func (sf speedFixationRepo) LookUpMinMaxSpeedByDate(ctx context.Context, date time.Time) ([]SpeedFixation, error) {
+	return sf.selectMinMaxSpeed(ctx, date.Format("02.01.2006"))
+}
+
+func (sf speedFixationRepo) LookUpSpeedStatisticsByDate(ctx context.Context, date time.Time) (SpeedStatistics, error) {
+	stats, err := sf.selectSpeedStatistics(ctx, date.Format("02.01.2006"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return SpeedStatistics{}, err
+	}
+
+	stats.Date = date
+
+	return stats, nil
+}
+
+func (sf speedFixationRepo) LookUpRepeatOffenders(ctx context.Context, conditions RepeatOffenderConditions) ([]Offender, error) {
+	days := make([]string, 0, conditions.Days)
+	for i := 0; i < conditions.Days; i++ {
+		days = append(days, conditions.Date.AddDate(0, 0, -i).Format("02.01.2006"))
+	}
+
+	counts, err := sf.index.violations(days, conditions.Speed, conditions.Violations)
+	if err != nil {
 		return nil, err
 	}
 
-	for decoder.More() {
-		if err := decoder.Decode(&data); err != nil {
+	offenders := make(map[string]*Offender, len(counts))
+
+	for number := range counts {
+		offenders[number] = &Offender{VehicleNumber: number}
+	}
+
+	// days are walked from the oldest one to keep violations in chronological order
+	for i := len(days) - 1; i >= 0 && len(offenders) > 0; i-- {
+		violators, err := sf.selectViolators(ctx, days[i], conditions.Speed)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
 			return nil, err
 		}
 
-		if data.Speed < minSpeed {
-			minSpeed = data.Speed
-			ret[0] = data
+		for _, violator := range violators {
+			if offender, ok := offenders[plate.Normalize(violator.VehicleNumber)]; ok {
+				offender.Violations = append(offender.Violations, violator)
+			}
 		}
+	}
 
-		if data.Speed > maxSpeed {
-			maxSpeed = data.Speed
-			ret[1] = data
-		}
+	ret := make([]Offender, 0, len(offenders))
+	for _, offender := range offenders {
+		ret = append(ret, *offender)
 	}
 
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].Violations) != len(ret[j].Violations) {
+			return len(ret[i].Violations) > len(ret[j].Violations)
+		}
+
+		return ret[i].VehicleNumber < ret[j].VehicleNumber
+	})
+
 	return ret, nil
 }
 
-func (sf speedFixationRepo) LookUpOverSpeedByDate(fixation SpeedFixation) ([]SpeedFixation, error) {
-	return sf.selectViolators(fixation.Date.Format("02.01.2006"), fixation.Speed)
+func (sf speedFixationRepo) LookUpVehicleNumbers(_ context.Context) ([]string, error) {
+	return sf.index.vehicleNumbers()
+}
+
+func (sf speedFixationRepo) LookUpFixationsByVehicleNumbers(ctx context.Context, vehicleNumbers []string) (map[string][]SpeedFixation, error) {
+	days, err := sf.index.days(vehicleNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string][]SpeedFixation, len(vehicleNumbers))
+	for _, number := range vehicleNumbers {
+		ret[plate.Normalize(number)] = nil
+	}
+
+	for _, day := range days {
+		err := eachFixation(ctx, filepath.Join(sf.storage, day+".json"), func(data SpeedFixation) error {
+			number := plate.Normalize(data.VehicleNumber)
+			if _, ok := ret[number]; ok {
+				ret[number] = append(ret[number], data)
+			}
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return ret, nil
 }
 
-func (sf speedFixationRepo) LookUpMinMaxSpeedByDate(date time.Time) ([]SpeedFixation, error) {
-	return sf.selectMinMaxSpeed(date.Format("02.01.2006"))
+func (sf speedFixationRepo) LookUpFixations(ctx context.Context, conditions SearchConditions) ([]SpeedFixation, error) {
+	var ret []SpeedFixation
+
+	for day := conditions.From; !day.After(conditions.To); day = day.AddDate(0, 0, 1) {
+		err := eachFixation(ctx, filepath.Join(sf.storage, day.Format("02.01.2006")+".json"), func(data SpeedFixation) error {
+			if data.Speed >= conditions.MinSpeed && data.Speed <= conditions.MaxSpeed {
+				ret = append(ret, data)
+			}
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return ret, nil
 }
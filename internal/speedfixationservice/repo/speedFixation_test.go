@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -10,7 +11,11 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/luno/jettison/errors"
 	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
 )
 
 var testData = []SpeedFixation{
@@ -55,7 +60,7 @@ func BenchmarkLookUpOverSpeedByDate(b *testing.B) {
 
 	fillTestData(b, tempDir)
 
-	sfr := NewTestSpeedFixationRepository(tempDir)
+	sfr := NewTestSpeedFixationRepository(tempDir, clock.System)
 
 	a := SpeedFixation{}
 
@@ -66,7 +71,7 @@ func BenchmarkLookUpOverSpeedByDate(b *testing.B) {
 	a.Speed = 100
 
 	for i := 0; i < b.N; i++ {
-		_, err := sfr.LookUpOverSpeedByDate(a)
+		_, err := sfr.LookUpOverSpeedByDate(context.Background(), a)
 		require.NoError(b, err)
 	}
 }
@@ -79,10 +84,10 @@ func BenchmarkLookUpMinMaxSpeedByDate(b *testing.B) {
 
 	fillTestData(b, tempDir)
 
-	sfr := NewTestSpeedFixationRepository(tempDir)
+	sfr := NewTestSpeedFixationRepository(tempDir, clock.System)
 
 	for i := 0; i < b.N; i++ {
-		_, err = sfr.LookUpMinMaxSpeedByDate(time.Now())
+		_, err = sfr.LookUpMinMaxSpeedByDate(context.Background(), time.Now())
 		require.NoError(b, err)
 	}
 }
@@ -93,7 +98,7 @@ func BenchmarkCreateRecord(b *testing.B) {
 	tempDir, dropFile := createTempDir(b)
 	defer dropFile()
 
-	sfr := NewTestSpeedFixationRepository(tempDir)
+	sfr := NewTestSpeedFixationRepository(tempDir, clock.System)
 
 	sf := SpeedFixation{}
 
@@ -106,7 +111,7 @@ func BenchmarkCreateRecord(b *testing.B) {
 	sf.Speed = 100
 
 	for i := 0; i < b.N; i++ {
-		require.NoError(b, sfr.CreateRecord(sf))
+		require.NoError(b, sfr.CreateRecord(context.Background(), sf))
 	}
 }
 
@@ -145,9 +150,11 @@ func Test_speedFixationRepo_CreateRecord(t *testing.T) {
 	sf := speedFixationRepo{
 		storage: tempDir,
 		mu:      &sync.Mutex{},
+		index:   newPlateIndex(tempDir),
+		clock:   clock.System,
 	}
 
-	err := sf.CreateRecord(tt.args.fixation)
+	err := sf.CreateRecord(context.Background(), tt.args.fixation)
 
 	if tt.wantErr {
 		require.Error(t, err)
@@ -190,9 +197,9 @@ func Test_speedFixationRepo_LookUpMinMaxSpeedByDate(t *testing.T) {
 		wantErr: false,
 	}
 
-	sf := NewTestSpeedFixationRepository(tempDir)
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
 
-	got, err := sf.LookUpMinMaxSpeedByDate(tt.args.date)
+	got, err := sf.LookUpMinMaxSpeedByDate(context.Background(), tt.args.date)
 
 	if tt.wantErr {
 		require.Error(t, err)
@@ -227,9 +234,9 @@ func Test_speedFixationRepo_LookUpOverSpeedByDate(t *testing.T) {
 		wantErr: false,
 	}
 
-	sf := NewTestSpeedFixationRepository(tempDir)
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
 
-	got, err := sf.LookUpOverSpeedByDate(tt.args.fixation)
+	got, err := sf.LookUpOverSpeedByDate(context.Background(), tt.args.fixation)
 
 	if tt.wantErr {
 		require.Error(t, err)
@@ -240,3 +247,213 @@ func Test_speedFixationRepo_LookUpOverSpeedByDate(t *testing.T) {
 
 	require.Equal(t, tt.want, got)
 }
+
+func Test_speedFixationRepo_LookUpRepeatOffenders(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	longAgo := today.AddDate(0, 0, -10)
+
+	days := map[time.Time][]SpeedFixation{
+		longAgo:   {{Date: longAgo.UTC(), VehicleNumber: "0003 AE-3", Speed: 95.1}},
+		yesterday: {{Date: yesterday.UTC(), VehicleNumber: "0003 AE-3", Speed: 91.3}},
+		today:     testData,
+	}
+
+	for day, fixations := range days {
+		data, err := json.Marshal(fixations)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, day.Format("02.01.2006")+".json"), data, 0644))
+	}
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
+
+	got, err := sf.LookUpRepeatOffenders(context.Background(), RepeatOffenderConditions{
+		Date:       today,
+		Days:       3,
+		Speed:      60,
+		Violations: 2,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []Offender{{
+		VehicleNumber: "0003AE3",
+		Violations:    []SpeedFixation{days[yesterday][0], testData[1]},
+	}}, got)
+
+	newFixation := SpeedFixation{Date: today.UTC(), VehicleNumber: "8911 EE-3", Speed: 77.7}
+	require.NoError(t, sf.CreateRecord(context.Background(), newFixation))
+
+	got, err = sf.LookUpRepeatOffenders(context.Background(), RepeatOffenderConditions{
+		Date:       today,
+		Days:       1,
+		Speed:      60,
+		Violations: 2,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []Offender{{
+		VehicleNumber: "8911EE3",
+		Violations:    []SpeedFixation{testData[2], newFixation},
+	}}, got)
+}
+
+func Test_speedFixationRepo_LookUpSpeedStatisticsByDate(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	fixations := append([]SpeedFixation{
+		{Date: time.Now().UTC(), VehicleNumber: "1234 AB-7", Speed: 254.2},
+		{Date: time.Now().UTC(), VehicleNumber: "4321 BA-7", Speed: 254.2},
+	}, testData...)
+
+	data, err := json.Marshal(fixations)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, time.Now().Format("02.01.2006")+".json"), data, 0644))
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
+
+	today := time.Now()
+
+	got, err := sf.LookUpSpeedStatisticsByDate(context.Background(), today)
+	require.NoError(t, err)
+
+	require.Equal(t, SpeedStatistics{
+		Date:    today,
+		Count:   5,
+		Mean:    (254.2 + 254.2 + 54.2 + 84.5 + 65.7) / 5,
+		Min:     &testData[0],
+		Max:     &fixations[0],
+		MaxTies: []SpeedFixation{fixations[1]},
+	}, got)
+
+	minMax, err := sf.LookUpMinMaxSpeedByDate(context.Background(), today)
+	require.NoError(t, err)
+	require.Equal(t, []SpeedFixation{testData[0], fixations[0]}, minMax)
+
+	yesterday := today.AddDate(0, 0, -1)
+
+	got, err = sf.LookUpSpeedStatisticsByDate(context.Background(), yesterday)
+	require.NoError(t, err)
+	require.True(t, got.Empty())
+	require.Equal(t, SpeedStatistics{Date: yesterday}, got)
+}
+
+func Test_speedFixationRepo_DayRollover(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	// every reading moves clock by millisecond, the first write starts before midnight
+	// and would end after it if clock were read twice
+	fake := clock.NewFake(time.Date(2020, 3, 14, 23, 59, 59, 999500000, time.Local))
+	fake.SetStep(time.Millisecond)
+
+	sf := NewTestSpeedFixationRepository(tempDir, fake)
+
+	before := SpeedFixation{Date: time.Date(2020, 3, 14, 23, 59, 59, 0, time.UTC), VehicleNumber: "6048 EC-3", Speed: 62.8}
+	require.NoError(t, sf.CreateRecord(context.Background(), before))
+
+	after := []SpeedFixation{
+		{Date: time.Date(2020, 3, 15, 0, 0, 1, 0, time.UTC), VehicleNumber: "0003 AE-3", Speed: 84.5},
+		{Date: time.Date(2020, 3, 15, 0, 0, 2, 0, time.UTC), VehicleNumber: "6048 EC-3", Speed: 71.2},
+	}
+	errs, err := sf.CreateRecords(context.Background(), after)
+	require.NoError(t, err)
+	require.Equal(t, []error{nil, nil}, errs)
+
+	require.Equal(t, []SpeedFixation{before}, readFile(t, tempDir, "14.03.2020"))
+	require.Equal(t, after, readFile(t, tempDir, "15.03.2020"))
+
+	// index points to the files fixations were written to
+	got, err := sf.LookUpFixationsByVehicleNumbers(context.Background(), []string{"6048 EC-3", "0003 AE-3"})
+	require.NoError(t, err)
+	require.Equal(t, []SpeedFixation{before, after[1]}, got[plate.Normalize("6048 EC-3")])
+	require.Equal(t, []SpeedFixation{after[0]}, got[plate.Normalize("0003 AE-3")])
+}
+
+func Test_speedFixationRepo_QuarantineRecord(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
+
+	// fixation made late in the day is quarantined after midnight, it is kept with fixations of its day
+	quarantined := QuarantinedFixation{
+		Fixation: SpeedFixation{
+			Date:          time.Date(2019, 12, 28, 1, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60)),
+			VehicleNumber: "6048 EC-3",
+			Speed:         400,
+		},
+		Reasons:     []string{"speed_bounds"},
+		Quarantined: time.Date(2019, 12, 28, 0, 10, 0, 0, time.UTC),
+	}
+	require.NoError(t, sf.QuarantineRecord(context.Background(), quarantined))
+
+	got, err := sf.LookUpQuarantinedByDate(context.Background(), time.Date(2019, 12, 27, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.True(t, quarantined.Fixation.Date.Equal(got[0].Fixation.Date))
+
+	got, err = sf.LookUpQuarantinedByDate(context.Background(), time.Date(2019, 12, 28, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func Test_speedFixationRepo_CreateRecordsByDate(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.NewFake(time.Date(2020, 3, 16, 12, 0, 0, 0, time.UTC)))
+
+	fixations := []SpeedFixation{
+		{Date: time.Date(2020, 3, 14, 23, 59, 59, 0, time.UTC), VehicleNumber: "6048 EC-3", Speed: 62.8},
+		{Date: time.Date(2020, 3, 15, 0, 0, 1, 0, time.UTC), VehicleNumber: "0003 AE-3", Speed: 84.5},
+	}
+	errs, err := sf.CreateRecords(context.Background(), fixations)
+	require.NoError(t, err)
+	require.Equal(t, []error{nil, nil}, errs)
+
+	// fixations are stored in files of their dates rather than of the day they are received
+	require.Equal(t, fixations[:1], readFile(t, tempDir, "14.03.2020"))
+	require.Equal(t, fixations[1:], readFile(t, tempDir, "15.03.2020"))
+
+	errs, err = sf.CreateRecords(context.Background(), fixations[1:])
+	require.NoError(t, err)
+	require.Equal(t, []error{ErrDuplicate}, errs)
+
+	// new repository finds duplicates in the day file
+	sf = NewTestSpeedFixationRepository(tempDir, clock.System)
+
+	errs, err = sf.CreateRecords(context.Background(), fixations)
+	require.NoError(t, err)
+	require.Equal(t, []error{ErrDuplicate, ErrDuplicate}, errs)
+}
+
+func Test_speedFixationRepo_Canceled(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	fillTestData(t, tempDir)
+
+	sf := NewTestSpeedFixationRepository(tempDir, clock.System)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := sf.LookUpOverSpeedByDate(ctx, SpeedFixation{Date: time.Now(), Speed: 60})
+	require.True(t, errors.Is(err, context.Canceled))
+
+	_, err = sf.LookUpMinMaxSpeedByDate(ctx, time.Now())
+	require.True(t, errors.Is(err, context.Canceled))
+
+	// canceled write does not touch the day file
+	require.True(t, errors.Is(sf.CreateRecord(ctx, SpeedFixation{Date: time.Now().UTC(), VehicleNumber: "6048 EC-3"}),
+		context.Canceled))
+	require.Equal(t, testData, readFile(t, tempDir, time.Now().Format("02.01.2006")))
+
+	got, err := sf.LookUpMinMaxSpeedByDate(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+}
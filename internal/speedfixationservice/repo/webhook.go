@@ -0,0 +1,450 @@
+// Package repo provides all needs methods to work with data storage
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+const (
+	webhookSubscriptionsFile = "webhook_subscriptions.json"
+	webhookOutboxFile        = "webhook_outbox.log"
+)
+
+// States of webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+	// DeliveryHeld waits for the outcome of registration, it becomes due only when it is not released
+	// until its next attempt time, e.g. after restart, so violation is delivered at least once
+	DeliveryHeld = "held"
+	// DeliveryCanceled is not sent because its fixation is not stored
+	DeliveryCanceled = "canceled"
+)
+
+// WebhookSubscription is the receiver of violations, violation is the fixation with speed greater than MinSpeed
+type WebhookSubscription struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	Secret   string    `json:"secret,omitempty"`
+	MinSpeed float64   `json:"min_speed"`
+	Camera   string    `json:"camera,omitempty"`
+	Created  time.Time `json:"created"`
+	// Static subscriptions are configured by file and can not be changed by API
+	Static bool `json:"static,omitempty"`
+}
+
+// WebhookDelivery is the payload sent to subscription, it is kept in outbox until it is delivered
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	State          string          `json:"state"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+	Created        time.Time       `json:"created"`
+	Updated        time.Time       `json:"updated"`
+	LastStatus     int             `json:"last_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+// DeliveryConditions describes search criteria of deliveries, zero values match everything
+type DeliveryConditions struct {
+	State          string `json:"state,omitempty"`
+	SubscriptionID string `json:"subscription_id,omitempty"`
+}
+
+// WebhookRepo represent the storage of webhook subscriptions and outbox of their deliveries
+type WebhookRepo interface {
+	AddSubscription(WebhookSubscription) (WebhookSubscription, error)
+	DeleteSubscription(id string) error
+	Subscriptions() ([]WebhookSubscription, error)
+	// Enqueue stores new deliveries in outbox, deliveries without state are pending
+	Enqueue(...WebhookDelivery) ([]WebhookDelivery, error)
+	// Due returns pending and held deliveries which next attempt time is not after now
+	Due(now time.Time) ([]WebhookDelivery, error)
+	// UpdateDelivery stores result of delivery attempt
+	UpdateDelivery(WebhookDelivery) error
+	GetDelivery(id string) (WebhookDelivery, error)
+	LookUpDeliveries(DeliveryConditions) ([]WebhookDelivery, error)
+}
+
+type webhookRepo struct {
+	storage   string
+	retention time.Duration
+	clock     clock.Clock
+
+	mu sync.Mutex
+	// loaded is set when files are read, failed load is retried by the next call
+	loaded        bool
+	subscriptions []WebhookSubscription
+	deliveries    map[string]WebhookDelivery
+	order         []string
+	// lines is the number of lines in outbox file
+	lines int
+}
+
+// NewTestWebhookRepository will create an object that represent the WebhookRepo interface for testing
+func NewTestWebhookRepository(tempDir string, retention time.Duration, clk clock.Clock) WebhookRepo {
+	return newWebhookRepo(tempDir, retention, clk)
+}
+
+// NewWebhookRepository will create an object that represent the WebhookRepo interface,
+// delivered and dead deliveries are kept for retention
+func NewWebhookRepository(retention time.Duration, clk clock.Clock) WebhookRepo {
+	return newWebhookRepo(filepath.Join("internal", "speedfixationservice", "data"), retention, clk)
+}
+
+func newWebhookRepo(storage string, retention time.Duration, clk clock.Clock) *webhookRepo {
+	return &webhookRepo{
+		storage:    storage,
+		retention:  retention,
+		clock:      clk,
+		deliveries: make(map[string]WebhookDelivery),
+	}
+}
+
+func (wr *webhookRepo) load() error {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.loaded {
+		return nil
+	}
+
+	wr.subscriptions, wr.deliveries, wr.order, wr.lines = nil, make(map[string]WebhookDelivery), nil, 0
+
+	if err := wr.readSubscriptions(); err != nil {
+		return err
+	}
+
+	if err := wr.readOutbox(); err != nil {
+		return err
+	}
+
+	// compaction also drops torn last line, so the next append starts a new line
+	if err := wr.compact(); err != nil {
+		return err
+	}
+
+	wr.loaded = true
+
+	return nil
+}
+
+func (wr *webhookRepo) readSubscriptions() error {
+	data, err := ioutil.ReadFile(filepath.Join(wr.storage, webhookSubscriptionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &wr.subscriptions)
+}
+
+func (wr *webhookRepo) writeSubscriptions() error {
+	data, err := json.Marshal(wr.subscriptions)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(wr.storage, webhookSubscriptionsFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// readOutbox reads outbox log, the last line of delivery is its current state
+func (wr *webhookRepo) readOutbox() error {
+	return readLines(filepath.Join(wr.storage, webhookOutboxFile), func(line []byte) error {
+		var delivery WebhookDelivery
+
+		if err := json.Unmarshal(line, &delivery); err != nil {
+			return err
+		}
+
+		wr.put(delivery)
+		wr.lines++
+
+		return nil
+	})
+}
+
+func (wr *webhookRepo) put(delivery WebhookDelivery) {
+	if _, ok := wr.deliveries[delivery.ID]; !ok {
+		wr.order = append(wr.order, delivery.ID)
+	}
+
+	wr.deliveries[delivery.ID] = delivery
+}
+
+// compact drops finished deliveries older than retention and rewrites outbox with current states only
+func (wr *webhookRepo) compact() error {
+	var (
+		kept   = wr.order[:0]
+		oldest = wr.clock.Now().Add(-wr.retention)
+	)
+
+	for _, id := range wr.order {
+		delivery := wr.deliveries[id]
+		if delivery.State != DeliveryPending && delivery.State != DeliveryHeld && delivery.Updated.Before(oldest) {
+			delete(wr.deliveries, id)
+			continue
+		}
+
+		kept = append(kept, id)
+	}
+
+	wr.order = kept
+
+	path := filepath.Join(wr.storage, webhookOutboxFile)
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+
+	for _, id := range wr.order {
+		if err := encoder.Encode(wr.deliveries[id]); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	wr.lines = len(wr.order)
+
+	return os.Rename(path+".tmp", path)
+}
+
+// appendOutbox appends deliveries to outbox and syncs it, so they are not lost on restart
+func (wr *webhookRepo) appendOutbox(deliveries ...WebhookDelivery) error {
+	file, err := os.OpenFile(filepath.Join(wr.storage, webhookOutboxFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	encoder := json.NewEncoder(file)
+
+	for _, delivery := range deliveries {
+		if err := encoder.Encode(delivery); err != nil {
+			return err
+		}
+
+		wr.lines++
+	}
+
+	return file.Sync()
+}
+
+func (wr *webhookRepo) AddSubscription(sub WebhookSubscription) (WebhookSubscription, error) {
+	var err error
+
+	if err = wr.load(); err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	if sub.ID, err = newID(); err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	wr.subscriptions = append(wr.subscriptions, sub)
+
+	if err := wr.writeSubscriptions(); err != nil {
+		wr.subscriptions = wr.subscriptions[:len(wr.subscriptions)-1]
+		return WebhookSubscription{}, err
+	}
+
+	return sub, nil
+}
+
+func (wr *webhookRepo) DeleteSubscription(id string) error {
+	if err := wr.load(); err != nil {
+		return err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	for i, sub := range wr.subscriptions {
+		if sub.ID == id {
+			wr.subscriptions = append(wr.subscriptions[:i:i], wr.subscriptions[i+1:]...)
+			return wr.writeSubscriptions()
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (wr *webhookRepo) Subscriptions() ([]WebhookSubscription, error) {
+	if err := wr.load(); err != nil {
+		return nil, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	return append([]WebhookSubscription(nil), wr.subscriptions...), nil
+}
+
+func (wr *webhookRepo) Enqueue(deliveries ...WebhookDelivery) ([]WebhookDelivery, error) {
+	if err := wr.load(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]WebhookDelivery, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		var err error
+
+		if delivery.ID, err = newID(); err != nil {
+			return nil, err
+		}
+
+		if delivery.State == "" {
+			delivery.State = DeliveryPending
+		}
+
+		ret = append(ret, delivery)
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if err := wr.appendOutbox(ret...); err != nil {
+		return nil, err
+	}
+
+	for _, delivery := range ret {
+		wr.put(delivery)
+	}
+
+	return ret, nil
+}
+
+func (wr *webhookRepo) Due(now time.Time) ([]WebhookDelivery, error) {
+	if err := wr.load(); err != nil {
+		return nil, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	var ret []WebhookDelivery
+
+	for _, id := range wr.order {
+		delivery := wr.deliveries[id]
+		due := delivery.State == DeliveryPending || delivery.State == DeliveryHeld
+		if due && !delivery.NextAttempt.After(now) {
+			ret = append(ret, delivery)
+		}
+	}
+
+	return ret, nil
+}
+
+func (wr *webhookRepo) UpdateDelivery(delivery WebhookDelivery) error {
+	if err := wr.load(); err != nil {
+		return err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if _, ok := wr.deliveries[delivery.ID]; !ok {
+		return ErrNotFound
+	}
+
+	if err := wr.appendOutbox(delivery); err != nil {
+		return err
+	}
+
+	wr.put(delivery)
+
+	// outbox keeps every state of delivery, so it is compacted when old states take most of it
+	if wr.lines > 2*len(wr.order)+1000 {
+		return wr.compact()
+	}
+
+	return nil
+}
+
+func (wr *webhookRepo) GetDelivery(id string) (WebhookDelivery, error) {
+	if err := wr.load(); err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	delivery, ok := wr.deliveries[id]
+	if !ok {
+		return WebhookDelivery{}, ErrNotFound
+	}
+
+	return delivery, nil
+}
+
+func (wr *webhookRepo) LookUpDeliveries(conditions DeliveryConditions) ([]WebhookDelivery, error) {
+	if err := wr.load(); err != nil {
+		return nil, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	var ret []WebhookDelivery
+
+	for _, id := range wr.order {
+		delivery := wr.deliveries[id]
+
+		switch {
+		case conditions.State != "" && delivery.State != conditions.State:
+		case conditions.SubscriptionID != "" && delivery.SubscriptionID != conditions.SubscriptionID:
+		default:
+			ret = append(ret, delivery)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+
+	return ret, nil
+}
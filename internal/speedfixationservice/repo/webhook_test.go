@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+func Test_webhookRepo(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	wr := NewTestWebhookRepository(tempDir, time.Hour, clock.System)
+
+	sub, err := wr.AddSubscription(WebhookSubscription{URL: "http://localhost/hook", Secret: "s", MinSpeed: 90})
+	require.NoError(t, err)
+	require.NotEmpty(t, sub.ID)
+
+	now := time.Now().UTC()
+
+	deliveries, err := wr.Enqueue(
+		WebhookDelivery{SubscriptionID: sub.ID, URL: sub.URL, Payload: []byte(`{}`), NextAttempt: now, Created: now, Updated: now},
+		WebhookDelivery{SubscriptionID: sub.ID, URL: sub.URL, Payload: []byte(`{}`), NextAttempt: now.Add(time.Hour),
+			Created: now, Updated: now},
+	)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, DeliveryPending, deliveries[0].State)
+
+	due, err := wr.Due(now)
+	require.NoError(t, err)
+	require.Equal(t, deliveries[:1], due)
+
+	delivered := deliveries[0]
+	delivered.State, delivered.Attempts = DeliveryDelivered, 1
+	require.NoError(t, wr.UpdateDelivery(delivered))
+
+	// old delivered deliveries are dropped after restart, pending ones are kept
+	old := deliveries[1]
+	old.State, old.Updated = DeliveryDead, now.Add(-2*time.Hour)
+	require.NoError(t, wr.UpdateDelivery(old))
+
+	wr = NewTestWebhookRepository(tempDir, time.Hour, clock.System)
+
+	got, err := wr.LookUpDeliveries(DeliveryConditions{})
+	require.NoError(t, err)
+	require.Equal(t, []WebhookDelivery{delivered}, got)
+
+	_, err = wr.GetDelivery(old.ID)
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	subs, err := wr.Subscriptions()
+	require.NoError(t, err)
+	require.Equal(t, []WebhookSubscription{sub}, subs)
+
+	require.NoError(t, wr.DeleteSubscription(sub.ID))
+	require.True(t, errors.Is(wr.DeleteSubscription(sub.ID), ErrNotFound))
+}
+
+func Test_webhookRepo_TornOutbox(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	var (
+		now = time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+		clk = clock.NewFake(now)
+		wr  = NewTestWebhookRepository(tempDir, time.Hour, clk)
+	)
+
+	// outbox which can not be read fails load, the failure is not remembered
+	path := filepath.Join(tempDir, webhookOutboxFile)
+	require.NoError(t, os.Mkdir(path, 0700))
+
+	_, err := wr.Enqueue(WebhookDelivery{URL: "http://localhost/hook", Payload: []byte(`{}`), NextAttempt: now})
+	require.Error(t, err)
+
+	require.NoError(t, os.Remove(path))
+
+	deliveries, err := wr.Enqueue(WebhookDelivery{URL: "http://localhost/hook", Payload: []byte(`{}`), NextAttempt: now})
+	require.NoError(t, err)
+
+	// crash during append cuts the last line, it is skipped and dropped by compaction
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	wr = NewTestWebhookRepository(tempDir, time.Hour, clk)
+
+	more, err := wr.Enqueue(WebhookDelivery{URL: "http://localhost/hook", Payload: []byte(`{}`), NextAttempt: now})
+	require.NoError(t, err)
+
+	wr = NewTestWebhookRepository(tempDir, time.Hour, clk)
+
+	due, err := wr.Due(now)
+	require.NoError(t, err)
+	require.Equal(t, append(deliveries, more...), due)
+
+	// broken line in the middle of outbox is not skipped
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, append([]byte("{\"id\":\n"), data...), 0644))
+
+	_, err = NewTestWebhookRepository(tempDir, time.Hour, clk).Due(now)
+	require.Error(t, err)
+}
@@ -0,0 +1,88 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/env"
+)
+
+// offenderReports periodically writes repeat offenders report to disk until stop is closed,
+// reporting is disabled when offenderReportInterval is not positive
+func (srv service) offenderReports(stop <-chan struct{}) {
+	interval := env.GetDuration("offenderReportInterval", 24*time.Hour)
+	if interval <= 0 {
+		return
+	}
+
+	dir := env.GetString("offenderReportDir", filepath.Join("internal", "speedfixationservice", "reports"))
+
+	conditions := repo.RepeatOffenderConditions{
+		Days:       env.GetInt("offenderReportDays", 30),
+		Speed:      env.GetFloat("offenderReportSpeed", 60),
+		Violations: env.GetInt("offenderReportViolations", 3),
+	}
+
+	// report which is being written when service stops is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// report is named by the UTC day like the files of fixations
+		conditions.Date = srv.now().UTC()
+
+		if err := srv.writeOffenderReport(ctx, dir, conditions); err != nil {
+			log.Println("unable write repeat offenders report:", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srv service) writeOffenderReport(ctx context.Context, dir string, conditions repo.RepeatOffenderConditions) error {
+	offenders, err := srv.uc.LookUpRepeatOffenders(ctx, conditions)
+	if err != nil {
+		return err
+	}
+
+	report, err := json.Marshal(struct {
+		Conditions repo.RepeatOffenderConditions `json:"conditions"`
+		Offenders  []repo.Offender               `json:"offenders"`
+	}{
+		Conditions: conditions,
+		Offenders:  offenders,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	fileName := "repeat_offenders_" + conditions.Date.Format("02.01.2006") + ".json"
+
+	return ioutil.WriteFile(filepath.Join(dir, fileName), report, 0644)
+}
@@ -0,0 +1,196 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// legacyDateLayout is the date layout of old cameras which send dates without time zone
+const legacyDateLayout = "02.01.2006 15:04:05"
+
+// FieldError describes invalid field of request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError contains all invalid fields of request
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// registration is the fixation sent by camera either in form values or in JSON body
+type registration struct {
+	Date          string      `json:"date"`
+	VehicleNumber string      `json:"vehicle_number"`
+	Speed         json.Number `json:"speed"`
+	Camera        string      `json:"camera"`
+	// Signature is evidence signature of fixation made by camera
+	Signature string `json:"signature"`
+}
+
+func mediaType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mt
+}
+
+func isJSON(r *http.Request) bool {
+	return mediaType(r) == "application/json"
+}
+
+func isNDJSON(r *http.Request) bool {
+	mt := mediaType(r)
+	return mt == "application/x-ndjson" || mt == "application/ndjson"
+}
+
+// decodeRegistration reads registration from JSON body or from form values depending on content type
+func decodeRegistration(r *http.Request) (registration, error) {
+	var reg registration
+
+	if isJSON(r) {
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			return registration{}, &ValidationError{Errors: []FieldError{{Field: "body", Message: "unable parse json"}}}
+		}
+
+		return reg, nil
+	}
+
+	reg.Date = r.FormValue("date")
+	reg.VehicleNumber = r.FormValue("vehicle_number")
+	reg.Speed = json.Number(r.FormValue("speed"))
+	reg.Camera = r.FormValue("camera")
+	reg.Signature = r.FormValue("signature")
+
+	return reg, nil
+}
+
+// parseDate parses RFC 3339 dates with offset and optional fractional seconds and dates of old cameras,
+// the result is always in UTC
+func parseDate(datetime string) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339Nano, datetime)
+	if err != nil {
+		if date, err = time.Parse(legacyDateLayout, datetime); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return date.UTC(), nil
+}
+
+// fixation validates all fields of registration and converts it to the fixation
+func (reg registration) fixation() (repo.SpeedFixation, error) {
+	var (
+		ret  = repo.SpeedFixation{VehicleNumber: reg.VehicleNumber, Camera: reg.Camera}
+		verr ValidationError
+		err  error
+	)
+
+	if reg.Date == "" {
+		verr.add("date", "datetime not defined in this request")
+	} else if ret.Date, err = parseDate(reg.Date); err != nil {
+		verr.add("date", "unable parse datetime, expected RFC 3339 or "+legacyDateLayout)
+	}
+
+	if reg.VehicleNumber == "" {
+		verr.add("vehicle_number", "vehicle number not defined in this request")
+	}
+
+	if ret.Speed, err = strconv.ParseFloat(reg.Speed.String(), 64); err != nil {
+		verr.add("speed", "unable parse speed")
+	} else if ret.Speed == 0 {
+		verr.add("speed", "speed not defined in this request")
+	}
+
+	if len(verr.Errors) > 0 {
+		return repo.SpeedFixation{}, &verr
+	}
+
+	return ret, nil
+}
+
+// batchItems splits body of batch request, which is JSON array or NDJSON stream, into items,
+// zero maxSize does not limit batch
+func batchItems(r *http.Request, body io.Reader, maxSize int) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+
+	switch {
+	case isNDJSON(r):
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				items = append(items, append(json.RawMessage(nil), line...))
+			}
+
+			if maxSize > 0 && len(items) > maxSize {
+				break
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "body", Message: "unable read ndjson"}}}
+		}
+	case isJSON(r):
+		if err := json.NewDecoder(body).Decode(&items); err != nil {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "body", Message: "unable parse json array"}}}
+		}
+	default:
+		return nil, &ValidationError{Errors: []FieldError{{Field: "body",
+			Message: "content type must be application/json or application/x-ndjson"}}}
+	}
+
+	if maxSize > 0 && len(items) > maxSize {
+		return nil, &ValidationError{Errors: []FieldError{{Field: "body",
+			Message: "batch is larger than " + strconv.Itoa(maxSize) + " items"}}}
+	}
+
+	return items, nil
+}
+
+// decodeBatch reads registrations from JSON array or NDJSON stream, items which cannot
+// be decoded are returned with not nil error at the same position, zero maxSize does not limit batch
+func decodeBatch(r *http.Request, maxSize int) ([]registration, []error, error) {
+	items, err := batchItems(r, r.Body, maxSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	regs := make([]registration, len(items))
+	errs := make([]error, len(items))
+
+	for i, item := range items {
+		if err := json.Unmarshal(item, &regs[i]); err != nil {
+			errs[i] = &ValidationError{Errors: []FieldError{{Field: "body", Message: "unable parse json"}}}
+		}
+	}
+
+	return regs, errs, nil
+}
@@ -0,0 +1,232 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// apiPrefix is the path prefix of the current API version
+const apiPrefix = "/v1"
+
+// methods routes request to the handler of its method, other methods get 405 with Allow header
+type methods map[string]http.Handler
+
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	allow := make([]string, 0, len(m)+1)
+	for method := range m {
+		allow = append(allow, method)
+	}
+
+	allow = append(allow, http.MethodOptions)
+	sort.Strings(allow)
+
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	responseError(w, errMethodNotAllowed)
+}
+
+// route is the operation of the specification served by handler
+type route struct {
+	path    string
+	method  string
+	handler http.Handler
+	// limited routes work only in service hours
+	limited bool
+	// aliases are deprecated paths of the route
+	aliases []string
+	// synonyms are other current paths of the route, they are served without deprecation
+	synonyms []string
+	// roles are roles of users allowed to use the route, empty roles allow everyone
+	roles []string
+	// streaming routes keep connection open, they have no timeout
+	streaming bool
+	// camera routes are registrations sent by cameras, they pass camera authentication,
+	// ingestion rate limit, idempotency keys and dead letters
+	camera bool
+}
+
+// routePath returns path of the route relative to API version, so legacy aliases and /v1 paths are the same route
+func routePath(path string) string {
+	if strings.HasPrefix(path, apiPrefix+"/") {
+		return strings.TrimPrefix(path, apiPrefix)
+	}
+
+	return path
+}
+
+func (srv *service) routes() []route {
+	return []route{
+		{path: "/register", method: http.MethodPost, handler: http.HandlerFunc(srv.registerSpeed), camera: true,
+			aliases: []string{"/register"}},
+		{path: "/register/batch", method: http.MethodPost, handler: http.HandlerFunc(srv.registerBatch), camera: true,
+			aliases: []string{"/register/batch"}},
+		{path: "/overspeed", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.overSpeed)),
+			limited: true, aliases: []string{"/overspeed"}, roles: queryRoles},
+		{path: "/minmaxspeed", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.minMaxSpeed)),
+			limited: true, aliases: []string{"/minmaxspeed"}, roles: queryRoles},
+		{path: "/statistics", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.speedStatistics)),
+			limited: true, synonyms: []string{"/v2/minmaxspeed"}, roles: queryRoles},
+		{path: "/repeatoffenders", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.repeatOffenders)),
+			limited: true, aliases: []string{"/repeatoffenders"}, roles: queryRoles},
+		{path: "/platesearch", method: http.MethodGet, handler: http.HandlerFunc(srv.plateSearch), limited: true,
+			aliases: []string{"/platesearch"}, roles: officerRoles},
+		{path: "/search", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.search)), limited: true,
+			aliases: []string{"/search"}, roles: queryRoles},
+		{path: "/flagged", method: http.MethodGet, handler: srv.pseudonymize(http.HandlerFunc(srv.flagged)), limited: true,
+			aliases: []string{"/flagged"}, roles: queryRoles},
+		{path: "/validationstats", method: http.MethodGet, handler: http.HandlerFunc(srv.validationStats), limited: true,
+			aliases: []string{"/validationstats"}, roles: queryRoles},
+		{path: "/admin/deadletters", method: http.MethodGet, handler: http.HandlerFunc(srv.deadLetterList),
+			aliases: []string{"/admin/deadletters"}, roles: adminRoles},
+		{path: "/admin/deadletters/replay", method: http.MethodPost, handler: http.HandlerFunc(srv.deadLetterReplay),
+			aliases: []string{"/admin/deadletters/replay"}, roles: adminRoles},
+		{path: "/admin/ratelimits", method: http.MethodGet, handler: http.HandlerFunc(srv.rateLimitStats),
+			roles: adminRoles},
+		{path: "/admin/audit", method: http.MethodGet, handler: http.HandlerFunc(srv.auditList), roles: adminRoles},
+		{path: "/admin/webhooks", method: http.MethodGet, handler: http.HandlerFunc(srv.webhookList), roles: adminRoles},
+		{path: "/admin/webhooks", method: http.MethodPost, handler: http.HandlerFunc(srv.webhookCreate), roles: adminRoles},
+		{path: "/admin/webhooks", method: http.MethodDelete, handler: http.HandlerFunc(srv.webhookDelete), roles: adminRoles},
+		{path: "/admin/webhooks/deliveries", method: http.MethodGet, handler: http.HandlerFunc(srv.webhookDeliveries),
+			roles: adminRoles},
+		{path: "/admin/webhooks/deliveries/retry", method: http.MethodPost, handler: http.HandlerFunc(srv.webhookRetry),
+			roles: adminRoles},
+		{path: "/admin/cameras", method: http.MethodGet, handler: http.HandlerFunc(srv.cameraList), roles: adminRoles},
+		{path: "/admin/cameras/keys", method: http.MethodPost, handler: http.HandlerFunc(srv.cameraKeyIssue),
+			roles: adminRoles},
+		{path: "/admin/cameras/keys", method: http.MethodDelete, handler: http.HandlerFunc(srv.cameraKeyRevoke),
+			roles: adminRoles},
+		{path: "/admin/cameras/keys/rotate", method: http.MethodPost, handler: http.HandlerFunc(srv.cameraKeyRotate),
+			roles: adminRoles},
+		{path: "/admin/cameras/publickeys", method: http.MethodPost, handler: http.HandlerFunc(srv.cameraPublicKeyAdd),
+			roles: adminRoles},
+		{path: "/admin/cameras/publickeys", method: http.MethodDelete, handler: http.HandlerFunc(srv.cameraPublicKeyRevoke),
+			roles: adminRoles},
+		{path: "/evidence/verify", method: http.MethodGet, handler: http.HandlerFunc(srv.evidenceVerify),
+			roles: officerRoles},
+		{path: "/feed", method: http.MethodGet, handler: http.HandlerFunc(srv.feedEvents), limited: true,
+			roles: queryRoles, streaming: true},
+		{path: "/feed/ws", method: http.MethodGet, handler: http.HandlerFunc(srv.feedWebSocket), limited: true,
+			roles: queryRoles, streaming: true},
+		{path: "/openapi.json", method: http.MethodGet, handler: http.HandlerFunc(openAPI)},
+	}
+}
+
+// deprecated marks responses of legacy paths with the path which replaces them
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handler creates handler of all routes, every route must be described in the specification
+func (srv *service) handler() (http.Handler, error) {
+	spec, err := parseSpec(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mux      = http.NewServeMux()
+		paths    = make(map[string]methods)
+		aliases  = make(map[string]string)
+		synonyms = make(map[string]string)
+		limited  = make(map[string]bool)
+		order    []string
+	)
+
+	for _, rt := range srv.routes() {
+		op, err := spec.operation(rt.path, rt.method)
+		if err != nil {
+			return nil, err
+		}
+
+		h := rt.handler
+		if rt.camera {
+			// registrations rejected by validation are kept as dead letters too, budget of camera
+			// is spent before the body is read
+			h = srv.ingestionLimit(srv.limitBody(srv.cameraAuthMiddleware(
+				srv.idempotentMiddleware(srv.deadLetterMiddleware(op.validate(h))))))
+		}
+
+		if !rt.streaming {
+			h = srv.timeout(rt.path, h)
+		}
+
+		if rt.limited {
+			h = srv.checkTimeMiddleware(rt.path, h)
+			limited[rt.path] = true
+		}
+
+		if _, ok := paths[rt.path]; !ok {
+			paths[rt.path] = make(methods)
+			order = append(order, rt.path)
+		}
+
+		if !rt.camera {
+			h = op.validate(h)
+		}
+
+		if len(rt.roles) > 0 {
+			h = srv.audit(srv.authorize(rt.roles, srv.rateLimit(srv.queryLimits, srv.limitBody(h))))
+		} else if !rt.camera {
+			h = srv.limitBody(h)
+		}
+
+		paths[rt.path][rt.method] = h
+
+		for _, alias := range rt.aliases {
+			aliases[alias] = rt.path
+		}
+
+		for _, synonym := range rt.synonyms {
+			synonyms[synonym] = rt.path
+		}
+	}
+
+	// schedule of route which has no service hours would be ignored silently
+	for _, route := range srv.schedules.Routes() {
+		if !limited[route] {
+			return nil, errors.New("schedule of unknown route", j.KV("route", route))
+		}
+	}
+
+	for _, path := range order {
+		mux.Handle(apiPrefix+path, paths[path])
+	}
+
+	for alias, path := range aliases {
+		mux.Handle(alias, deprecated(apiPrefix+path, paths[path]))
+	}
+
+	for synonym, path := range synonyms {
+		mux.Handle(synonym, paths[path])
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		responseError(w, errPageNotFound)
+	})
+
+	return requestIDMiddleware(mux), nil
+}
+
+func openAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(openAPISpec))
+}
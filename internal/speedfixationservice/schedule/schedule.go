@@ -0,0 +1,324 @@
+// Package schedule provides service hours of routes with weekday rules, windows crossing midnight,
+// time zone and holiday calendar
+package schedule
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// Layouts of holidays, annual holidays have no year
+const (
+	dateLayout   = "2006-01-02"
+	annualLayout = "01-02"
+)
+
+// maxDays limits search of the next opening, schedule closed for a year is considered closed forever
+const maxDays = 400
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Rule opens service on days during hours. Days are "*", names like "sat,sun" or ranges like "mon-fri".
+// Hours are "09:30-22:00", window with end not after start like "22:00-06:00" crosses midnight
+// and belongs to the day it starts.
+type Rule struct {
+	Days  string `json:"days"`
+	Hours string `json:"hours"`
+}
+
+// Config describes service hours, routes without own rules use Rules. Holidays are dates
+// "2006-01-02" or annual dates "01-02", windows starting on holidays are closed.
+type Config struct {
+	TimeZone string            `json:"time_zone"`
+	Holidays []string          `json:"holidays"`
+	Rules    []Rule            `json:"rules"`
+	Routes   map[string][]Rule `json:"routes"`
+}
+
+// window is the opening interval in minutes since midnight of the day it starts
+type window struct {
+	start, end int
+}
+
+// Schedule tells whether service is open, nil schedule is always open
+type Schedule struct {
+	loc      *time.Location
+	holidays map[string]bool
+	windows  [7][]window
+}
+
+// Set keeps schedules of routes
+type Set struct {
+	fallback *Schedule
+	routes   map[string]*Schedule
+}
+
+// Load reads configuration from JSON
+func Load(r io.Reader) (Config, error) {
+	var config Config
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// New creates schedules of configuration, empty time zone is UTC
+func New(config Config) (*Set, error) {
+	loc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return nil, errors.Wrap(err, "unknown time zone", j.KV("time_zone", config.TimeZone))
+	}
+
+	holidays := make(map[string]bool, len(config.Holidays))
+
+	for _, day := range config.Holidays {
+		if _, err := time.Parse(dateLayout, day); err != nil {
+			if _, err := time.Parse(annualLayout, day); err != nil {
+				return nil, errors.New("invalid holiday", j.KV("holiday", day))
+			}
+		}
+
+		holidays[day] = true
+	}
+
+	set := &Set{routes: make(map[string]*Schedule, len(config.Routes))}
+
+	if set.fallback, err = newSchedule(loc, holidays, config.Rules); err != nil {
+		return nil, err
+	}
+
+	for route, rules := range config.Routes {
+		if set.routes[route], err = newSchedule(loc, holidays, rules); err != nil {
+			return nil, errors.Wrap(err, "invalid route schedule", j.KV("route", route))
+		}
+	}
+
+	return set, nil
+}
+
+// Location returns time zone of schedules, it is UTC for nil set
+func (s *Set) Location() *time.Location {
+	if s == nil {
+		return time.UTC
+	}
+
+	return s.fallback.loc
+}
+
+func newSchedule(loc *time.Location, holidays map[string]bool, rules []Rule) (*Schedule, error) {
+	s := &Schedule{loc: loc, holidays: holidays}
+
+	for _, rule := range rules {
+		days, err := parseDays(rule.Days)
+		if err != nil {
+			return nil, err
+		}
+
+		w, err := parseHours(rule.Hours)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, day := range days {
+			s.windows[day] = append(s.windows[day], w)
+		}
+	}
+
+	for day := range s.windows {
+		sort.Slice(s.windows[day], func(i, k int) bool {
+			return s.windows[day][i].start < s.windows[day][k].start
+		})
+	}
+
+	return s, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	if strings.TrimSpace(s) == "*" {
+		return []time.Weekday{0, 1, 2, 3, 4, 5, 6}, nil
+	}
+
+	var ret []time.Weekday
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.ToLower(strings.TrimSpace(part)), "-", 2)
+
+		from, ok := weekdays[bounds[0]]
+		to := from
+
+		if ok && len(bounds) == 2 {
+			to, ok = weekdays[bounds[1]]
+		}
+
+		if !ok {
+			return nil, errors.New("invalid days", j.KV("days", s))
+		}
+
+		// range can wrap over the end of week like fri-mon
+		for day := from; ; day = (day + 1) % 7 {
+			ret = append(ret, day)
+
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// parseMinute parses time of day "15:04", "24:00" is the end of day
+func parseMinute(s string) (int, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, false
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, false
+	}
+
+	return h*60 + m, true
+}
+
+func parseHours(s string) (window, error) {
+	bounds := strings.Split(s, "-")
+	if len(bounds) != 2 {
+		return window{}, errors.New("invalid hours", j.KV("hours", s))
+	}
+
+	start, ok := parseMinute(bounds[0])
+	end, ok2 := parseMinute(bounds[1])
+
+	if !ok || !ok2 || start == end || start == 24*60 {
+		return window{}, errors.New("invalid hours", j.KV("hours", s))
+	}
+
+	return window{start: start, end: end}, nil
+}
+
+// Routes returns sorted routes which have own schedules
+func (s *Set) Routes() []string {
+	if s == nil {
+		return nil
+	}
+
+	routes := make([]string, 0, len(s.routes))
+	for route := range s.routes {
+		routes = append(routes, route)
+	}
+
+	sort.Strings(routes)
+
+	return routes
+}
+
+// Route returns schedule of the route
+func (s *Set) Route(route string) *Schedule {
+	if s == nil {
+		return nil
+	}
+
+	if sch, ok := s.routes[route]; ok {
+		return sch
+	}
+
+	return s.fallback
+}
+
+// day returns noon of the day offset days after now, noon exists on days of daylight saving time change
+func (s *Schedule) day(now time.Time, offset int) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+offset, 12, 0, 0, 0, s.loc)
+}
+
+func (s *Schedule) holiday(day time.Time) bool {
+	return s.holidays[day.Format(dateLayout)] || s.holidays[day.Format(annualLayout)]
+}
+
+// interval returns opening and closing time of window of the day, dates are normalized
+// by time.Date, so windows follow changes of daylight saving time
+func (s *Schedule) interval(day time.Time, w window) (time.Time, time.Time) {
+	y, m, d := day.Date()
+	open := time.Date(y, m, d, w.start/60, w.start%60, 0, 0, s.loc)
+
+	if w.end <= w.start {
+		d++
+	}
+
+	return open, time.Date(y, m, d, w.end/60, w.end%60, 0, 0, s.loc)
+}
+
+// Open reports whether service is open at the moment
+func (s *Schedule) Open(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	now = now.In(s.loc)
+
+	// windows of the previous day can cross midnight
+	for _, day := range []time.Time{s.day(now, -1), s.day(now, 0)} {
+		if s.holiday(day) {
+			continue
+		}
+
+		for _, w := range s.windows[day.Weekday()] {
+			if open, end := s.interval(day, w); !now.Before(open) && now.Before(end) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Next returns the nearest opening after now, false is returned when service does not open
+func (s *Schedule) Next(now time.Time) (time.Time, bool) {
+	if s == nil {
+		return now, true
+	}
+
+	now = now.In(s.loc)
+
+	for i := 0; i < maxDays; i++ {
+		day := s.day(now, i)
+		if s.holiday(day) {
+			continue
+		}
+
+		for _, w := range s.windows[day.Weekday()] {
+			if open, _ := s.interval(day, w); open.After(now) {
+				return open, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,96 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	config, err := Load(strings.NewReader(`{
+		"time_zone": "Europe/Berlin",
+		"holidays": ["2019-12-27", "01-01"],
+		"rules": [
+			{"days": "mon-fri", "hours": "09:30-18:00"},
+			{"days": "fri-sat", "hours": "22:00-02:00"}
+		],
+		"routes": {"/feed": [{"days": "*", "hours": "00:00-24:00"}]}
+	}`))
+	require.NoError(t, err)
+
+	set, err := New(config)
+	require.NoError(t, err)
+
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	at := func(s string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		require.NoError(t, err)
+
+		return ts
+	}
+
+	sch := set.Route("/search")
+
+	tests := []struct {
+		now  string
+		open bool
+		next string
+	}{
+		// thursday, minutes are respected
+		{now: "2019-12-26 09:29", next: "2019-12-26 09:30"},
+		{now: "2019-12-26 09:30", open: true},
+		{now: "2019-12-26 18:00", next: "2019-12-28 22:00"},
+		// friday is holiday, its night window is closed too, saturday night window crosses midnight
+		{now: "2019-12-27 12:00", next: "2019-12-28 22:00"},
+		{now: "2019-12-29 01:59", open: true},
+		{now: "2019-12-29 02:00", next: "2019-12-30 09:30"},
+		// annual holiday
+		{now: "2020-01-01 12:00", next: "2020-01-02 09:30"},
+	}
+
+	for _, tt := range tests {
+		now := at(tt.now)
+		require.Equal(t, tt.open, sch.Open(now), tt.now)
+
+		if !tt.open {
+			next, ok := sch.Next(now)
+			require.True(t, ok)
+			require.Equal(t, at(tt.next), next, tt.now)
+		}
+	}
+
+	// time zone of schedule is used whatever the zone of time is
+	require.True(t, sch.Open(at("2019-12-26 09:30").UTC()))
+
+	// holidays close routes with own rules too
+	require.True(t, set.Route("/feed").Open(at("2019-12-26 03:00")))
+	require.False(t, set.Route("/feed").Open(at("2019-12-27 03:00")))
+
+	var always *Set
+	require.True(t, always.Route("/search").Open(time.Now()))
+
+	closed, err := New(Config{})
+	require.NoError(t, err)
+
+	_, ok := closed.Route("/search").Next(time.Now())
+	require.False(t, ok)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, config := range []Config{
+		{TimeZone: "Mars/Olympus"},
+		{Holidays: []string{"31.12.2019"}},
+		{Rules: []Rule{{Days: "mon-fry", Hours: "09:00-18:00"}}},
+		{Rules: []Rule{{Days: "*", Hours: "9-18"}}},
+		{Rules: []Rule{{Days: "*", Hours: "09:00-09:00"}}},
+		{Rules: []Rule{{Days: "*", Hours: "09:00-24:01"}}},
+		{Routes: map[string][]Rule{"/feed": {{Days: "*", Hours: "25:00-26:00"}}}},
+	} {
+		_, err := New(config)
+		require.Error(t, err, config)
+	}
+}
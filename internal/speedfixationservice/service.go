@@ -2,121 +2,419 @@
 package speedfixationservice
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"flag"
-	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/luno/jettison/errors"
 
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/evidence"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/feed"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/platesearch"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/ratelimit"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/schedule"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/tlscert"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/usecase"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/webhook"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
 	"github.com/IgorRybak2055/speed-control-service/pkg/env"
 )
 
 var (
 	// httpAddr - server address in network
 	httpAddr = flag.String("addr", ":8001", "server addr")
+	// grpcAddr - gRPC server address in network
+	grpcAddr = flag.String("grpc-addr", ":8002", "gRPC server addr")
 )
 
 type service struct {
+	// clock tells the current time, nil clock is the system one
+	clock clock.Clock
 	uc    usecase.SpeedControl
-	start time.Time
-	end   time.Time
+	// schedules are service hours of limited routes, nil schedules do not limit routes
+	schedules   *schedule.Set
+	confusions  platesearch.ConfusionTable
+	keys        repo.IdempotencyRepo
+	deadLetters repo.DeadLetterRepo
+
+	feed          *feed.Hub
+	feedHeartbeat time.Duration
+	webhooks      *webhook.Dispatcher
+
+	// cameras manage camera keys even when signatures of registrations are not verified
+	cameras *camauth.Keyring
+	// cameraAuth enables verification of camera signatures
+	cameraAuth bool
+	// cameraAuthRequired rejects unsigned registrations, otherwise only signed ones are verified
+	cameraAuthRequired bool
+	evidence           *evidence.Verifier
+
+	// tokens validate bearer tokens of query users, nil tokens open query routes and close the others
+	tokens       *jwt.KeySet
+	pseudonymKey []byte
+	audits       repo.AuditRepo
+	// certs is nil when HTTP server works in plain text
+	certs *tlscert.Reloader
+	// clientCerts enables mutual TLS, registrations are authorized by client certificate of camera
+	clientCerts bool
+	cameraRepo  repo.CameraRepo
+	// ingestionLimits and queryLimits are separate budgets of clients, nil limiter does not limit
+	ingestionLimits *ratelimit.Limiter
+	queryLimits     *ratelimit.Limiter
+	// maxBodySize is the limit of request body in bytes, zero does not limit it
+	maxBodySize int64
+	// batchMaxSize is the limit of fixations in batch, zero does not limit it
+	batchMaxSize int
+	// plateSearchDistance and plateSearchLimit are defaults of plate search, zero limit returns all candidates
+	plateSearchDistance float64
+	plateSearchLimit    int
+	// searchMaxDays is the limit of search date range, zero does not limit it
+	searchMaxDays int
+	timeouts      endpointTimeouts
 }
 
 // Run start service
 func Run() {
 	var (
-		srv service
+		srv = service{clock: clock.System}
 		err error
 	)
 
-	srv.start, err = time.Parse(time.Kitchen, env.GetString("startWork", "12:00AM"))
+	srv.schedules, err = serviceSchedules()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	srv.end, err = time.Parse(time.Kitchen, env.GetString("endWork", "11:00PM"))
+	srv.confusions, err = platesearch.ParseConfusionTable(env.GetString("plateConfusions", platesearch.DefaultConfusions))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sfr := repo.NewSpeedFixationRepository()
-	srv.uc = usecase.NewSpeedFixationUsecase(sfr)
+	pv, err := plate.NewValidator(env.GetString("plateFormats", plate.DefaultRules))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	srv.serviceHandlers()
-}
+	vp, err := validationPipeline()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv.feed = feed.NewHub(env.GetInt("feedBufferSize", 1000), srv.clock)
+	srv.feedHeartbeat = env.GetDuration("feedHeartbeat", defaultFeedHeartbeat)
+
+	static, err := staticWebhooks()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv.webhooks = webhook.NewDispatcher(repo.NewWebhookRepository(env.GetDuration("webhookRetention", 7*24*time.Hour), srv.clock),
+		srv.clock, webhook.Config{
+			MaxAttempts:  env.GetInt("webhookMaxAttempts", 8),
+			BaseDelay:    env.GetDuration("webhookBaseDelay", 10*time.Second),
+			MaxDelay:     env.GetDuration("webhookMaxDelay", time.Hour),
+			PollInterval: env.GetDuration("webhookPollInterval", 5*time.Second),
+			Timeout:      env.GetDuration("webhookTimeout", 10*time.Second),
+		}, static...)
+
+	cameras := repo.NewCameraRepository()
+	srv.cameraRepo = cameras
+	srv.evidence = evidence.NewVerifier(cameras, srv.clock)
+	srv.cameras = camauth.NewKeyring(cameras, env.GetDuration("cameraAuthWindow", 5*time.Minute), srv.clock)
+
+	switch mode := env.GetString("cameraAuth", "required"); mode {
+	case "required", "optional":
+		srv.cameraAuth = true
+		srv.cameraAuthRequired = mode == "required"
+	case "off":
+	default:
+		log.Fatal("unknown camera authentication mode " + mode)
+	}
+
+	if srv.tokens, err = tokenKeySet(); err != nil {
+		log.Fatal(err)
+	}
 
-func (srv *service) serviceHandlers() {
-	mainMux := http.NewServeMux()
-	mainMux.HandleFunc("/register", srv.registerSpeed)
+	srv.pseudonymKey = []byte(env.GetString("pseudonymKey", ""))
 
-	limitedMux := http.NewServeMux()
-	limitedMux.HandleFunc("/overspeed", srv.overSpeed)
-	limitedMux.HandleFunc("/minmaxspeed", srv.minMaxSpeed)
-	loginHandler := srv.checkTimeMiddleware(limitedMux)
-	mainMux.Handle("/", loginHandler)
+	switch {
+	case srv.tokens == nil:
+		log.Println("access control of query endpoints is disabled and officer and admin endpoints are closed, " +
+			"jwksFile is not configured")
+	case len(srv.pseudonymKey) == 0:
+		log.Fatal("pseudonymKey is required by access control")
+	}
+
+	if srv.certs, srv.clientCerts, err = serverCerts(); err != nil {
+		log.Fatal(err)
+	}
+
+	srv.ingestionLimits = ratelimit.NewLimiter(ratelimit.Config{
+		Rate:  env.GetFloat("ingestionRate", 50),
+		Burst: env.GetInt("ingestionBurst", 100),
+	})
+	srv.queryLimits = ratelimit.NewLimiter(ratelimit.Config{
+		Rate:  env.GetFloat("queryRate", 5),
+		Burst: env.GetInt("queryBurst", 20),
+	})
+	srv.maxBodySize = int64(env.GetInt("maxBodySize", 10<<20))
+	srv.batchMaxSize = env.GetInt("batchMaxSize", 1000)
+	srv.plateSearchDistance = env.GetFloat("plateSearchDistance", 2)
+	srv.plateSearchLimit = env.GetInt("plateSearchLimit", 10)
+	srv.searchMaxDays = env.GetInt("searchMaxDays", 31)
+
+	if srv.timeouts, err = serviceTimeouts(); err != nil {
+		log.Fatal(err)
+	}
+
+	srv.audits, err = repo.NewAuditRepository(env.GetString("auditDir", filepath.Join("internal", "speedfixationservice", "audit")),
+		env.GetDuration("auditRetention", 365*24*time.Hour), srv.clock)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sfr := repo.NewSpeedFixationRepository(srv.clock)
+	srv.uc = usecase.NewSpeedFixationUsecase(sfr, pv, vp, srv.clock, srv.feed, srv.webhooks)
+	srv.keys = repo.NewIdempotencyRepository(env.GetDuration("idempotencyTTL", 24*time.Hour), srv.clock)
+	srv.deadLetters = repo.NewDeadLetterRepository(env.GetDuration("deadLetterRetention", 7*24*time.Hour),
+		env.GetInt("deadLetterMaxCount", 10000), srv.clock)
+
+	httpServer, err := srv.httpServer()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Printf("Start server at :%v ...", *httpAddr)
-	err := http.ListenAndServe(*httpAddr, mainMux)
+	httpLis, err := net.Listen("tcp", *httpAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	grpcLis, err := net.Listen("tcp", *grpcAddr)
 	if err != nil {
-		log.Fatal("Error happened:", err.Error())
+		log.Fatal(err)
 	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	if err := srv.run(httpServer, httpLis, srv.newGRPCServer(), grpcLis, signals,
+		env.GetDuration("shutdownTimeout", 5*time.Second)); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("service is stopped")
 }
 
-func (srv *service) checkTimeMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if time.Now().Hour() >= srv.start.Hour() && time.Now().Hour() < srv.end.Hour() {
-			next.ServeHTTP(w, r)
-		} else {
-			responseError(w, errors.New(fmt.Sprintf("Service work from %v till %v",
-				srv.start.Hour(), srv.end.Hour())), http.StatusNotAcceptable)
+// validationPipeline creates pipeline of validation rules configured by environment
+func validationPipeline() (*usecase.ValidationPipeline, error) {
+	actions, err := usecase.ParseActions(env.GetString("validationRules",
+		"speed_bounds:reject,duplicate:reject,future:reject,clock_skew:flag"))
+	if err != nil {
+		return nil, err
+	}
+
+	available := []usecase.Rule{
+		usecase.SpeedBoundsRule{Min: env.GetFloat("speedMin", 0), Max: env.GetFloat("speedMax", 300)},
+		&usecase.DuplicateRule{Window: env.GetDuration("duplicateWindow", time.Second)},
+		usecase.FutureRule{Tolerance: env.GetDuration("futureTolerance", time.Minute)},
+		usecase.ClockSkewRule{MaxLag: env.GetDuration("clockSkew", 24*time.Hour)},
+	}
+
+	var rules []usecase.ValidationRule
+
+	for _, rule := range available {
+		if action, ok := actions[rule.Name()]; ok {
+			rules = append(rules, usecase.ValidationRule{Rule: rule, Action: action})
+			delete(actions, rule.Name())
 		}
-	})
+	}
+
+	for name := range actions {
+		return nil, errors.New("unknown validation rule " + name)
+	}
+
+	return usecase.NewValidationPipeline(rules...), nil
 }
 
-func responseError(w http.ResponseWriter, err error, status int) {
-	resp, err := json.Marshal(err)
+// httpServer creates HTTP server, it serves TLS when certificate is configured
+func (srv *service) httpServer() (*http.Server, error) {
+	handler, err := srv.handler()
 	if err != nil {
-		http.Error(w, "cannot serialize srv", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_, err = w.Write(resp)
+	server := &http.Server{Addr: *httpAddr, Handler: handler}
 
-	if err != nil {
-		http.Error(w, "response error: ", http.StatusInternalServerError)
+	if srv.certs != nil {
+		server.TLSConfig = srv.tlsConfig()
 	}
+
+	return server, nil
 }
 
-func makeResponse(w http.ResponseWriter, ans interface{}) {
-	resp, err := json.Marshal(ans)
+// tlsConfig returns TLS configuration shared by HTTP and gRPC servers
+func (srv *service) tlsConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	// query users are authenticated by tokens, so only cameras present certificates
+	if srv.clientCerts {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return srv.certs.Config(clientAuth)
+}
+
+// serverCerts loads certificate of HTTP and gRPC servers configured by tlsMode: off, tls or mtls
+func serverCerts() (*tlscert.Reloader, bool, error) {
+	files := tlscert.Files{Cert: env.GetString("tlsCertFile", ""), Key: env.GetString("tlsKeyFile", "")}
+
+	switch mode := env.GetString("tlsMode", "off"); mode {
+	case "off":
+		return nil, false, nil
+	case "tls":
+	case "mtls":
+		if files.ClientCA = env.GetString("tlsClientCAFile", ""); files.ClientCA == "" {
+			return nil, false, errors.New("tlsClientCAFile is required by mutual TLS")
+		}
+	default:
+		return nil, false, errors.New("unknown TLS mode " + mode)
+	}
+
+	certs, err := tlscert.NewReloader(files)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false, err
+	}
 
-		resp, err = json.Marshal(errors.New("error serializing srv"))
+	return certs, files.ClientCA != "", nil
+}
+
+// now returns the current time of service clock
+func (srv *service) now() time.Time {
+	if srv.clock == nil {
+		return time.Now()
+	}
+
+	return srv.clock.Now()
+}
 
+// serviceSchedules reads service hours from scheduleFile, without the file every day
+// is open from startWork till endWork in serviceTimeZone, local time zone by default
+func serviceSchedules() (*schedule.Set, error) {
+	var config schedule.Config
+
+	if path := env.GetString("scheduleFile", ""); path != "" {
+		file, err := os.Open(path)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 
-		_, err = w.Write(resp)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		defer func() {
+			_ = file.Close()
+		}()
+
+		if config, err = schedule.Load(file); err != nil {
+			return nil, err
+		}
+
+		return schedule.New(config)
+	}
+
+	start, err := time.Parse(time.Kitchen, env.GetString("startWork", "12:00AM"))
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := time.Parse(time.Kitchen, env.GetString("endWork", "11:00PM"))
+	if err != nil {
+		return nil, err
+	}
+
+	config.TimeZone = env.GetString("serviceTimeZone", "Local")
+
+	// equal bounds close the service like before schedules
+	if !start.Equal(end) {
+		config.Rules = []schedule.Rule{{Days: "*", Hours: start.Format("15:04") + "-" + end.Format("15:04")}}
+	}
+
+	return schedule.New(config)
+}
+
+// closedError is returned by limited routes outside of service hours, opens is zero
+// when the route does not open
+type closedError struct {
+	opens time.Time
+}
+
+func (e *closedError) Error() string {
+	if e.opens.IsZero() {
+		return errOutOfServiceHours.Error()
+	}
+
+	return errOutOfServiceHours.Error() + ", it opens at " + e.opens.Format(time.RFC3339)
+}
+
+func (e *closedError) Unwrap() error {
+	return errOutOfServiceHours
+}
+
+// checkServiceHours returns error when the route does not work at the moment
+func (srv *service) checkServiceHours(route string) error {
+	sch := srv.schedules.Route(route)
+	now := srv.now()
+
+	if sch.Open(now) {
+		return nil
+	}
+
+	opens, _ := sch.Next(now)
+
+	return &closedError{opens: opens}
+}
+
+// checkTimeMiddleware answers 406 outside of service hours of the route, Retry-After tells when it opens
+func (srv *service) checkTimeMiddleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := srv.checkServiceHours(route); err != nil {
+			var closed *closedError
+			if errors.As(err, &closed) && !closed.opens.IsZero() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(closed.opens.Sub(srv.now()).Seconds()))))
+			}
+
+			responseError(w, err)
+
+			return
 		}
 
+		next.ServeHTTP(w, r)
+	})
+}
+
+func makeResponse(w http.ResponseWriter, ans interface{}) {
+	makeStatusResponse(w, ans, http.StatusOK)
+}
+
+func makeStatusResponse(w http.ResponseWriter, ans interface{}, status int) {
+	resp, err := json.Marshal(ans)
+	if err != nil {
+		responseError(w, errors.Wrap(err, "error serializing srv"))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	_, err = w.Write(resp)
 
 	if err != nil {
@@ -125,50 +423,131 @@ func makeResponse(w http.ResponseWriter, ans interface{}) {
 }
 
 func (srv service) registerSpeed(w http.ResponseWriter, r *http.Request) {
-	var (
-		speedFixation repo.SpeedFixation
-		err           error
-	)
-
-	if r.Method != http.MethodPost {
-		responseError(w, errors.New("incorrect request method"), http.StatusBadRequest)
+	reg, err := decodeRegistration(r)
+	if err != nil {
+		responseError(w, err)
 		return
 	}
 
-	datetime := r.FormValue("date")
-	if datetime == "" {
-		responseError(w, errors.New("datetime not defined in this request"), http.StatusBadRequest)
+	if reg.Camera, err = checkCamera(r.Context(), reg.Camera); err != nil {
+		responseError(w, err)
 		return
 	}
 
-	speedFixation.Date, err = time.Parse("02.01.2006 15:04:05", datetime)
+	speedFixation, err := reg.fixation()
 	if err != nil {
-		responseError(w, errors.New("unable parse datetime"), http.StatusBadRequest)
+		responseError(w, err)
 		return
 	}
 
-	speedFixation.VehicleNumber = r.FormValue("vehicle_number")
-	if speedFixation.VehicleNumber == "" {
-		responseError(w, errors.New("vehicle number not defined in this request"), http.StatusBadRequest)
+	if speedFixation, err = srv.seal(speedFixation, reg.Signature); err != nil {
+		responseError(w, err)
 		return
 	}
 
-	if speedFixation.Speed, err = strconv.ParseFloat(r.FormValue("speed"), 64); err != nil {
-		responseError(w, errors.New("unable parse speed"), http.StatusBadRequest)
+	if err := srv.uc.CreateRecord(r.Context(), speedFixation); err != nil {
+		if errors.Is(err, usecase.ErrQuarantined) {
+			makeStatusResponse(w, "register quarantined", http.StatusAccepted)
+			return
+		}
+
+		responseError(w, err)
+
 		return
 	}
 
-	if speedFixation.Speed == 0 {
-		responseError(w, errors.New("speed not defined in this request"), http.StatusBadRequest)
+	makeResponse(w, "register success")
+}
+
+// registerStatus returns status of fixation registration by its error
+func registerStatus(err error) string {
+	switch {
+	case err == nil:
+		return "accepted"
+	case errors.Is(err, repo.ErrDuplicate):
+		return "duplicate"
+	case errors.Is(err, usecase.ErrQuarantined):
+		return "quarantined"
+	default:
+		return "rejected"
+	}
+}
+
+// batchResult is the result of registration of one fixation from batch
+type batchResult struct {
+	Index  int          `json:"index"`
+	Status string       `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+func (srv service) registerBatch(w http.ResponseWriter, r *http.Request) {
+	regs, errs, err := decodeBatch(r, srv.batchMaxSize)
+	if err != nil {
+		responseError(w, err)
 		return
 	}
 
-	if err := srv.uc.CreateRecord(speedFixation); err != nil {
-		responseError(w, err, http.StatusBadRequest)
+	var (
+		fixations = make([]repo.SpeedFixation, 0, len(regs))
+		pos       = make([]int, 0, len(regs))
+	)
+
+	for i, reg := range regs {
+		if errs[i] != nil {
+			continue
+		}
+
+		camera, err := checkCamera(r.Context(), reg.Camera)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		reg.Camera = camera
+
+		fixation, err := reg.fixation()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if fixation, err = srv.seal(fixation, reg.Signature); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		fixations = append(fixations, fixation)
+		pos = append(pos, i)
+	}
+
+	created, err := srv.uc.CreateRecords(r.Context(), fixations)
+	if err != nil {
+		responseError(w, err)
 		return
 	}
 
-	makeResponse(w, "register success")
+	for i, err := range created {
+		errs[pos[i]] = err
+	}
+
+	resp := make([]batchResult, len(regs))
+
+	for i, err := range errs {
+		resp[i] = batchResult{Index: i, Status: registerStatus(err)}
+
+		var verr *ValidationError
+
+		switch {
+		case err == nil, errors.Is(err, repo.ErrDuplicate):
+		case errors.As(err, &verr):
+			resp[i].Errors = verr.Errors
+		default:
+			resp[i].Reason = err.Error()
+		}
+	}
+
+	makeResponse(w, resp)
 }
 
 func (srv service) overSpeed(w http.ResponseWriter, r *http.Request) {
@@ -177,36 +556,31 @@ func (srv service) overSpeed(w http.ResponseWriter, r *http.Request) {
 		err                error
 	)
 
-	if r.Method != http.MethodGet {
-		responseError(w, errors.New("incorrect request method"), http.StatusBadRequest)
-		return
-	}
-
 	datetime := r.FormValue("date")
 	if datetime == "" {
-		responseError(w, errors.New("datetime not defined in this request"), http.StatusBadRequest)
+		responseError(w, fieldError("date", "datetime not defined in this request"))
 		return
 	}
 
 	samplingConditions.Date, err = time.Parse("02.01.2006", datetime)
 	if err != nil {
-		responseError(w, errors.New("unable parse datetime"), http.StatusBadRequest)
+		responseError(w, fieldError("date", "unable parse datetime"))
 		return
 	}
 
 	if samplingConditions.Speed, err = strconv.ParseFloat(r.FormValue("speed"), 64); err != nil {
-		responseError(w, errors.New("unable parse speed"), http.StatusBadRequest)
+		responseError(w, fieldError("speed", "unable parse speed"))
 		return
 	}
 
 	if samplingConditions.Speed == 0 {
-		responseError(w, errors.New("speed not defined in this request"), http.StatusBadRequest)
+		responseError(w, fieldError("speed", "speed not defined in this request"))
 		return
 	}
 
-	resp, err := srv.uc.LookUpOverSpeedByDate(samplingConditions)
+	resp, err := srv.uc.LookUpOverSpeedByDate(r.Context(), samplingConditions)
 	if err != nil {
-		responseError(w, err, http.StatusBadRequest)
+		responseError(w, err)
 		return
 	}
 
@@ -214,22 +588,183 @@ func (srv service) overSpeed(w http.ResponseWriter, r *http.Request) {
 }
 
 func (srv service) minMaxSpeed(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		responseError(w, errors.New("incorrect request method"), http.StatusBadRequest)
+	date, err := time.Parse("02.01.2006", r.FormValue("date"))
+	if err != nil {
+		responseError(w, fieldError("date", "unable parse datetime"))
+		return
+	}
+
+	resp, err := srv.uc.LookUpMinMaxSpeedByDate(r.Context(), date)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+func (srv service) speedStatistics(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("02.01.2006", r.FormValue("date"))
+	if err != nil {
+		responseError(w, fieldError("date", "unable parse datetime"))
+		return
+	}
+
+	resp, err := srv.uc.LookUpSpeedStatisticsByDate(r.Context(), date)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+// maxOffenderDays limits days walked by repeat offenders search, it is the maximum of the specification too
+const maxOffenderDays = 366
+
+func (srv service) repeatOffenders(w http.ResponseWriter, r *http.Request) {
+	var (
+		conditions repo.RepeatOffenderConditions
+		err        error
+	)
+
+	conditions.Date, err = time.Parse("02.01.2006", r.FormValue("date"))
+	if err != nil {
+		responseError(w, fieldError("date", "unable parse datetime"))
+		return
+	}
+
+	if conditions.Speed, err = strconv.ParseFloat(r.FormValue("speed"), 64); err != nil {
+		responseError(w, fieldError("speed", "unable parse speed"))
 		return
 	}
 
+	if conditions.Days, err = strconv.Atoi(r.FormValue("days")); err != nil || conditions.Days <= 0 {
+		responseError(w, fieldError("days", "unable parse days"))
+		return
+	}
+
+	if conditions.Days > maxOffenderDays {
+		responseError(w, fieldError("days", "must not be greater than "+strconv.Itoa(maxOffenderDays)))
+		return
+	}
+
+	if conditions.Violations, err = strconv.Atoi(r.FormValue("violations")); err != nil || conditions.Violations <= 0 {
+		responseError(w, fieldError("violations", "unable parse violations"))
+		return
+	}
+
+	resp, err := srv.uc.LookUpRepeatOffenders(r.Context(), conditions)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+func (srv service) plateSearch(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	query := platesearch.Query{
+		Pattern:     r.FormValue("plate"),
+		MaxDistance: srv.plateSearchDistance,
+		Limit:       srv.plateSearchLimit,
+		Confusions:  srv.confusions,
+	}
+
+	if query.Pattern == "" {
+		responseError(w, fieldError("plate", "plate not defined in this request"))
+		return
+	}
+
+	if distance := r.FormValue("distance"); distance != "" {
+		if query.MaxDistance, err = strconv.ParseFloat(distance, 64); err != nil || query.MaxDistance < 0 {
+			responseError(w, fieldError("distance", "unable parse distance"))
+			return
+		}
+	}
+
+	if limit := r.FormValue("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 0 {
+			responseError(w, fieldError("limit", "unable parse limit"))
+			return
+		}
+	}
+
+	resp, err := srv.uc.SearchPlates(r.Context(), query)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+// searchRange reports whether search from day to day is allowed
+func (srv *service) searchRange(from, to time.Time) bool {
+	if to.Before(from) {
+		return false
+	}
+
+	return srv.searchMaxDays == 0 || to.Sub(from) < time.Duration(srv.searchMaxDays)*24*time.Hour
+}
+
+func (srv service) search(w http.ResponseWriter, r *http.Request) {
+	from, err := time.Parse("02.01.2006", r.FormValue("from"))
+	if err != nil {
+		responseError(w, fieldError("from", "unable parse from date"))
+		return
+	}
+
+	to, err := time.Parse("02.01.2006", r.FormValue("to"))
+	if err != nil {
+		responseError(w, fieldError("to", "unable parse to date"))
+		return
+	}
+
+	if !srv.searchRange(from, to) {
+		responseError(w, fieldError("to", "incorrect date range"))
+		return
+	}
+
+	expr, err := filter.ParseInLocation(r.FormValue("filter"), srv.schedules.Location())
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	// plates are not known to analysts, so they can not look for them
+	if filter.Uses(expr, "plate") && pseudonymous(r.Context()) {
+		responseError(w, errForbidden)
+		return
+	}
+
+	resp, err := srv.uc.SearchFixations(r.Context(), from, to, expr)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+func (srv service) flagged(w http.ResponseWriter, r *http.Request) {
 	date, err := time.Parse("02.01.2006", r.FormValue("date"))
 	if err != nil {
-		responseError(w, errors.New("unable parse datetime"), http.StatusBadRequest)
+		responseError(w, fieldError("date", "unable parse datetime"))
 		return
 	}
 
-	resp, err := srv.uc.LookUpMinMaxSpeedByDate(date)
+	resp, err := srv.uc.LookUpFlaggedByDate(r.Context(), date)
 	if err != nil {
-		responseError(w, err, http.StatusBadRequest)
+		responseError(w, err)
 		return
 	}
 
 	makeResponse(w, resp)
 }
+
+func (srv service) validationStats(w http.ResponseWriter, r *http.Request) {
+	makeResponse(w, srv.uc.ValidationStats())
+}
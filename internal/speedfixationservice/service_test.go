@@ -2,22 +2,57 @@
 package speedfixationservice
 
 import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/luno/jettison/errors"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/camauth"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/evidence"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/feed"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/jwt"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/ratelimit"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/schedule"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/tlscert"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/usecase"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/webhook"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+	pb "github.com/IgorRybak2055/speed-control-service/pkg/speedcontrolpb"
 )
 
 func fillTestData(t testing.TB, tempDir string) {
@@ -48,6 +83,22 @@ func fillTestData(t testing.TB, tempDir string) {
 	require.NoError(t, encoder.Encode(testData))
 }
 
+// testTokens returns key set of test tokens and function signing token of user with roles
+func testTokens(t *testing.T) (*jwt.KeySet, func(roles ...string) string) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	tokens, err := jwt.LoadKeySet(strings.NewReader(`{"keys":[{"kid":"k1","kty":"oct","k":"`+
+		base64.RawURLEncoding.EncodeToString(secret)+`"}]}`), jwt.Config{})
+	require.NoError(t, err)
+
+	return tokens, func(roles ...string) string {
+		token, err := jwt.Sign("k1", secret, jwt.Claims{Subject: "user", Expires: time.Now().Add(time.Hour).Unix(), Roles: roles})
+		require.NoError(t, err)
+
+		return token
+	}
+}
+
 func createTempDir(t testing.TB) (string, func()) {
 	t.Helper()
 
@@ -59,6 +110,22 @@ func createTempDir(t testing.TB) (string, func()) {
 	}
 }
 
+// testService returns service keeping fixations, idempotency keys and dead letters in tempDir,
+// vehicle numbers are checked by default rules and registered fixations are passed to notifiers.
+func testService(t testing.TB, tempDir string, clk clock.Clock, notifiers ...usecase.Notifier) *service {
+	t.Helper()
+
+	pv, err := plate.NewValidator(plate.DefaultRules)
+	require.NoError(t, err)
+
+	return &service{
+		clock:       clk,
+		uc:          usecase.NewSpeedFixationUsecase(repo.NewTestSpeedFixationRepository(tempDir, clk), pv, usecase.NewValidationPipeline(), clk, notifiers...),
+		keys:        repo.NewTestIdempotencyRepository(tempDir, time.Hour, clock.System),
+		deadLetters: repo.NewTestDeadLetterRepository(tempDir, time.Hour, 100, clock.System),
+	}
+}
+
 func buildRequest(serverURL string) (*http.Request, error) {
 	var (
 		err error
@@ -107,7 +174,7 @@ func TestSpeedFixationService(t *testing.T) {
 
 	fillTestData(t, tempDir)
 
-	srv := service{uc: usecase.NewSpeedFixationUsecase(repo.NewTestSpeedFixationRepository(tempDir))}
+	srv := testService(t, tempDir, clock.System)
 
 	server := httptest.NewServer(http.HandlerFunc(srv.registerSpeed))
 	defer server.Close()
@@ -130,3 +197,1943 @@ func TestSpeedFixationService(t *testing.T) {
 
 	log.Println(ans)
 }
+
+func TestRegisterSpeed(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := testService(t, tempDir, clock.System)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        interface{}
+	}{
+		{
+			name:        "json with offset",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"date":"2019-12-27T18:03:27.125+03:00","vehicle_number":"6048 EC-3","speed":100.5,"camera":"C12"}`,
+			status:      http.StatusOK,
+			want:        "register success",
+		},
+		{
+			name:        "legacy form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "date=27.12.2019+15:03:27&vehicle_number=6048+EC-3&speed=100",
+			status:      http.StatusOK,
+			want:        "register success",
+		},
+		{
+			name:        "invalid fields",
+			contentType: "application/json",
+			body:        `{"date":"27/12/2019","speed":0}`,
+			status:      http.StatusBadRequest,
+			want: map[string]interface{}{"error": map[string]interface{}{
+				"code": "invalid_request",
+				"message": "invalid request: date: unable parse datetime, expected RFC 3339 or 02.01.2006 15:04:05; " +
+					"vehicle_number: vehicle number not defined in this request; speed: speed not defined in this request",
+				"details": []interface{}{
+					map[string]interface{}{"field": "date", "message": "unable parse datetime, expected RFC 3339 or 02.01.2006 15:04:05"},
+					map[string]interface{}{"field": "vehicle_number", "message": "vehicle number not defined in this request"},
+					map[string]interface{}{"field": "speed", "message": "speed not defined in this request"},
+				},
+			}},
+		},
+		{
+			name:        "broken json",
+			contentType: "application/json",
+			body:        `{"date":`,
+			status:      http.StatusBadRequest,
+			want: map[string]interface{}{"error": map[string]interface{}{
+				"code":    "invalid_request",
+				"message": "invalid request: body: unable parse json",
+				"details": []interface{}{
+					map[string]interface{}{"field": "body", "message": "unable parse json"},
+				},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rec := httptest.NewRecorder()
+			srv.registerSpeed(rec, req)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := srv.uc.LookUpOverSpeedByDate(context.Background(), repo.SpeedFixation{Date: time.Date(2019, 12, 27, 0, 0, 0, 0, time.UTC), Speed: 100.1})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, time.Date(2019, 12, 27, 15, 3, 27, 125000000, time.UTC), got[0].Date)
+	require.Equal(t, "C12", got[0].Camera)
+}
+
+func TestRegisterBatch(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := testService(t, tempDir, clock.System)
+
+	post := func(contentType, body string) []batchResult {
+		var got []batchResult
+
+		req := httptest.NewRequest(http.MethodPost, "/register/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		rec := httptest.NewRecorder()
+		srv.registerBatch(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+
+		return got
+	}
+
+	got := post("application/x-ndjson", strings.Join([]string{
+		`{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100,"camera":"C12"}`,
+		`{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048ec3","speed":100,"camera":"C12"}`,
+		`{"date":"2019-12-27T15:03:28Z","vehicle_number":"0003 AE-3","speed":0}`,
+		`{"date":`,
+		`{"date":"2019-12-27T15:03:29Z","vehicle_number":"8911 EE-3","speed":84.5}`,
+	}, "\n"))
+
+	require.Equal(t, []batchResult{
+		{Index: 0, Status: "accepted"},
+		{Index: 1, Status: "duplicate"},
+		{Index: 2, Status: "rejected", Errors: []FieldError{{Field: "speed", Message: "speed not defined in this request"}}},
+		{Index: 3, Status: "rejected", Errors: []FieldError{{Field: "body", Message: "unable parse json"}}},
+		{Index: 4, Status: "accepted"},
+	}, got)
+
+	got = post("application/json", `[
+		{"date":"2019-12-27T18:03:27+03:00","vehicle_number":"6048 EC-3","speed":100,"camera":"C12"},
+		{"date":"2019-12-27T15:03:30Z","vehicle_number":"ABC","speed":90}
+	]`)
+
+	require.Equal(t, "duplicate", got[0].Status)
+	require.Equal(t, "rejected", got[1].Status)
+	require.NotEmpty(t, got[1].Reason)
+
+	stored, err := srv.uc.LookUpOverSpeedByDate(context.Background(), repo.SpeedFixation{Date: time.Date(2019, 12, 27, 0, 0, 0, 0, time.UTC), Speed: 1})
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+
+	srv.batchMaxSize = 1
+
+	req := httptest.NewRequest(http.MethodPost, "/register/batch", strings.NewReader(`[{},{}]`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	srv.registerBatch(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "batch is larger than 1 items")
+}
+
+func TestIdempotentMiddleware(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := testService(t, tempDir, clock.System)
+
+	handler := srv.idempotentMiddleware(http.HandlerFunc(srv.registerSpeed))
+
+	register := func(body string, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		if header != "" {
+			req.Header.Set(idempotencyKeyHeader, header)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	body := `{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100,"idempotency_key":"C12-17"}`
+
+	first := register(body, "")
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	retry := register(body, "")
+	require.Equal(t, http.StatusOK, retry.Code)
+	require.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	require.Equal(t, first.Body.String(), retry.Body.String())
+
+	rejected := register(`{"date":"2019-12-27T15:03:27Z","speed":100}`, "C12-18")
+	require.Equal(t, http.StatusBadRequest, rejected.Code)
+
+	retry = register(`{"date":"2019-12-27T15:03:27Z","speed":100}`, "C12-18")
+	require.Equal(t, http.StatusBadRequest, retry.Code)
+	require.Equal(t, rejected.Body.String(), retry.Body.String())
+
+	// the key is not reused for other request
+	retry = register(`{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100}`, "C12-18")
+	require.Equal(t, http.StatusUnprocessableEntity, retry.Code)
+	require.Contains(t, retry.Body.String(), `"code":"key_reused"`)
+
+	// keys of cameras are separate
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"date":"2019-12-27T15:03:27Z","speed":100}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, "C12-18")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), cameraKey{}, "C14")))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+	stored, err := srv.uc.LookUpOverSpeedByDate(context.Background(), repo.SpeedFixation{Date: time.Date(2019, 12, 27, 0, 0, 0, 0, time.UTC), Speed: 1})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+}
+
+func TestDeadLetters(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	strict, err := plate.NewValidator("BY:^[0-9]{4}[A-Z]{2}[0-8]$")
+	require.NoError(t, err)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.uc = usecase.NewSpeedFixationUsecase(repo.NewTestSpeedFixationRepository(tempDir, clock.System), strict, usecase.NewValidationPipeline(), clock.System)
+
+	handler := srv.deadLetterMiddleware(http.HandlerFunc(srv.registerSpeed))
+
+	req := httptest.NewRequest(http.MethodPost, "/register",
+		strings.NewReader(`{"date":"2019-12-27T15:03:27Z","vehicle_number":"AB 1234-7","speed":100,"camera":"C12"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "10.0.0.12:41000"
+
+	// dead letters are kept by authenticated camera
+	signed := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), cameraKey{}, "C12"))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signed(req))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterList(rec, httptest.NewRequest(http.MethodGet, "/admin/deadletters?camera=C12", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var letters []repo.DeadLetter
+
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &letters))
+	require.Len(t, letters, 1)
+	require.Equal(t, "10.0.0.12:41000", letters[0].RemoteAddr)
+	require.Equal(t, http.StatusBadRequest, letters[0].Status)
+	require.NotEmpty(t, letters[0].Reason)
+
+	// vehicle number rules are fixed, so the rejected registration can be replayed
+	srv.uc = testService(t, tempDir, clock.System).uc
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterReplay(rec, httptest.NewRequest(http.MethodPost, "/admin/deadletters/replay?id="+letters[0].ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var result replayResult
+
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Equal(t, http.StatusOK, result.Status)
+
+	_, err = srv.deadLetters.Get(letters[0].ID)
+	require.True(t, errors.Is(err, repo.ErrNotFound))
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterReplay(rec, httptest.NewRequest(http.MethodPost, "/admin/deadletters/replay?id="+letters[0].ID, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// rejected items of accepted batch are kept as single registrations
+	req = httptest.NewRequest(http.MethodPost, "/v1/register/batch", strings.NewReader(strings.Join([]string{
+		`{"date":"2019-12-27T15:03:28Z","vehicle_number":"0003 AE-3","speed":90,"camera":"C12"}`,
+		`{"date":"2019-12-27T15:03:29Z","vehicle_number":"8911 EE-3","camera":"C12"}`,
+	}, "\n")))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterMiddleware(http.HandlerFunc(srv.registerBatch)).ServeHTTP(rec, signed(req))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterList(rec, httptest.NewRequest(http.MethodGet, "/admin/deadletters?camera=C12", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &letters))
+	require.Len(t, letters, 1)
+	require.Equal(t, "/v1/register", letters[0].Path)
+	require.Equal(t, `{"date":"2019-12-27T15:03:29Z","vehicle_number":"8911 EE-3","camera":"C12"}`, letters[0].Payload)
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterReplay(rec, httptest.NewRequest(http.MethodPost, "/admin/deadletters/replay?id="+letters[0].ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Equal(t, http.StatusBadRequest, result.Status)
+
+	// registration naming other camera than the signing one is not stored under the named camera on replay
+	req = httptest.NewRequest(http.MethodPost, "/register",
+		strings.NewReader(`{"date":"2019-12-27T15:03:30Z","vehicle_number":"1234 AB-5","speed":100,"camera":"C13"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signed(req))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "camera does not match the signing camera")
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterList(rec, httptest.NewRequest(http.MethodGet, "/admin/deadletters?camera=C12", nil))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &letters))
+	require.Len(t, letters, 2)
+
+	spoofed := letters[len(letters)-1]
+	require.Contains(t, spoofed.Payload, `"camera":"C13"`)
+
+	rec = httptest.NewRecorder()
+	srv.deadLetterReplay(rec, httptest.NewRequest(http.MethodPost, "/admin/deadletters/replay?id="+spoofed.ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Equal(t, http.StatusBadRequest, result.Status)
+	require.Contains(t, string(result.Response), "camera does not match the signing camera")
+
+	_, err = srv.deadLetters.Get(spoofed.ID)
+	require.NoError(t, err)
+}
+
+func TestGRPCServer(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	audits, err := repo.NewAuditRepository(filepath.Join(tempDir, "audit"), time.Hour, clock.System)
+	require.NoError(t, err)
+
+	closed, err := schedule.New(schedule.Config{})
+	require.NoError(t, err)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.schedules = closed
+	srv.audits = audits
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := srv.newGRPCServer()
+	defer s.Stop()
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	var (
+		client = pb.NewSpeedControlClient(conn)
+		ctx    = context.Background()
+	)
+
+	date, err := ptypes.TimestampProto(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+	require.NoError(t, err)
+
+	req := &pb.RegisterRequest{
+		Fixation:       &pb.Fixation{Date: date, VehicleNumber: "6048 EC-3", Speed: 100},
+		IdempotencyKey: "C12-17",
+	}
+
+	resp, err := client.Register(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, resp.Status)
+
+	resp, err = client.Register(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, resp.Status)
+
+	_, err = client.Register(ctx, &pb.RegisterRequest{
+		Fixation:       &pb.Fixation{Date: date, VehicleNumber: "0003 AE-3", Speed: 100},
+		IdempotencyKey: "C12-17",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Register(ctx, &pb.RegisterRequest{Fixation: &pb.Fixation{Date: date, Speed: 100}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.RegisterBatch(ctx)
+	require.NoError(t, err)
+
+	for _, f := range []*pb.Fixation{
+		{Date: date, VehicleNumber: "6048 EC-3", Speed: 100},
+		{Date: date, VehicleNumber: "0003 AE-3", Speed: 84.5},
+		{Date: date, Speed: 65.7},
+	} {
+		require.NoError(t, stream.Send(&pb.RegisterRequest{Fixation: f}))
+	}
+
+	batch, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Len(t, batch.Results, 3)
+	require.Equal(t, pb.RegisterStatus_DUPLICATE, batch.Results[0].Status)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, batch.Results[1].Status)
+	require.Equal(t, pb.RegisterStatus_REJECTED, batch.Results[2].Status)
+
+	// schedule without rules closes limited methods
+	_, err = client.MinMaxSpeed(ctx, &pb.MinMaxSpeedRequest{Date: date})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// query calls are audited, registrations are not
+	entries, err := audits.LookUp(repo.AuditConditions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "GRPC", entries[0].Method)
+	require.Equal(t, "/speedcontrol.v1.SpeedControl/MinMaxSpeed", entries[0].Path)
+	require.Equal(t, int(codes.FailedPrecondition), entries[0].Status)
+	require.Len(t, entries[0].Params["request"], 1)
+
+	stats, err := grpcServer{srv: srv}.MinMaxSpeed(ctx, &pb.MinMaxSpeedRequest{Date: date})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, stats.Count)
+	require.Equal(t, 100.0, stats.Max.Speed)
+	require.Equal(t, 84.5, stats.Min.Speed)
+}
+
+func TestGRPCCameraAuth(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	cameras := camauth.NewKeyring(repo.NewTestCameraRepository(tempDir), time.Minute, clock.System)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.cameras = cameras
+	srv.cameraAuth = true
+	srv.cameraAuthRequired = true
+	srv.searchMaxDays = 31
+
+	key, err := cameras.Issue("C12")
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := srv.newGRPCServer()
+	defer s.Stop()
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	client := pb.NewSpeedControlClient(conn)
+
+	signed := func(body []byte) context.Context {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		return metadata.AppendToOutgoingContext(context.Background(),
+			camauth.CameraHeader, "C12",
+			camauth.TimestampHeader, ts,
+			camauth.SignatureHeader, camauth.Sign(key.Secret, ts, body))
+	}
+
+	date, err := ptypes.TimestampProto(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+	require.NoError(t, err)
+
+	req := &pb.RegisterRequest{
+		Fixation:       &pb.Fixation{Date: date, VehicleNumber: "6048 EC-3", Speed: 100},
+		IdempotencyKey: "C12-17",
+	}
+
+	_, err = client.Register(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the camera signs canonical encoding of fixation and idempotency key
+	body := []byte(`{"camera":"","date":"2019-12-27T15:03:27Z","speed":100,"vehicle_number":"6048 EC-3"}` + "\nC12-17")
+	require.Equal(t, body, signedRegistration(req))
+
+	resp, err := client.Register(signed(body), req)
+	require.NoError(t, err)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, resp.Status)
+
+	// the stream is signed by its messages, changed messages are rejected before they are stored
+	batch := []*pb.RegisterRequest{
+		{Fixation: &pb.Fixation{Date: date, VehicleNumber: "0003 AE-3", Speed: 84.5}},
+		{Fixation: &pb.Fixation{Date: date, VehicleNumber: "1234 AB-7", Speed: 90}},
+	}
+
+	var streamBody []byte
+	for _, r := range batch {
+		streamBody = append(append(streamBody, signedRegistration(r)...), '\n')
+	}
+
+	stream, err := client.RegisterBatch(signed(streamBody))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(batch[0]))
+	require.NoError(t, stream.Send(&pb.RegisterRequest{Fixation: &pb.Fixation{Date: date, VehicleNumber: "1234 AB-7", Speed: 60}}))
+
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	stats, err := grpcServer{srv: srv}.MinMaxSpeed(context.Background(), &pb.MinMaxSpeedRequest{Date: date})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stats.Count)
+
+	stream, err = client.RegisterBatch(signed(streamBody))
+	require.NoError(t, err)
+
+	for _, r := range batch {
+		require.NoError(t, stream.Send(r))
+	}
+
+	results, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Len(t, results.Results, 2)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, results.Results[0].Status)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, results.Results[1].Status)
+
+	// query range is limited like HTTP search
+	to, err := ptypes.TimestampProto(time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	err = grpcServer{srv: srv}.Query(&pb.QueryRequest{From: date, To: to}, nil)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = grpcServer{srv: srv}.Query(&pb.QueryRequest{From: to, To: date}, nil)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRouter(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := testService(t, tempDir, clock.System)
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/v1/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	require.Equal(t, "3.0.3", spec["openapi"])
+
+	rec = serve(http.MethodGet, "/v1/register", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "OPTIONS, POST", rec.Header().Get("Allow"))
+	require.NotEmpty(t, rec.Header().Get(requestIDHeader))
+
+	rec = serve(http.MethodPost, "/v1/register", `{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Deprecation"))
+
+	rec = serve(http.MethodPost, "/register", `{"date":"2019-12-27T15:03:27Z","vehicle_number":"0003 AE-3","speed":90}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "true", rec.Header().Get("Deprecation"))
+	require.Equal(t, `</v1/register>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	rec = serve(http.MethodPost, "/v2/minmaxspeed", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "GET, OPTIONS", rec.Header().Get("Allow"))
+
+	// /v2/minmaxspeed is the current path of statistics, it is not deprecated
+	rec = serve(http.MethodGet, "/v2/minmaxspeed?date=27.12.2019", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Empty(t, rec.Header().Get("Deprecation"))
+	require.Empty(t, rec.Header().Get("Link"))
+
+	rec = serve(http.MethodGet, "/v1/overspeed?date=27-12-2019&speed=0", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, codeInvalidRequest, resp.Error.Code)
+	require.Equal(t, []FieldError{
+		{Field: "date", Message: `must match ^[0-9]{2}\.[0-9]{2}\.[0-9]{4}$`},
+		{Field: "speed", Message: "must be greater than 0"},
+	}, resp.Error.Details)
+
+	rec = serve(http.MethodGet, "/v1/repeatoffenders?date=27.12.2019&speed=90&days=x", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, []FieldError{
+		{Field: "days", Message: "must be integer"},
+		{Field: "violations", Message: "required parameter not defined in this request"},
+	}, resp.Error.Details)
+
+	rec = serve(http.MethodGet, "/v1/repeatoffenders?date=27.12.2019&speed=90&days=1000000000&violations=2", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, []FieldError{{Field: "days", Message: "must not be greater than 366"}}, resp.Error.Details)
+
+	// request bodies are validated by their schemas, rejected registrations are kept as dead letters
+	rec = serve(http.MethodPost, "/v1/register", `{"date":"2019-12-27T15:03:27Z","speed":"fast","camera":12}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, []FieldError{
+		{Field: "vehicle_number", Message: "required property not defined in this request"},
+		{Field: "camera", Message: "must be string"},
+		{Field: "speed", Message: "must be number"},
+	}, resp.Error.Details)
+
+	letters, err := srv.deadLetters.LookUp(repo.DeadLetterConditions{})
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/register?vehicle_number=6048+EC-3", strings.NewReader("date=2019-12-27T15:03:27Z&speed=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, []FieldError{{Field: "speed", Message: "must be number"}}, resp.Error.Details)
+
+	rec = serve(http.MethodPost, "/v1/register", `{"date":`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, []FieldError{{Field: "body", Message: "unable parse json"}}, resp.Error.Details)
+
+	// items of batch are validated one by one, so valid items are stored
+	rec = serve(http.MethodPost, "/v1/register/batch",
+		`[{"date":"2019-12-27T15:03:28Z","vehicle_number":"8911 EE-3","speed":70},{"speed":"fast"}]`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"accepted"`)
+	require.Contains(t, rec.Body.String(), `"rejected"`)
+
+	rec = serve(http.MethodGet, "/v1/unknown", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "validation", err: fieldError("date", "unable parse datetime"), status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "no data", err: errors.Wrap(&os.PathError{Op: "open", Path: "data/27.12.2019.json", Err: os.ErrNotExist}, "look up"),
+			status: http.StatusNotFound, code: codeNoData},
+		{name: "dead letter", err: repo.ErrNotFound, status: http.StatusNotFound, code: codeNotFound},
+		{name: "duplicate", err: errors.Wrap(repo.ErrDuplicate, "6048EC3"), status: http.StatusConflict, code: codeDuplicate},
+		{name: "plate", err: errors.Wrap(plate.ErrUnknownFormat, "invalid vehicle number"), status: http.StatusBadRequest,
+			code: codeUnknownPlateFormat},
+		{name: "service hours", err: errors.Wrap(errOutOfServiceHours, "Service work from 8 till 20"),
+			status: http.StatusNotAcceptable, code: codeOutOfServiceHours},
+		{name: "storage", err: errors.New("disk is full"), status: http.StatusInternalServerError, code: codeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp errorResponse
+
+			rec := httptest.NewRecorder()
+			rec.Header().Set(requestIDHeader, "req-1")
+			responseError(rec, tt.err)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.Equal(t, tt.code, resp.Error.Code)
+			require.Equal(t, "req-1", resp.Error.RequestID)
+			require.NotContains(t, resp.Error.Message, "data/")
+		})
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Properties struct {
+						Error struct {
+							Properties struct {
+								Code struct {
+									Enum []string `json:"enum"`
+								} `json:"code"`
+							} `json:"properties"`
+						} `json:"error"`
+					} `json:"properties"`
+				} `json:"Error"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(openAPISpec), &spec))
+
+	enum := spec.Components.Schemas.Error.Properties.Error.Properties.Code.Enum
+	require.Contains(t, enum, codeInvalidRequest)
+	require.Contains(t, enum, codeInternal)
+
+	// every code of known errors is documented
+	for _, known := range knownErrors {
+		require.Contains(t, enum, known.code)
+	}
+}
+
+func TestLiveFeed(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	hub := feed.NewHub(100, clock.System)
+	srv := testService(t, tempDir, clock.System, hub)
+	srv.feed = hub
+	srv.feedHeartbeat = 50 * time.Millisecond
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", srv.feedEvents)
+	mux.HandleFunc("/feed/ws", srv.feedWebSocket)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/feed?camera=C12&min_speed=90")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	ws, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/feed/ws?plate=6048*", "", server.URL)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, ws.Close())
+	}()
+
+	date := time.Now().UTC()
+	require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{Date: date, VehicleNumber: "0003 AE-3", Camera: "C12", Speed: 60}))
+	require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{Date: date, VehicleNumber: "6048 EC-3", Camera: "C12", Speed: 95}))
+
+	var (
+		reader = bufio.NewReader(resp.Body)
+		lines  []string
+	)
+
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		// heartbeats may come between events
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+
+	require.True(t, strings.HasPrefix(lines[0], "id: "))
+	require.Equal(t, "event: fixation", lines[1])
+	require.Contains(t, lines[2], `"vehicle_number":"6048EC3"`)
+
+	var msg feedMessage
+
+	for msg.Type != "fixation" {
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+	}
+
+	require.Equal(t, "6048EC3", msg.Fixation.VehicleNumber)
+	require.Equal(t, strings.TrimPrefix(lines[0], "id: "), strconv.FormatUint(msg.ID, 10))
+
+	// reconnecting client gets events stored after its last event
+	require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{Date: date, VehicleNumber: "8911 EE-3", Camera: "C12", Speed: 120}))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/feed", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(msg.ID, 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resumed, err := http.DefaultClient.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resumed.Body.Close())
+	}()
+
+	reader = bufio.NewReader(resumed.Body)
+
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		if strings.HasPrefix(line, "data: ") {
+			require.Contains(t, line, `"vehicle_number":"8911EE3"`)
+			break
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.feedEvents(rec, httptest.NewRequest(http.MethodGet, "/feed?min_speed=fast", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestWebhookAdmin(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := service{webhooks: webhook.NewDispatcher(repo.NewTestWebhookRepository(tempDir, time.Hour, clock.System), clock.System, webhook.Config{},
+		repo.WebhookSubscription{URL: "http://localhost:9000/fines", Secret: "secret"})}
+
+	rec := httptest.NewRecorder()
+	srv.webhookCreate(rec, httptest.NewRequest(http.MethodPost, "/v1/admin/webhooks", strings.NewReader(`{"url":"fines"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.webhookCreate(rec, httptest.NewRequest(http.MethodPost, "/v1/admin/webhooks",
+		strings.NewReader(`{"url":"https://fines.example/hook","min_speed":90}`)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created repo.WebhookSubscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.Len(t, created.Secret, 64)
+
+	rec = httptest.NewRecorder()
+	srv.webhookList(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/webhooks", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var subs []repo.WebhookSubscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &subs))
+	require.Len(t, subs, 2)
+	require.True(t, subs[0].Static)
+	require.Empty(t, subs[0].Secret)
+	require.Empty(t, subs[1].Secret)
+
+	rec = httptest.NewRecorder()
+	srv.webhookDelete(rec, httptest.NewRequest(http.MethodDelete, "/v1/admin/webhooks?id=file-1", nil))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.webhookDelete(rec, httptest.NewRequest(http.MethodDelete, "/v1/admin/webhooks?id="+created.ID, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestCameraAuth(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	tokens, token := testTokens(t)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+	srv.cameras = camauth.NewKeyring(repo.NewTestCameraRepository(tempDir), time.Minute, clock.System)
+	srv.cameraAuth = true
+	srv.cameraAuthRequired = true
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	serve := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token(roleAdmin))
+
+		for k := range header {
+			req.Header.Set(k, header[k][0])
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	signed := func(camera, secret string, sent time.Time, body string) http.Header {
+		ts := strconv.FormatInt(sent.Unix(), 10)
+
+		return http.Header{
+			camauth.CameraHeader:    {camera},
+			camauth.TimestampHeader: {ts},
+			camauth.SignatureHeader: {camauth.Sign(secret, ts, []byte(body))},
+		}
+	}
+
+	body := func(plate string) string {
+		return `{"date":"2019-12-27T15:03:27Z","vehicle_number":"` + plate + `","speed":100}`
+	}
+
+	rec := serve(http.MethodPost, "/v1/register", body("6048 EC-3"), nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"unauthenticated"`)
+
+	rec = serve(http.MethodPost, "/v1/admin/cameras/keys?camera=C12", "", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var key repo.CameraKey
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &key))
+	require.NotEmpty(t, key.Secret)
+
+	header := signed("C12", key.Secret, time.Now(), body("6048 EC-3"))
+
+	rec = serve(http.MethodPost, "/v1/register", body("6048 EC-3"), header)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// the same signed request is not accepted twice
+	rec = serve(http.MethodPost, "/v1/register", body("6048 EC-3"), header)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, "/v1/register", body("0003 AE-3"), signed("C12", "wrong", time.Now(), body("0003 AE-3")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, "/v1/register", body("0003 AE-3"),
+		signed("C12", key.Secret, time.Now().Add(-time.Hour), body("0003 AE-3")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	other := `{"date":"2019-12-27T15:03:27Z","vehicle_number":"0003 AE-3","speed":100,"camera":"C13"}`
+	rec = serve(http.MethodPost, "/v1/register", other, signed("C12", key.Secret, time.Now(), other))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/v1/admin/cameras/keys/rotate?camera=C12", "", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var rotated repo.CameraKey
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rotated))
+
+	rec = serve(http.MethodPost, "/v1/register", body("0003 AE-3"), signed("C12", key.Secret, time.Now(), body("0003 AE-3")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, "/v1/register", body("0003 AE-3"),
+		signed("C12", rotated.Secret, time.Now(), body("0003 AE-3")))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodGet, "/v1/admin/cameras", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), rotated.Secret)
+
+	rec = serve(http.MethodDelete, "/v1/admin/cameras/keys?camera=C12&key="+rotated.ID, "", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(http.MethodPost, "/v1/register", body("1234 AB-5"), signed("C12", rotated.Secret, time.Now(), body("1234 AB-5")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// TestCameraAuthOff checks that cameras are managed when signatures of registrations are not verified
+func TestCameraAuthOff(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	tokens, token := testTokens(t)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+	srv.cameras = camauth.NewKeyring(repo.NewTestCameraRepository(tempDir), time.Minute, clock.System)
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token(roleAdmin))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/v1/register", `{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodPost, "/v1/admin/cameras/keys?camera=C12", "")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var key repo.CameraKey
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &key))
+
+	rec = serve(http.MethodPost, "/v1/admin/cameras/keys/rotate?camera=C12", "")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodGet, "/v1/admin/cameras", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"C12"`)
+
+	rec = serve(http.MethodDelete, "/v1/admin/cameras/keys?camera=C12&key="+key.ID, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+func TestEvidence(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	tokens, token := testTokens(t)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+	srv.evidence = evidence.NewVerifier(repo.NewTestCameraRepository(tempDir), clock.System)
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token(roleAdmin))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rec := serve(http.MethodPost, "/v1/admin/cameras/publickeys?camera=C12",
+		`{"public_key":"`+base64.StdEncoding.EncodeToString(pub)+`"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	fixation := repo.SpeedFixation{
+		Date:          time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC),
+		VehicleNumber: "6048 EC-3",
+		Camera:        "C12",
+		Speed:         100.5,
+	}
+
+	body := `{"date":"2019-12-27T15:03:27Z","vehicle_number":"6048 EC-3","speed":100.5,"camera":"C12"`
+
+	rec = serve(http.MethodPost, "/v1/register", body+`}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"invalid_evidence"`)
+
+	rec = serve(http.MethodPost, "/v1/register", body+`,"signature":"`+evidence.Sign(priv, fixation)+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodGet, "/v1/evidence/verify?date=2019-12-27T15:03:27Z&vehicle_number=6048EC3&camera=C12", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var results []evidence.Result
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	require.Len(t, results, 1)
+	require.True(t, results[0].Valid, results[0].Reason)
+	require.Equal(t, evidence.KeyID(pub), results[0].Fixation.Evidence.KeyID)
+
+	rec = serve(http.MethodGet, "/v1/evidence/verify?date=2019-12-27T15:03:28Z&vehicle_number=6048EC3&camera=C12", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// gRPC registrations carry evidence signature too, rejected ones are kept as dead letters
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := srv.newGRPCServer()
+	defer s.Stop()
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	client := pb.NewSpeedControlClient(conn)
+
+	signed := func(plate string, second int) *pb.RegisterRequest {
+		f := repo.SpeedFixation{Date: time.Date(2019, 12, 27, 15, 4, second, 0, time.UTC), VehicleNumber: plate, Camera: "C12", Speed: 90}
+
+		date, err := ptypes.TimestampProto(f.Date)
+		require.NoError(t, err)
+
+		return &pb.RegisterRequest{
+			Fixation:  &pb.Fixation{Date: date, VehicleNumber: f.VehicleNumber, Camera: f.Camera, Speed: f.Speed},
+			Signature: evidence.Sign(priv, f),
+		}
+	}
+
+	resp, err := client.Register(context.Background(), signed("0003 AE-3", 0))
+	require.NoError(t, err)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, resp.Status)
+
+	unsigned := signed("1234 AB-5", 1)
+	unsigned.Signature = ""
+
+	_, err = client.Register(context.Background(), unsigned)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.RegisterBatch(context.Background())
+	require.NoError(t, err)
+
+	wrong := signed("8911 EE-3", 3)
+	wrong.Signature = signed("8911 EE-3", 4).Signature
+
+	for _, req := range []*pb.RegisterRequest{signed("7777 AA-7", 2), wrong} {
+		require.NoError(t, stream.Send(req))
+	}
+
+	batch, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, pb.RegisterStatus_ACCEPTED, batch.Results[0].Status)
+	require.Equal(t, pb.RegisterStatus_REJECTED, batch.Results[1].Status)
+
+	letters, err := srv.deadLetters.LookUp(repo.DeadLetterConditions{})
+	require.NoError(t, err)
+	require.Len(t, letters, 3)
+
+	for _, letter := range letters[1:] {
+		require.Equal(t, "/v1/register", letter.Path)
+		require.Equal(t, http.StatusBadRequest, letter.Status)
+	}
+
+	require.Contains(t, letters[1].Payload, `"vehicle_number":"1234 AB-5"`)
+	require.Contains(t, letters[2].Payload, `"vehicle_number":"8911 EE-3"`)
+	require.Contains(t, letters[2].Payload, `"signature":"`+wrong.Signature+`"`)
+}
+
+func TestAccessControl(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	tokens, token := testTokens(t)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+
+	require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{
+		Date:          time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC),
+		VehicleNumber: "6048 EC-3",
+		Camera:        "C12",
+		Speed:         100,
+	}))
+
+	// service hours are checked by other middleware, here only access is checked
+	search := srv.authorize(queryRoles, srv.pseudonymize(http.HandlerFunc(srv.search)))
+	today := "27.12.2019"
+
+	serve := func(h http.Handler, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve(search, "/v1/search?from="+today+"&to="+today, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today, token("camera"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	var fixations []repo.SpeedFixation
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today, token("officer"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fixations))
+	require.Len(t, fixations, 1)
+	require.Equal(t, "6048 EC-3", fixations[0].RawVehicleNumber)
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today, token("analyst"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fixations))
+	require.Len(t, fixations, 1)
+	require.Equal(t, srv.pseudonym("6048 EC-3"), fixations[0].VehicleNumber)
+	require.Equal(t, fixations[0].VehicleNumber, fixations[0].RawVehicleNumber)
+	require.Equal(t, "C12", fixations[0].Camera)
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today+"&filter="+url.QueryEscape(`plate = "6048EC3"`), token("analyst"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	rec = serve(handler, "/v1/admin/webhooks", token("officer"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// camera keys are issued, rotated and revoked only by admins
+	for _, target := range []struct{ method, path string }{
+		{http.MethodPost, "/v1/admin/cameras/keys?camera=C12"},
+		{http.MethodPost, "/v1/admin/cameras/keys/rotate?camera=C12"},
+		{http.MethodDelete, "/v1/admin/cameras/keys?camera=C12"},
+	} {
+		for tok, code := range map[string]int{"": http.StatusUnauthorized, token("officer"): http.StatusForbidden} {
+			req := httptest.NewRequest(target.method, target.path, nil)
+			if tok != "" {
+				req.Header.Set("Authorization", "Bearer "+tok)
+			}
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, code, rec.Code, target.method+" "+target.path)
+		}
+	}
+
+	rec = serve(handler, "/v1/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// without key set query routes stay open, officer and admin routes are closed
+	srv.tokens = nil
+
+	handler, err = srv.handler()
+	require.NoError(t, err)
+
+	rec = serve(handler, "/v1/admin/webhooks", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"unauthenticated"`)
+
+	rec = serve(handler, "/v1/admin/webhooks", token("admin"))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(handler, "/v1/platesearch?plate=6048EC3", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAudit(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	tokens, err := jwt.LoadKeySet(strings.NewReader(`{"keys":[{"kid":"k1","kty":"oct","k":"`+
+		base64.RawURLEncoding.EncodeToString(secret)+`"}]}`), jwt.Config{})
+	require.NoError(t, err)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+	srv.audits = repo.NewTestAuditRepository(filepath.Join(tempDir, "audit"), time.Hour, clock.System)
+
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "audit"), 0700))
+
+	for _, number := range []string{"6048 EC-3", "0003 AE-3"} {
+		require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{
+			Date:          time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC),
+			VehicleNumber: number,
+			Camera:        "C12",
+			Speed:         100,
+		}))
+	}
+
+	token := func(subject string, roles ...string) string {
+		token, err := jwt.Sign("k1", secret, jwt.Claims{Subject: subject, Expires: time.Now().Add(time.Hour).Unix(), Roles: roles})
+		require.NoError(t, err)
+
+		return token
+	}
+
+	search := srv.audit(srv.authorize(queryRoles, srv.pseudonymize(http.HandlerFunc(srv.search))))
+	audits := srv.authorize(adminRoles, http.HandlerFunc(srv.auditList))
+	today := "27.12.2019"
+
+	serve := func(h http.Handler, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve(search, "/v1/search?from="+today+"&to="+today, token("alice", "analyst"))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(search, "/v1/search?from="+today+"&to="+today+"&filter="+url.QueryEscape(`plate = "6048 EC-3"`), token("bob", "officer"))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// denied requests are recorded too
+	rec = serve(search, "/v1/search?from="+today+"&to="+today+"&filter="+url.QueryEscape(`plate = "6048 EC-3"`), token("alice", "analyst"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(audits, "/v1/admin/audit", token("bob", "officer"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	var entries []repo.AuditEntry
+
+	rec = serve(audits, "/v1/admin/audit?user=alice", token("root", "admin"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	require.Equal(t, "/search", entries[0].Path)
+	require.Equal(t, []string{"analyst"}, entries[0].Roles)
+	require.Equal(t, http.StatusOK, entries[0].Status)
+	require.Equal(t, 2, entries[0].Records)
+	require.Equal(t, http.StatusForbidden, entries[1].Status)
+	require.Equal(t, 0, entries[1].Records)
+
+	rec = serve(audits, "/v1/admin/audit?plate="+url.QueryEscape("6048EC3"), token("root", "admin"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	require.Equal(t, "bob", entries[0].User)
+	require.Equal(t, 1, entries[0].Records)
+	require.Equal(t, []string{today}, entries[0].Params["from"])
+
+	rec = serve(audits, "/v1/admin/audit?from="+url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)), token("root", "admin"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "[]", strings.TrimSpace(rec.Body.String()))
+
+	rec = serve(audits, "/v1/admin/audit?from=yesterday", token("root", "admin"))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// testCert issues certificate signed by parent, self-signed CA is issued when parent is nil
+func testCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	issuer, signer := template, crypto.Signer(key)
+
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey.(crypto.Signer)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestMutualTLS(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	ca := testCert(t, "ca", nil)
+	server := testCert(t, "server", &ca)
+
+	keyDER, err := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+
+	files := tlscert.Files{
+		Cert:     filepath.Join(tempDir, "cert.pem"),
+		Key:      filepath.Join(tempDir, "key.pem"),
+		ClientCA: filepath.Join(tempDir, "ca.pem"),
+	}
+
+	for path, block := range map[string]*pem.Block{
+		files.Cert:     {Type: "CERTIFICATE", Bytes: server.Certificate[0]},
+		files.Key:      {Type: "EC PRIVATE KEY", Bytes: keyDER},
+		files.ClientCA: {Type: "CERTIFICATE", Bytes: ca.Certificate[0]},
+	} {
+		require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	}
+
+	certs, err := tlscert.NewReloader(files)
+	require.NoError(t, err)
+
+	cameras := repo.NewTestCameraRepository(tempDir)
+	require.NoError(t, cameras.SaveCamera(repo.Camera{ID: "C12", Created: time.Now()}))
+
+	srv := testService(t, tempDir, clock.System)
+	srv.cameras = camauth.NewKeyring(cameras, time.Minute, clock.System)
+	srv.cameraRepo = cameras
+	srv.certs = certs
+	srv.clientCerts = true
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(handler)
+	ts.TLS = certs.Config(tls.VerifyClientCertIfGiven)
+	ts.StartTLS()
+
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	register := func(body string, certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+
+		resp, err := client.Post(ts.URL+"/v1/register", "application/json", strings.NewReader(body))
+		if err == nil {
+			require.NoError(t, resp.Body.Close())
+		}
+
+		return resp, err
+	}
+
+	body := func(plate, camera string) string {
+		return `{"date":"2019-12-27T15:03:27Z","vehicle_number":"` + plate + `","speed":100,"camera":"` + camera + `"}`
+	}
+
+	resp, err := register(body("6048 EC-3", ""))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = register(body("6048 EC-3", ""), testCert(t, "C12", &ca))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = register(body("0003 AE-3", "C14"), testCert(t, "C12", &ca))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = register(body("0003 AE-3", ""), testCert(t, "C99", &ca))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// certificate of other CA is not accepted
+	rogue := testCert(t, "rogue", nil)
+
+	resp, err = register(body("0003 AE-3", ""), testCert(t, "C12", &rogue))
+	if err == nil {
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// gRPC is served with the same certificates, camera is named by its certificate too
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := srv.newGRPCServer()
+	defer s.Stop()
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	date, err := ptypes.TimestampProto(time.Date(2019, 12, 27, 15, 3, 28, 0, time.UTC))
+	require.NoError(t, err)
+
+	registerGRPC := func(certs ...tls.Certificate) error {
+		conn, err := grpc.Dial(lis.Addr().String(),
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: certs})))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, conn.Close())
+		}()
+
+		_, err = pb.NewSpeedControlClient(conn).Register(context.Background(), &pb.RegisterRequest{
+			Fixation: &pb.Fixation{Date: date, VehicleNumber: "1234 AB-5", Speed: 100},
+		})
+
+		return err
+	}
+
+	require.Equal(t, codes.Unauthenticated, status.Code(registerGRPC()))
+	require.Equal(t, codes.Unauthenticated, status.Code(registerGRPC(testCert(t, "C99", &ca))))
+	require.NoError(t, registerGRPC(testCert(t, "C12", &ca)))
+
+	all, err := filter.Parse("")
+	require.NoError(t, err)
+
+	day := time.Date(2019, 12, 27, 0, 0, 0, 0, time.UTC)
+
+	fixations, err := srv.uc.SearchFixations(context.Background(), day, day, all)
+	require.NoError(t, err)
+	require.Len(t, fixations, 2)
+
+	for _, fixation := range fixations {
+		require.Equal(t, "C12", fixation.Camera)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	tokens, token := testTokens(t)
+
+	srv := testService(t, tempDir, clock.System)
+	srv.tokens = tokens
+	srv.pseudonymKey = []byte("pseudonyms")
+	srv.ingestionLimits = ratelimit.NewLimiter(ratelimit.Config{Rate: 0.5, Burst: 1})
+	srv.queryLimits = ratelimit.NewLimiter(ratelimit.Config{Rate: 0.5, Burst: 1})
+	srv.maxBodySize = 100
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token(roleAdmin))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	body := func(plate string) string {
+		return `{"date":"2019-12-27T15:03:27Z","vehicle_number":"` + plate + `","speed":100}`
+	}
+
+	rec := serve(http.MethodPost, "/v1/register", body("6048 EC-3"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// budget is checked before the body is read
+	rec = serve(http.MethodPost, "/v1/register", `{"vehicle_number":"`+strings.Repeat("1", 100)+`"}`)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("Retry-After"))
+	require.Contains(t, rec.Body.String(), `"code":"rate_limited"`)
+
+	// client naming a camera gets the budget of the camera at its address
+	req := httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader(`{"vehicle_number":"`+strings.Repeat("1", 100)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(camauth.CameraHeader, "C12")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"body_too_large"`)
+
+	// queries have their own budget
+	rec = serve(http.MethodGet, "/v1/admin/ratelimits", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats map[string]ratelimit.Stats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, uint64(2), stats["ingestion"].Allowed)
+	require.Equal(t, map[string]uint64{"ip:192.0.2.1": 1}, stats["ingestion"].Clients)
+
+	rec = serve(http.MethodGet, "/v1/admin/ratelimits", "")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, uint64(1), srv.queryLimits.Stats().Throttled)
+}
+
+func TestServiceHours(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	srv := testService(t, tempDir, clock.System)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		handler, err := srv.handler()
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return rec
+	}
+
+	// routes are open around the clock except today, which is a holiday
+	today := time.Now().UTC()
+	tomorrow := time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	schedules, err := schedule.New(schedule.Config{
+		TimeZone: "UTC",
+		Holidays: []string{today.Format("2006-01-02")},
+		Rules:    []schedule.Rule{{Days: "*", Hours: "00:00-24:00"}},
+	})
+	require.NoError(t, err)
+
+	srv.schedules = schedules
+
+	rec := serve("/v1/minmaxspeed?date=" + today.Format("02.01.2006"))
+	require.Equal(t, http.StatusNotAcceptable, rec.Code)
+
+	retry, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, time.Until(tomorrow).Seconds(), retry, 2)
+
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, codeOutOfServiceHours, resp.Error.Code)
+	require.True(t, tomorrow.Equal(*resp.Error.OpensAt))
+
+	// routes have own schedules, route which never opens has no opening time
+	srv.schedules, err = schedule.New(schedule.Config{
+		Routes: map[string][]schedule.Rule{"/minmaxspeed": {{Days: "*", Hours: "00:00-24:00"}}},
+	})
+	require.NoError(t, err)
+
+	rec = serve("/v1/minmaxspeed?date=" + today.Format("02.01.2006"))
+	require.NotEqual(t, http.StatusNotAcceptable, rec.Code)
+
+	rec = serve("/v1/overspeed?date=" + today.Format("02.01.2006") + "&speed=60")
+	require.Equal(t, http.StatusNotAcceptable, rec.Code)
+	require.Empty(t, rec.Header().Get("Retry-After"))
+	require.NotContains(t, rec.Body.String(), "opens_at")
+
+	// schedule of route which has no service hours is refused at startup
+	for _, route := range []string{"/v1/feed", "/register", "/openapi.json"} {
+		srv.schedules, err = schedule.New(schedule.Config{
+			Routes: map[string][]schedule.Rule{route: {{Days: "*", Hours: "00:00-24:00"}}},
+		})
+		require.NoError(t, err)
+
+		_, err = srv.handler()
+		require.Error(t, err, route)
+	}
+
+	// service hours are in local time unless serviceTimeZone is set
+	schedules, err = serviceSchedules()
+	require.NoError(t, err)
+	require.Equal(t, time.Local, schedules.Location())
+
+	// shipped schedule names known routes
+	require.NoError(t, os.Setenv("scheduleFile", filepath.Join("..", "..", "configs", "schedule.json")))
+	defer os.Unsetenv("scheduleFile")
+
+	srv.schedules, err = serviceSchedules()
+	require.NoError(t, err)
+
+	_, err = srv.handler()
+	require.NoError(t, err)
+}
+
+func TestServiceHoursBoundaries(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	fake := clock.NewFake(time.Date(2019, 3, 30, 9, 29, 59, 0, time.UTC))
+
+	srv := testService(t, tempDir, fake)
+
+	schedules, err := schedule.New(schedule.Config{
+		TimeZone: "Europe/Berlin",
+		Rules:    []schedule.Rule{{Days: "*", Hours: "09:30-22:00"}},
+	})
+	require.NoError(t, err)
+
+	srv.schedules = schedules
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		open    bool
+		retry   string
+		opensAt time.Time
+	}{
+		{
+			name:    "second before opening",
+			now:     time.Date(2019, 3, 30, 9, 29, 59, 0, berlin),
+			retry:   "1",
+			opensAt: time.Date(2019, 3, 30, 9, 30, 0, 0, berlin),
+		},
+		{
+			name: "opening",
+			now:  time.Date(2019, 3, 30, 9, 30, 0, 0, berlin),
+			open: true,
+		},
+		{
+			name: "second before closing",
+			now:  time.Date(2019, 3, 30, 21, 59, 59, 0, berlin),
+			open: true,
+		},
+		{
+			// clocks go forward at night, so service opens in 10.5 hours instead of 11.5
+			name:    "closing before daylight saving time",
+			now:     time.Date(2019, 3, 30, 22, 0, 0, 0, berlin),
+			retry:   strconv.Itoa(int((10*time.Hour + 30*time.Minute).Seconds())),
+			opensAt: time.Date(2019, 3, 31, 9, 30, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Set(tt.now)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/minmaxspeed?date=30.03.2019", nil))
+
+			if tt.open {
+				require.NotEqual(t, http.StatusNotAcceptable, rec.Code)
+				return
+			}
+
+			require.Equal(t, http.StatusNotAcceptable, rec.Code)
+			require.Equal(t, tt.retry, rec.Header().Get("Retry-After"))
+
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.True(t, tt.opensAt.Equal(*resp.Error.OpensAt))
+		})
+	}
+}
+
+func TestOffenderReports(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	dir := filepath.Join(tempDir, "reports")
+
+	require.NoError(t, os.Setenv("offenderReportDir", dir))
+	defer os.Unsetenv("offenderReportDir")
+
+	// it is the 28th in the zone of service clock and still the 27th in UTC
+	fake := clock.NewFake(time.Date(2019, 12, 28, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60)))
+
+	srv := testService(t, tempDir, fake)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, srv.uc.CreateRecord(context.Background(), repo.SpeedFixation{
+			Date:          time.Date(2019, 12, 27, 10, i, 0, 0, time.UTC),
+			VehicleNumber: "6048 EC-3",
+			Speed:         90,
+		}))
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		srv.offenderReports(stop)
+		close(done)
+	}()
+
+	path := filepath.Join(dir, "repeat_offenders_27.12.2019.json")
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	<-done
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var report struct {
+		Conditions repo.RepeatOffenderConditions `json:"conditions"`
+		Offenders  []repo.Offender               `json:"offenders"`
+	}
+
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, time.UTC, report.Conditions.Date.Location())
+	require.Len(t, report.Offenders, 1)
+	require.Len(t, report.Offenders[0].Violations, 3)
+}
+
+func TestShutdown(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	// reports would be written to the working directory
+	require.NoError(t, os.Setenv("offenderReportInterval", "0"))
+	defer os.Unsetenv("offenderReportInterval")
+
+	fixation := repo.SpeedFixation{Date: time.Now().UTC(), VehicleNumber: "6048 EC-3", Speed: 62.8}
+
+	// start runs service which registration waits for release, it returns URL, signal channel
+	// and result of run, started receives a value when registration is in flight
+	start := func(dir string, timeout time.Duration, started chan<- struct{}, release <-chan struct{}) (*service, string, chan<- os.Signal, <-chan error) {
+		srv := testService(t, dir, clock.System)
+		srv.feed = feed.NewHub(10, clock.System)
+
+		httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+
+			<-release
+
+			if err := srv.uc.CreateRecord(context.Background(), fixation); err != nil {
+				responseError(w, err)
+				return
+			}
+
+			makeResponse(w, "register success")
+		})}
+
+		httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		signals := make(chan os.Signal, 1)
+		done := make(chan error, 1)
+
+		go func() {
+			done <- srv.run(httpServer, httpLis, srv.newGRPCServer(), grpcLis, signals, timeout)
+		}()
+
+		return srv, "http://" + httpLis.Addr().String(), signals, done
+	}
+
+	register := func(url string) <-chan *http.Response {
+		responses := make(chan *http.Response, 1)
+
+		go func() {
+			resp, err := http.Get(url)
+			if err != nil {
+				responses <- nil
+				return
+			}
+
+			_ = resp.Body.Close()
+			responses <- resp
+		}()
+
+		return responses
+	}
+
+	t.Run("in-flight request is finished", func(t *testing.T) {
+		dir := filepath.Join(tempDir, "drained")
+		require.NoError(t, os.Mkdir(dir, 0755))
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		srv, url, signals, done := start(dir, time.Minute, started, release)
+
+		responses := register(url)
+		<-started
+
+		// the live feed does not hold shutdown
+		sub := srv.feed.Subscribe(feed.Filter{}, 0)
+
+		signals <- os.Interrupt
+
+		_, ok := <-sub.Events()
+		require.False(t, ok)
+
+		// new connections are refused while the request is in flight
+		for i := 0; ; i++ {
+			if _, err := http.Get(url); err != nil {
+				break
+			}
+
+			require.True(t, i < 100, "server accepts connections")
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		close(release)
+
+		resp := <-responses
+		require.NotNil(t, resp)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.NoError(t, <-done)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, time.Now().Format("02.01.2006")+".json"))
+		require.NoError(t, err)
+		require.Contains(t, string(data), fixation.VehicleNumber)
+
+		require.True(t, errors.Is(srv.uc.CreateRecord(context.Background(), fixation), repo.ErrClosed))
+	})
+
+	t.Run("deadline is exceeded", func(t *testing.T) {
+		dir := filepath.Join(tempDir, "timeout")
+		require.NoError(t, os.Mkdir(dir, 0755))
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		_, url, signals, done := start(dir, 50*time.Millisecond, started, release)
+
+		responses := register(url)
+		<-started
+
+		signals <- os.Interrupt
+
+		require.True(t, errors.Is(<-done, errShutdownTimeout))
+
+		// the request is cut, but its write is rejected rather than half done
+		close(release)
+		require.Nil(t, <-responses)
+
+		_, err := os.Stat(filepath.Join(dir, time.Now().Format("02.01.2006")+".json"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	tempDir, dropFile := createTempDir(t)
+	defer dropFile()
+
+	fillTestData(t, tempDir)
+
+	routes, err := parseTimeouts("/v1/minmaxspeed:0, /overspeed:1ns")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"/minmaxspeed": 0, "/overspeed": time.Nanosecond}, routes)
+
+	_, err = parseTimeouts("/overspeed=1s")
+	require.Error(t, err)
+
+	// the default timeout passes before the day file is read, the zero one is disabled
+	srv := testService(t, tempDir, clock.System)
+	srv.timeouts = endpointTimeouts{Default: time.Nanosecond, Routes: routes}
+
+	handler, err := srv.handler()
+	require.NoError(t, err)
+
+	today := time.Now().Format("02.01.2006")
+
+	for target, code := range map[string]int{
+		"/v1/overspeed?date=" + today + "&speed=60": http.StatusGatewayTimeout,
+		"/v1/statistics?date=" + today:              http.StatusGatewayTimeout,
+		"/v1/minmaxspeed?date=" + today:             http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, code, rec.Code, target)
+
+		if code == http.StatusGatewayTimeout {
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.Equal(t, codeTimeout, resp.Error.Code)
+		}
+	}
+
+	// client which went away stops reading of the day file
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = srv.uc.LookUpMinMaxSpeedByDate(ctx, time.Now())
+	require.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,155 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"google.golang.org/grpc"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/env"
+)
+
+// errShutdownTimeout is returned when requests or workers do not finish before the shutdown deadline
+var errShutdownTimeout = errors.New("shutdown deadline exceeded")
+
+// startWorkers runs background workers of service until stop is closed
+func (srv *service) startWorkers(stop <-chan struct{}, workers *sync.WaitGroup) {
+	run := func(worker func()) {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+			worker()
+		}()
+	}
+
+	run(func() { srv.offenderReports(stop) })
+
+	if srv.webhooks != nil {
+		run(func() { srv.webhooks.Run(stop) })
+	}
+
+	if srv.certs != nil {
+		interval := env.GetDuration("tlsReloadInterval", time.Minute)
+		run(func() { srv.certs.Watch(interval, stop) })
+	}
+}
+
+// serveHTTP serves HTTP server on listener, it serves TLS when server has TLS configuration
+func serveHTTP(server *http.Server, lis net.Listener) error {
+	if server.TLSConfig == nil {
+		log.Printf("Start server at %v ...", lis.Addr())
+		return server.Serve(lis)
+	}
+
+	log.Printf("Start TLS server at %v ...", lis.Addr())
+
+	return server.ServeTLS(lis, "", "")
+}
+
+// run serves HTTP and gRPC servers and runs background workers until signal is received or
+// server fails, then shuts service down. Nil is returned when service stopped gracefully.
+func (srv *service) run(httpServer *http.Server, httpLis net.Listener, grpcServer *grpc.Server, grpcLis net.Listener,
+	signals <-chan os.Signal, timeout time.Duration) error {
+	var (
+		stop    = make(chan struct{})
+		workers sync.WaitGroup
+		failed  = make(chan error, 2)
+	)
+
+	srv.startWorkers(stop, &workers)
+
+	go func() {
+		if err := serveHTTP(httpServer, httpLis); err != http.ErrServerClosed {
+			failed <- errors.Wrap(err, "HTTP server failed")
+		}
+	}()
+
+	go func() {
+		log.Printf("Start gRPC server at %v ...", grpcLis.Addr())
+
+		// Serve returns nil after the server is stopped
+		if err := grpcServer.Serve(grpcLis); err != nil {
+			failed <- errors.Wrap(err, "gRPC server failed")
+		}
+	}()
+
+	var cause error
+
+	select {
+	case sig := <-signals:
+		log.Printf("%v is received, shutting down ...", sig)
+	case cause = <-failed:
+		log.Println("shutting down:", cause)
+	}
+
+	err := srv.shutdown(httpServer, grpcServer, stop, &workers, timeout)
+	if cause != nil {
+		return cause
+	}
+
+	return err
+}
+
+// shutdown stops accepting connections, waits for in-flight requests and workers until timeout
+// and closes repository. Repository is closed after timeout too, so late writes are rejected
+// rather than cut.
+func (srv *service) shutdown(httpServer *http.Server, grpcServer *grpc.Server, stop chan struct{},
+	workers *sync.WaitGroup, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	close(stop)
+
+	// live feeds never finish by themselves, their clients resume after reconnect
+	if srv.feed != nil {
+		srv.feed.Close()
+	}
+
+	grpcStopped := make(chan struct{})
+
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	workersStopped := make(chan struct{})
+
+	go func() {
+		workers.Wait()
+		close(workersStopped)
+	}()
+
+	var ret error
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		ret = errors.Wrap(errShutdownTimeout, "HTTP requests are not finished")
+		_ = httpServer.Close()
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		ret = errors.Wrap(errShutdownTimeout, "gRPC calls are not finished")
+		grpcServer.Stop()
+	}
+
+	select {
+	case <-workersStopped:
+	case <-ctx.Done():
+		ret = errors.Wrap(errShutdownTimeout, "background workers are not finished")
+	}
+
+	if err := srv.uc.Close(); err != nil {
+		return errors.Wrap(err, "unable close repository")
+	}
+
+	return ret
+}
@@ -0,0 +1,85 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/pkg/env"
+)
+
+// endpointTimeouts are deadlines of requests, routes without own timeout use Default, zero timeout disables it
+type endpointTimeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// parseTimeouts parses timeouts of routes like "/search:30s,/repeatoffenders:1m"
+func parseTimeouts(s string) (map[string]time.Duration, error) {
+	ret := make(map[string]time.Duration)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid endpoint timeout", j.KV("timeout", item))
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout < 0 {
+			return nil, errors.New("invalid endpoint timeout", j.KV("timeout", item))
+		}
+
+		ret[routePath(strings.TrimSpace(parts[0]))] = timeout
+	}
+
+	return ret, nil
+}
+
+// serviceTimeouts reads timeouts of endpoints configured by requestTimeout and endpointTimeouts
+func serviceTimeouts() (endpointTimeouts, error) {
+	routes, err := parseTimeouts(env.GetString("endpointTimeouts", ""))
+	if err != nil {
+		return endpointTimeouts{}, err
+	}
+
+	return endpointTimeouts{Default: env.GetDuration("requestTimeout", 30*time.Second), Routes: routes}, nil
+}
+
+// route returns timeout of route
+func (t endpointTimeouts) route(path string) time.Duration {
+	if timeout, ok := t.Routes[path]; ok {
+		return timeout
+	}
+
+	return t.Default
+}
+
+// withTimeout returns context of request to route which is done when timeout of route passes
+func (srv *service) withTimeout(ctx context.Context, route string) (context.Context, context.CancelFunc) {
+	timeout := srv.timeouts.route(route)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeout cancels requests to route which take longer than timeout of route
+func (srv *service) timeout(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := srv.withTimeout(r.Context(), route)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
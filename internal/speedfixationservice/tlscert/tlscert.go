@@ -0,0 +1,161 @@
+// Package tlscert provides TLS configuration of server which reloads its certificate when files change
+package tlscert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// Files are the PEM files of server, client CA is required only by mutual TLS
+type Files struct {
+	Cert     string
+	Key      string
+	ClientCA string
+}
+
+// Reloader keeps the certificate and client CA pool loaded from files, they are reloaded
+// when modification time of any file changes
+type Reloader struct {
+	files Files
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader loads files, the error is returned when they can not be used
+func NewReloader(files Files) (*Reloader, error) {
+	r := &Reloader{files: files}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) paths() []string {
+	paths := []string{r.files.Cert, r.files.Key}
+	if r.files.ClientCA != "" {
+		paths = append(paths, r.files.ClientCA)
+	}
+
+	return paths
+}
+
+// changed returns modification times of files when they differ from loaded ones
+func (r *Reloader) changed() (map[string]time.Time, bool, error) {
+	modTimes := make(map[string]time.Time)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	changed := r.modTimes == nil
+
+	for _, path := range r.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false, err
+		}
+
+		modTimes[path] = info.ModTime()
+		changed = changed || !info.ModTime().Equal(r.modTimes[path])
+	}
+
+	return modTimes, changed, nil
+}
+
+// Reload loads files when they changed and reports whether they were reloaded,
+// the previous certificate is kept when new files are invalid
+func (r *Reloader) Reload() (bool, error) {
+	modTimes, changed, err := r.changed()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+	if err != nil {
+		return false, errors.Wrap(err, "unable load certificate", j.KV("cert", r.files.Cert))
+	}
+
+	var pool *x509.CertPool
+
+	if r.files.ClientCA != "" {
+		data, err := ioutil.ReadFile(r.files.ClientCA)
+		if err != nil {
+			return false, err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return false, errors.New("no certificates in client CA file", j.KV("client_ca", r.files.ClientCA))
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCA, r.modTimes = &cert, pool, modTimes
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch reloads changed files every interval until stop is closed
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.Reload()
+		switch {
+		case err != nil:
+			log.Println("unable reload TLS certificate, the previous one is used:", err)
+		case reloaded:
+			log.Println("TLS certificate is reloaded")
+		}
+	}
+}
+
+// GetCertificate returns the last loaded certificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Config returns server configuration, every handshake uses the last loaded certificate
+// and client CA. Client certificates are verified when clientAuth requests them.
+func (r *Reloader) Config(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		// client CA pool can not be replaced in config, so config of every handshake is created
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.clientCA,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
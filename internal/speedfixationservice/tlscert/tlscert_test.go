@@ -0,0 +1,114 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes self-signed certificate and its key as PEM files
+func writeCert(t *testing.T, dir, name string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"cert.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+
+	for file, data := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+}
+
+func subject(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	config, err := r.Config(tls.NoClientCert).GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+
+	return cert.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlscert")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	files := Files{Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	modTime := time.Now().Add(-time.Minute)
+
+	_, err = NewReloader(files)
+	require.Error(t, err)
+
+	writeCert(t, dir, "first", modTime)
+
+	r, err := NewReloader(files)
+	require.NoError(t, err)
+	require.Equal(t, "first", subject(t, r))
+
+	reloaded, err := r.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	writeCert(t, dir, "second", modTime.Add(time.Second))
+
+	reloaded, err = r.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.Equal(t, "second", subject(t, r))
+
+	// broken files do not replace working certificate
+	require.NoError(t, ioutil.WriteFile(files.Key, []byte("broken"), 0600))
+
+	_, err = r.Reload()
+	require.Error(t, err)
+	require.Equal(t, "second", subject(t, r))
+
+	// client CA file must contain certificates
+	writeCert(t, dir, "third", modTime.Add(2*time.Second))
+	files.ClientCA = files.Key
+
+	_, err = NewReloader(files)
+	require.Error(t, err)
+}
@@ -2,33 +2,347 @@
 package usecase
 
 import (
+	"context"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/platesearch"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
 )
 
 type speedFixationUsecase struct {
 	contactRepo repo.SpeedControlRepo
+	plates      *plate.Validator
+	pipeline    *ValidationPipeline
+	notifiers   []Notifier
+	outboxes    []Outbox
+	// clock tells the time of registration checked by validation rules
+	clock clock.Clock
 }
 
-// NewSpeedFixationUsecase will create new an SpeedControl object representation of SpeedControlRepo interface
-func NewSpeedFixationUsecase(cr repo.SpeedControlRepo) SpeedControl {
-	return &speedFixationUsecase{
+// NewSpeedFixationUsecase will create new an SpeedControl object representation of SpeedControlRepo interface,
+// notifiers receive every stored fixation, notifiers implementing Outbox hold notifications of every registration
+func NewSpeedFixationUsecase(cr repo.SpeedControlRepo, pv *plate.Validator, vp *ValidationPipeline, clk clock.Clock,
+	notifiers ...Notifier) SpeedControl {
+	ret := &speedFixationUsecase{
 		contactRepo: cr,
+		plates:      pv,
+		pipeline:    vp,
+		clock:       clk,
+	}
+
+	for _, n := range notifiers {
+		if o, ok := n.(Outbox); ok {
+			ret.outboxes = append(ret.outboxes, o)
+			continue
+		}
+
+		ret.notifiers = append(ret.notifiers, n)
+	}
+
+	return ret
+}
+
+// CreateRecord receives information from the camera, normalizes and validates it and calls the save method
+func (sf speedFixationUsecase) CreateRecord(ctx context.Context, fixation repo.SpeedFixation) error {
+	fixation, quarantined, err := sf.prepare(fixation)
+	if quarantined != nil {
+		if qerr := sf.contactRepo.QuarantineRecord(ctx, *quarantined); qerr != nil {
+			return qerr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	release, err := sf.hold(fixation)
+	if err != nil {
+		return err
+	}
+
+	err = sf.contactRepo.CreateRecord(ctx, fixation)
+	release(err == nil)
+
+	if err != nil {
+		return err
+	}
+
+	sf.notify(fixation)
+
+	return nil
+}
+
+// hold stores notifications of fixation in all outboxes, they are released by the returned function
+// with the outcome of the store. Notifications already held are canceled when some outbox fails.
+func (sf speedFixationUsecase) hold(fixation repo.SpeedFixation) (func(stored bool), error) {
+	releases := make([]func(bool), 0, len(sf.outboxes))
+
+	release := func(stored bool) {
+		for _, r := range releases {
+			r(stored)
+		}
+	}
+
+	for _, o := range sf.outboxes {
+		r, err := o.Hold(fixation)
+		if err != nil {
+			release(false)
+			return nil, err
+		}
+
+		releases = append(releases, r)
+	}
+
+	return release, nil
+}
+
+func (sf speedFixationUsecase) notify(fixation repo.SpeedFixation) {
+	sf.pipeline.Notify(fixation)
+
+	for _, n := range sf.notifiers {
+		n.Notify(fixation)
+	}
+}
+
+// CreateRecords receives batch of fixations from the camera and saves all valid ones at once,
+// it returns error of every fixation which is not saved. Quarantined fixations are stored only
+// after the batch, so failed batch leaves nothing in quarantine.
+func (sf speedFixationUsecase) CreateRecords(ctx context.Context, fixations []repo.SpeedFixation) ([]error, error) {
+	var (
+		ret         = make([]error, len(fixations))
+		valid       = make([]repo.SpeedFixation, 0, len(fixations))
+		pos         = make([]int, 0, len(fixations))
+		quarantined = make(map[int]repo.QuarantinedFixation)
+	)
+
+	for i, fixation := range fixations {
+		fixation, q, err := sf.prepare(fixation)
+		if q != nil {
+			quarantined[i] = *q
+		}
+
+		if err != nil {
+			ret[i] = err
+			continue
+		}
+
+		valid = append(valid, fixation)
+		pos = append(pos, i)
+	}
+
+	if len(valid) > 0 {
+		releases := make([]func(bool), 0, len(valid))
+
+		for _, fixation := range valid {
+			release, err := sf.hold(fixation)
+			if err != nil {
+				for _, r := range releases {
+					r(false)
+				}
+
+				return nil, err
+			}
+
+			releases = append(releases, release)
+		}
+
+		errs, err := sf.contactRepo.CreateRecords(ctx, valid)
+		if err != nil {
+			for _, r := range releases {
+				r(false)
+			}
+
+			return nil, err
+		}
+
+		for i, err := range errs {
+			ret[pos[i]] = err
+			releases[i](err == nil)
+
+			if err == nil {
+				sf.notify(valid[i])
+			}
+		}
+	}
+
+	for i := range fixations {
+		if q, ok := quarantined[i]; ok {
+			if err := sf.contactRepo.QuarantineRecord(ctx, q); err != nil {
+				ret[i] = err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// normalize stores raw vehicle number and replaces it with normalized and validated one
+func (sf speedFixationUsecase) normalize(fixation repo.SpeedFixation) (repo.SpeedFixation, error) {
+	var err error
+
+	fixation.RawVehicleNumber = fixation.VehicleNumber
+	fixation.VehicleNumber = plate.Normalize(fixation.RawVehicleNumber)
+
+	if fixation.Country, err = sf.plates.Validate(fixation.VehicleNumber); err != nil {
+		return repo.SpeedFixation{}, errors.Wrap(err, "invalid vehicle number", j.KV("vehicle_number", fixation.RawVehicleNumber))
 	}
+
+	return fixation, nil
 }
 
-// CreateRecord receives information from the camera and calls the save method
-func (sf speedFixationUsecase) CreateRecord(fixation repo.SpeedFixation) error {
-	return sf.contactRepo.CreateRecord(fixation)
+// prepare normalizes fixation and runs validation pipeline, fixations broken rules with flag action
+// are returned with flags. Fixations broken rules with quarantine action are returned with ErrQuarantined
+// and quarantine record, caller stores it when the outcome of the registration is known.
+func (sf speedFixationUsecase) prepare(fixation repo.SpeedFixation) (repo.SpeedFixation, *repo.QuarantinedFixation, error) {
+	fixation, err := sf.normalize(fixation)
+	if err != nil {
+		return repo.SpeedFixation{}, nil, err
+	}
+
+	now := sf.clock.Now()
+
+	action, reasons := sf.pipeline.check(fixation, now)
+
+	switch action {
+	case ActionReject:
+		return repo.SpeedFixation{}, nil, errors.Wrap(ErrRejected, strings.Join(reasons, "; "))
+	case ActionQuarantine:
+		quarantined := &repo.QuarantinedFixation{Fixation: fixation, Reasons: reasons, Quarantined: now}
+		return repo.SpeedFixation{}, quarantined, errors.Wrap(ErrQuarantined, strings.Join(reasons, "; "))
+	case ActionFlag:
+		fixation.Flags = reasons
+	}
+
+	return fixation, nil, nil
+}
+
+// LookUpFlaggedByDate returns fixations of the day which broke validation rules
+func (sf speedFixationUsecase) LookUpFlaggedByDate(ctx context.Context, date time.Time) (repo.FlaggedRecords, error) {
+	var ret repo.FlaggedRecords
+
+	fixations, err := sf.contactRepo.LookUpFixations(ctx, repo.SearchConditions{
+		From:     date,
+		To:       date,
+		MinSpeed: math.Inf(-1),
+		MaxSpeed: math.Inf(1),
+	})
+	if err != nil {
+		return repo.FlaggedRecords{}, err
+	}
+
+	for _, fixation := range fixations {
+		if len(fixation.Flags) > 0 {
+			ret.Flagged = append(ret.Flagged, fixation)
+		}
+	}
+
+	if ret.Quarantined, err = sf.contactRepo.LookUpQuarantinedByDate(ctx, date); err != nil {
+		return repo.FlaggedRecords{}, err
+	}
+
+	return ret, nil
+}
+
+// ValidationStats returns counters of validation rules
+func (sf speedFixationUsecase) ValidationStats() map[string]RuleStats {
+	return sf.pipeline.Stats()
+}
+
+// Close waits for pending writes and closes repository
+func (sf speedFixationUsecase) Close() error {
+	return sf.contactRepo.Close()
 }
 
 // LookUpOverSpeedByDate receivers the search criteria and calls the violators search function
-func (sf speedFixationUsecase) LookUpOverSpeedByDate(fixation repo.SpeedFixation) ([]repo.SpeedFixation, error) {
-	return sf.contactRepo.LookUpOverSpeedByDate(fixation)
+func (sf speedFixationUsecase) LookUpOverSpeedByDate(ctx context.Context, fixation repo.SpeedFixation) ([]repo.SpeedFixation, error) {
+	return sf.contactRepo.LookUpOverSpeedByDate(ctx, fixation)
 }
 
 // LookUpMinMaxSpeedByDate receivers the search criteria and calls the search method which return min & max speeds
-func (sf speedFixationUsecase) LookUpMinMaxSpeedByDate(date time.Time) ([]repo.SpeedFixation, error) {
-	return sf.contactRepo.LookUpMinMaxSpeedByDate(date)
+func (sf speedFixationUsecase) LookUpMinMaxSpeedByDate(ctx context.Context, date time.Time) ([]repo.SpeedFixation, error) {
+	return sf.contactRepo.LookUpMinMaxSpeedByDate(ctx, date)
+}
+
+// LookUpSpeedStatisticsByDate receivers the date and calls the search method which return speed statistics of the day
+func (sf speedFixationUsecase) LookUpSpeedStatisticsByDate(ctx context.Context, date time.Time) (repo.SpeedStatistics, error) {
+	return sf.contactRepo.LookUpSpeedStatisticsByDate(ctx, date)
+}
+
+// LookUpRepeatOffenders receivers the search criteria and calls the search method which return vehicles
+// exceeding the speed limit repeatedly
+func (sf speedFixationUsecase) LookUpRepeatOffenders(ctx context.Context, conditions repo.RepeatOffenderConditions) ([]repo.Offender, error) {
+	return sf.contactRepo.LookUpRepeatOffenders(ctx, conditions)
+}
+
+// LookUpFixationsByVehicleNumber returns all stored fixations of the vehicle
+func (sf speedFixationUsecase) LookUpFixationsByVehicleNumber(ctx context.Context, number string) ([]repo.SpeedFixation, error) {
+	number = plate.Normalize(number)
+
+	fixations, err := sf.contactRepo.LookUpFixationsByVehicleNumbers(ctx, []string{number})
+	if err != nil {
+		return nil, err
+	}
+
+	return fixations[number], nil
+}
+
+// SearchPlates looks for vehicle numbers similar to the query and returns them ranked with their fixations
+func (sf speedFixationUsecase) SearchPlates(ctx context.Context, query platesearch.Query) ([]repo.PlateCandidate, error) {
+	numbers, err := sf.contactRepo.LookUpVehicleNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := platesearch.Search(query, numbers)
+
+	numbers = numbers[:0]
+	for _, c := range candidates {
+		numbers = append(numbers, c.VehicleNumber)
+	}
+
+	fixations, err := sf.contactRepo.LookUpFixationsByVehicleNumbers(ctx, numbers)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]repo.PlateCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		ret = append(ret, repo.PlateCandidate{
+			VehicleNumber: c.VehicleNumber,
+			Distance:      c.Distance,
+			Fixations:     fixations[c.VehicleNumber],
+		})
+	}
+
+	return ret, nil
+}
+
+// SearchFixations pushes date and speed criteria of filter expression down to the storage
+// and returns stored fixations matched by expression
+func (sf speedFixationUsecase) SearchFixations(ctx context.Context, from, to time.Time, expr filter.Expr) ([]repo.SpeedFixation, error) {
+	conditions := repo.SearchConditions{From: from, To: to}
+	conditions.MinSpeed, conditions.MaxSpeed = filter.SpeedBounds(expr)
+
+	fixations, err := sf.contactRepo.LookUpFixations(ctx, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := fixations[:0]
+
+	for _, fixation := range fixations {
+		if expr.Match(fixation) {
+			ret = append(ret, fixation)
+		}
+	}
+
+	return ret, nil
 }
@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// failingRepo fails batch writes
+type failingRepo struct {
+	repo.SpeedControlRepo
+	fail bool
+}
+
+func (r *failingRepo) CreateRecords(ctx context.Context, fixations []repo.SpeedFixation) ([]error, error) {
+	if r.fail {
+		return nil, errors.New("disk is full")
+	}
+
+	return r.SpeedControlRepo.CreateRecords(ctx, fixations)
+}
+
+func TestCreateRecords_Quarantine(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "usecase")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	pv, err := plate.NewValidator(plate.DefaultRules)
+	require.NoError(t, err)
+
+	now := time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+
+	fr := &failingRepo{SpeedControlRepo: repo.NewTestSpeedFixationRepository(tempDir, clock.NewFake(now)), fail: true}
+
+	uc := NewSpeedFixationUsecase(fr, pv,
+		NewValidationPipeline(
+			ValidationRule{Rule: SpeedBoundsRule{Min: 0, Max: 300}, Action: ActionQuarantine},
+			ValidationRule{Rule: &DuplicateRule{Window: time.Second}, Action: ActionReject},
+		), clock.NewFake(now))
+
+	batch := []repo.SpeedFixation{
+		{Date: now, VehicleNumber: "6048 EC-3", Camera: "C12", Speed: 400},
+		{Date: now, VehicleNumber: "0003 AE-3", Camera: "C12", Speed: 62.8},
+	}
+
+	// failed batch neither quarantines fixations nor remembers them as duplicates
+	_, err = uc.CreateRecords(context.Background(), batch)
+	require.Error(t, err)
+
+	got, err := uc.LookUpFlaggedByDate(context.Background(), now)
+	require.NoError(t, err)
+	require.Empty(t, got.Quarantined)
+
+	fr.fail = false
+
+	errs, err := uc.CreateRecords(context.Background(), batch)
+	require.NoError(t, err)
+	require.True(t, errors.Is(errs[0], ErrQuarantined))
+	require.NoError(t, errs[1])
+
+	got, err = uc.LookUpFlaggedByDate(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, got.Quarantined, 1)
+
+	errs, err = uc.CreateRecords(context.Background(), batch[1:])
+	require.NoError(t, err)
+	require.True(t, errors.Is(errs[0], ErrRejected))
+}
+
+// outbox records outcomes of held fixations and fails while fail is set
+type outbox struct {
+	fail     bool
+	outcomes map[string]bool
+}
+
+func (o *outbox) Notify(repo.SpeedFixation) {}
+
+func (o *outbox) Hold(fixation repo.SpeedFixation) (func(bool), error) {
+	if o.fail {
+		return nil, errors.New("outbox is not available")
+	}
+
+	return func(stored bool) {
+		o.outcomes[fixation.VehicleNumber] = stored
+	}, nil
+}
+
+func TestCreateRecord_Outbox(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "usecase")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	pv, err := plate.NewValidator(plate.DefaultRules)
+	require.NoError(t, err)
+
+	var (
+		now = time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+		ob  = &outbox{fail: true, outcomes: make(map[string]bool)}
+		uc  = NewSpeedFixationUsecase(repo.NewTestSpeedFixationRepository(tempDir, clock.NewFake(now)), pv,
+			NewValidationPipeline(), clock.NewFake(now), ob)
+		fixation = repo.SpeedFixation{Date: now, VehicleNumber: "6048 EC-3", Camera: "C12", Speed: 95}
+	)
+
+	// registration fails and stores nothing when outbox can not be written
+	require.Error(t, uc.CreateRecord(context.Background(), fixation))
+
+	_, err = os.Stat(filepath.Join(tempDir, "27.12.2019.json"))
+	require.True(t, os.IsNotExist(err))
+
+	ob.fail = false
+
+	require.NoError(t, uc.CreateRecord(context.Background(), fixation))
+	require.Equal(t, map[string]bool{"6048EC3": true}, ob.outcomes)
+
+	// duplicate is not stored, so its notifications are canceled
+	errs, err := uc.CreateRecords(context.Background(), []repo.SpeedFixation{
+		fixation,
+		{Date: now, VehicleNumber: "0003 AE-3", Camera: "C12", Speed: 98},
+	})
+	require.NoError(t, err)
+	require.Error(t, errs[0])
+	require.NoError(t, errs[1])
+	require.Equal(t, map[string]bool{"6048EC3": false, "0003AE3": true}, ob.outcomes)
+}
@@ -2,14 +2,39 @@
 package usecase
 
 import (
+	"context"
 	"time"
 
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/filter"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/platesearch"
 	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
 )
 
-// SpeedControl represent the services usecases
+// SpeedControl represent the services usecases, methods reading storage take context of the request
 type SpeedControl interface {
-	CreateRecord(repo.SpeedFixation) error
-	LookUpOverSpeedByDate(repo.SpeedFixation) ([]repo.SpeedFixation, error)
-	LookUpMinMaxSpeedByDate(time.Time) ([]repo.SpeedFixation, error)
+	CreateRecord(context.Context, repo.SpeedFixation) error
+	CreateRecords(context.Context, []repo.SpeedFixation) ([]error, error)
+	LookUpOverSpeedByDate(context.Context, repo.SpeedFixation) ([]repo.SpeedFixation, error)
+	LookUpMinMaxSpeedByDate(context.Context, time.Time) ([]repo.SpeedFixation, error)
+	LookUpSpeedStatisticsByDate(context.Context, time.Time) (repo.SpeedStatistics, error)
+	LookUpRepeatOffenders(context.Context, repo.RepeatOffenderConditions) ([]repo.Offender, error)
+	SearchPlates(context.Context, platesearch.Query) ([]repo.PlateCandidate, error)
+	SearchFixations(ctx context.Context, from, to time.Time, expr filter.Expr) ([]repo.SpeedFixation, error)
+	LookUpFixationsByVehicleNumber(context.Context, string) ([]repo.SpeedFixation, error)
+	LookUpFlaggedByDate(context.Context, time.Time) (repo.FlaggedRecords, error)
+	ValidationStats() map[string]RuleStats
+	Close() error
+}
+
+// Notifier receives fixations stored by usecase, Notify must not block registration
+type Notifier interface {
+	Notify(repo.SpeedFixation)
+}
+
+// Outbox is the notifier which stores notifications in the registration write path instead of Notify:
+// Hold stores them before fixation is stored and returns function releasing them with the outcome
+// of the store, registration fails when they can not be stored
+type Outbox interface {
+	Notifier
+	Hold(repo.SpeedFixation) (release func(stored bool), err error)
 }
@@ -0,0 +1,265 @@
+// Package usecase provides business logic methods
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/plate"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+// Action is what validation pipeline does with fixation which breaks the rule
+type Action string
+
+// Actions of validation pipeline ordered by severity
+const (
+	ActionFlag       Action = "flag"
+	ActionQuarantine Action = "quarantine"
+	ActionReject     Action = "reject"
+)
+
+var severity = map[Action]int{ActionFlag: 1, ActionQuarantine: 2, ActionReject: 3}
+
+var (
+	// ErrRejected is returned for fixation rejected by validation rules
+	ErrRejected = errors.New("fixation rejected by validation rules", errors.WithCode("rejected"))
+	// ErrQuarantined is returned for fixation stored in quarantine instead of day data
+	ErrQuarantined = errors.New("fixation quarantined by validation rules", errors.WithCode("quarantined"))
+)
+
+// Rule checks incoming fixation
+type Rule interface {
+	// Name is the unique rule name used in configuration, flags and counters
+	Name() string
+	// Check returns reason when fixation breaks the rule, now is the time of registration
+	Check(fixation repo.SpeedFixation, now time.Time) (reason string, broken bool)
+}
+
+// SpeedBoundsRule breaks fixations with speed not greater than Min or greater than Max
+type SpeedBoundsRule struct {
+	Min, Max float64
+}
+
+// Name implements Rule
+func (SpeedBoundsRule) Name() string { return "speed_bounds" }
+
+// Check implements Rule
+func (r SpeedBoundsRule) Check(fixation repo.SpeedFixation, _ time.Time) (string, bool) {
+	if fixation.Speed <= r.Min || fixation.Speed > r.Max {
+		return fmt.Sprintf("speed %v is out of bounds (%v, %v]", fixation.Speed, r.Min, r.Max), true
+	}
+
+	return "", false
+}
+
+// FutureRule breaks fixations with date later than registration time plus Tolerance
+type FutureRule struct {
+	Tolerance time.Duration
+}
+
+// Name implements Rule
+func (FutureRule) Name() string { return "future" }
+
+// Check implements Rule
+func (r FutureRule) Check(fixation repo.SpeedFixation, now time.Time) (string, bool) {
+	if fixation.Date.After(now.Add(r.Tolerance)) {
+		return fmt.Sprintf("date %v is in the future", fixation.Date.Format(time.RFC3339)), true
+	}
+
+	return "", false
+}
+
+// ClockSkewRule breaks fixations with date earlier than registration time minus MaxLag,
+// which usually means that camera clock is wrong
+type ClockSkewRule struct {
+	MaxLag time.Duration
+}
+
+// Name implements Rule
+func (ClockSkewRule) Name() string { return "clock_skew" }
+
+// Check implements Rule
+func (r ClockSkewRule) Check(fixation repo.SpeedFixation, now time.Time) (string, bool) {
+	if lag := now.Sub(fixation.Date); lag > r.MaxLag {
+		return fmt.Sprintf("date lags registration time by %v", lag.Round(time.Second)), true
+	}
+
+	return "", false
+}
+
+// DuplicateRule breaks fixations of the same vehicle by the same camera made within Window,
+// it remembers fixations passed to Notify, so only stored fixations are compared
+type DuplicateRule struct {
+	Window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Name implements Rule
+func (*DuplicateRule) Name() string { return "duplicate" }
+
+func duplicateKey(fixation repo.SpeedFixation) string {
+	return plate.Normalize(fixation.VehicleNumber) + "|" + fixation.Camera
+}
+
+// Check implements Rule
+func (r *DuplicateRule) Check(fixation repo.SpeedFixation, _ time.Time) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, ok := r.seen[duplicateKey(fixation)]
+	if diff := fixation.Date.Sub(last); ok && diff < r.Window && diff > -r.Window {
+		return fmt.Sprintf("vehicle already fixed by the camera %v ago", diff.Round(time.Millisecond)), true
+	}
+
+	return "", false
+}
+
+// Notify implements Notifier, it remembers stored fixation
+func (r *DuplicateRule) Notify(fixation repo.SpeedFixation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.seen == nil {
+		r.seen = make(map[string]time.Time)
+	}
+
+	key := duplicateKey(fixation)
+
+	if last, ok := r.seen[key]; !ok || fixation.Date.After(last) {
+		r.seen[key] = fixation.Date
+	}
+
+	// old fixations are forgotten when the map grows, so it holds only the recent window
+	if len(r.seen) > 10000 {
+		for k, date := range r.seen {
+			if fixation.Date.Sub(date) > r.Window {
+				delete(r.seen, k)
+			}
+		}
+	}
+}
+
+// RuleStats counts fixations which broke the rule
+type RuleStats struct {
+	Broken      int64 `json:"broken"`
+	Rejected    int64 `json:"rejected"`
+	Flagged     int64 `json:"flagged"`
+	Quarantined int64 `json:"quarantined"`
+}
+
+// ValidationRule is the rule with the action applied to broken fixations
+type ValidationRule struct {
+	Rule   Rule
+	Action Action
+}
+
+// ValidationPipeline checks incoming fixations against configured rules
+type ValidationPipeline struct {
+	rules []ValidationRule
+
+	mu    sync.Mutex
+	stats map[string]*RuleStats
+}
+
+// NewValidationPipeline creates pipeline of passed rules, pipeline without rules accepts every fixation
+func NewValidationPipeline(rules ...ValidationRule) *ValidationPipeline {
+	vp := &ValidationPipeline{
+		rules: rules,
+		stats: make(map[string]*RuleStats, len(rules)),
+	}
+
+	for _, r := range rules {
+		vp.stats[r.Rule.Name()] = &RuleStats{}
+	}
+
+	return vp
+}
+
+// ParseActions parses comma separated "rule:action" pairs, e.g. "speed_bounds:reject,clock_skew:flag"
+func ParseActions(config string) (map[string]Action, error) {
+	ret := make(map[string]Action)
+
+	for _, pair := range strings.Split(config, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || severity[Action(parts[1])] == 0 {
+			return nil, errors.New("invalid validation rule action", j.KV("rule", pair))
+		}
+
+		ret[parts[0]] = Action(parts[1])
+	}
+
+	return ret, nil
+}
+
+// check runs all rules, it returns the most severe action and reasons of all broken rules
+func (vp *ValidationPipeline) check(fixation repo.SpeedFixation, now time.Time) (Action, []string) {
+	var (
+		action  Action
+		reasons []string
+	)
+
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+
+	for _, r := range vp.rules {
+		reason, broken := r.Rule.Check(fixation, now)
+		if !broken {
+			continue
+		}
+
+		stats := vp.stats[r.Rule.Name()]
+		stats.Broken++
+
+		switch r.Action {
+		case ActionReject:
+			stats.Rejected++
+		case ActionQuarantine:
+			stats.Quarantined++
+		case ActionFlag:
+			stats.Flagged++
+		}
+
+		reasons = append(reasons, r.Rule.Name()+": "+reason)
+
+		if severity[r.Action] > severity[action] {
+			action = r.Action
+		}
+	}
+
+	return action, reasons
+}
+
+// Notify implements Notifier, it passes stored fixation to rules which remember fixations
+func (vp *ValidationPipeline) Notify(fixation repo.SpeedFixation) {
+	for _, r := range vp.rules {
+		if n, ok := r.Rule.(Notifier); ok {
+			n.Notify(fixation)
+		}
+	}
+}
+
+// Stats returns counters of every rule
+func (vp *ValidationPipeline) Stats() map[string]RuleStats {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+
+	ret := make(map[string]RuleStats, len(vp.stats))
+	for name, stats := range vp.stats {
+		ret[name] = *stats
+	}
+
+	return ret
+}
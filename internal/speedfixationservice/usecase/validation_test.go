@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+)
+
+func TestParseActions(t *testing.T) {
+	actions, err := ParseActions("speed_bounds:reject, clock_skew:flag,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Action{"speed_bounds": ActionReject, "clock_skew": ActionFlag}, actions)
+
+	_, err = ParseActions("speed_bounds:drop")
+	require.Error(t, err)
+}
+
+func TestValidationPipeline_check(t *testing.T) {
+	now := time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC)
+
+	vp := NewValidationPipeline(
+		ValidationRule{Rule: SpeedBoundsRule{Min: 0, Max: 300}, Action: ActionReject},
+		ValidationRule{Rule: &DuplicateRule{Window: time.Second}, Action: ActionQuarantine},
+		ValidationRule{Rule: FutureRule{Tolerance: time.Minute}, Action: ActionReject},
+		ValidationRule{Rule: ClockSkewRule{MaxLag: time.Hour}, Action: ActionFlag},
+	)
+
+	tests := []struct {
+		name     string
+		fixation repo.SpeedFixation
+		action   Action
+		reasons  int
+	}{
+		{
+			name:     "valid",
+			fixation: repo.SpeedFixation{Date: now, VehicleNumber: "6048EC3", Camera: "C12", Speed: 62.8},
+		},
+		{
+			name:     "duplicate",
+			fixation: repo.SpeedFixation{Date: now.Add(300 * time.Millisecond), VehicleNumber: "6048 EC-3", Camera: "C12", Speed: 62.9},
+			action:   ActionQuarantine,
+			reasons:  1,
+		},
+		{
+			name:     "other camera",
+			fixation: repo.SpeedFixation{Date: now, VehicleNumber: "6048EC3", Camera: "C14", Speed: 62.8},
+		},
+		{
+			name:     "glitch",
+			fixation: repo.SpeedFixation{Date: now, VehicleNumber: "0003AE3", Speed: 400},
+			action:   ActionReject,
+			reasons:  1,
+		},
+		{
+			name:     "negative speed of stale record",
+			fixation: repo.SpeedFixation{Date: now.Add(-2 * time.Hour), VehicleNumber: "8911EE3", Speed: -60},
+			action:   ActionReject,
+			reasons:  2,
+		},
+		{
+			name:     "stale record",
+			fixation: repo.SpeedFixation{Date: now.Add(-2 * time.Hour), VehicleNumber: "8911EE3", Camera: "C15", Speed: 60},
+			action:   ActionFlag,
+			reasons:  1,
+		},
+		{
+			name:     "future",
+			fixation: repo.SpeedFixation{Date: now.Add(time.Hour), VehicleNumber: "8911EE3", Speed: 60},
+			action:   ActionReject,
+			reasons:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		action, reasons := vp.check(tt.fixation, now)
+		require.Equal(t, tt.action, action, tt.name)
+		require.Len(t, reasons, tt.reasons, tt.name)
+
+		if action == "" || action == ActionFlag {
+			vp.Notify(tt.fixation)
+		}
+	}
+
+	require.Equal(t, map[string]RuleStats{
+		"speed_bounds": {Broken: 2, Rejected: 2},
+		"duplicate":    {Broken: 1, Quarantined: 1},
+		"future":       {Broken: 1, Rejected: 1},
+		"clock_skew":   {Broken: 2, Flagged: 2},
+	}, vp.Stats())
+}
@@ -0,0 +1,414 @@
+// Package webhook provides delivery of violations to subscribed receivers
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// Headers of webhook request
+const (
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// holdTimeout is the time after which held delivery is due even if it is not released
+const holdTimeout = time.Minute
+
+// ErrStaticSubscription is returned when subscription configured by file is changed by API
+var ErrStaticSubscription = errors.New("subscription is configured by file", errors.WithCode("static_subscription"))
+
+// ErrNotDead is returned when delivery which is not dead is retried
+var ErrNotDead = errors.New("only dead delivery can be retried", errors.WithCode("delivery_not_dead"))
+
+// Payload is the body of webhook request
+type Payload struct {
+	Delivery       string             `json:"delivery"`
+	Event          string             `json:"event"`
+	SubscriptionID string             `json:"subscription_id"`
+	Fixation       repo.SpeedFixation `json:"fixation"`
+}
+
+// Config describes delivery retries
+type Config struct {
+	// MaxAttempts is the number of attempts after which delivery becomes dead
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt, it doubles after every next one up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// PollInterval is the interval of outbox checks
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// Dispatcher stores violations of subscriptions in outbox and delivers them
+type Dispatcher struct {
+	repo   repo.WebhookRepo
+	config Config
+	client *http.Client
+	clock  clock.Clock
+
+	// static subscriptions are not changed after creation of dispatcher
+	static []repo.WebhookSubscription
+	wakeup chan struct{}
+}
+
+// NewDispatcher creates dispatcher of subscriptions stored in repository and static ones
+func NewDispatcher(wr repo.WebhookRepo, clk clock.Clock, config Config, static ...repo.WebhookSubscription) *Dispatcher {
+	for i := range static {
+		static[i].Static = true
+		if static[i].ID == "" {
+			static[i].ID = "file-" + strconv.Itoa(i+1)
+		}
+	}
+
+	return &Dispatcher{
+		repo:   wr,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		clock:  clk,
+		static: static,
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// LoadSubscriptions reads static subscriptions from JSON array
+func LoadSubscriptions(r io.Reader) ([]repo.WebhookSubscription, error) {
+	var ret []repo.WebhookSubscription
+
+	if err := json.NewDecoder(r).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	for _, sub := range ret {
+		if sub.URL == "" {
+			return nil, errors.New("subscription url is not defined", j.KV("id", sub.ID))
+		}
+	}
+
+	return ret, nil
+}
+
+// Sign returns signature of the body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscriptions returns static and stored subscriptions
+func (d *Dispatcher) Subscriptions() ([]repo.WebhookSubscription, error) {
+	stored, err := d.repo.Subscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]repo.WebhookSubscription(nil), d.static...), stored...), nil
+}
+
+// Subscribe stores new subscription
+func (d *Dispatcher) Subscribe(sub repo.WebhookSubscription) (repo.WebhookSubscription, error) {
+	sub.Static = false
+	sub.Created = d.clock.Now().UTC()
+
+	return d.repo.AddSubscription(sub)
+}
+
+// Unsubscribe deletes stored subscription
+func (d *Dispatcher) Unsubscribe(id string) error {
+	for _, sub := range d.static {
+		if sub.ID == id {
+			return ErrStaticSubscription
+		}
+	}
+
+	return d.repo.DeleteSubscription(id)
+}
+
+// Notify stores violation deliveries of fixation stored outside of registration, they are due at once
+func (d *Dispatcher) Notify(fixation repo.SpeedFixation) {
+	release, err := d.Hold(fixation)
+	if err != nil {
+		log.Println("unable store webhook deliveries:", err)
+		return
+	}
+
+	release(true)
+}
+
+// Hold stores violation deliveries of all matched subscriptions in outbox before fixation is stored,
+// they are held until the returned function is called with the outcome of the store, it implements
+// usecase.Outbox
+func (d *Dispatcher) Hold(fixation repo.SpeedFixation) (func(stored bool), error) {
+	subs, err := d.Subscriptions()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable read webhook subscriptions")
+	}
+
+	var (
+		now        = d.clock.Now().UTC()
+		deliveries []repo.WebhookDelivery
+	)
+
+	for _, sub := range subs {
+		if fixation.Speed <= sub.MinSpeed || (sub.Camera != "" && sub.Camera != fixation.Camera) {
+			continue
+		}
+
+		payload, err := json.Marshal(Payload{Event: "violation", SubscriptionID: sub.ID, Fixation: fixation})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable encode webhook payload")
+		}
+
+		deliveries = append(deliveries, repo.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			URL:            sub.URL,
+			Payload:        payload,
+			State:          repo.DeliveryHeld,
+			NextAttempt:    now.Add(holdTimeout),
+			Created:        now,
+			Updated:        now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return func(bool) {}, nil
+	}
+
+	held, err := d.repo.Enqueue(deliveries...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable store webhook deliveries")
+	}
+
+	return func(stored bool) {
+		d.release(held, stored)
+	}, nil
+}
+
+// release makes held deliveries pending when their fixation is stored and cancels them otherwise,
+// deliveries attempted after hold timeout are left as they are
+func (d *Dispatcher) release(held []repo.WebhookDelivery, stored bool) {
+	now := d.clock.Now().UTC()
+
+	for _, delivery := range held {
+		current, err := d.repo.GetDelivery(delivery.ID)
+		if err != nil {
+			log.Println("unable read webhook delivery:", err)
+			continue
+		}
+
+		if current.State != repo.DeliveryHeld {
+			continue
+		}
+
+		current.State, current.NextAttempt, current.Updated = repo.DeliveryPending, now, now
+		if !stored {
+			current.State = repo.DeliveryCanceled
+		}
+
+		if err := d.repo.UpdateDelivery(current); err != nil {
+			log.Println("unable store webhook delivery:", err)
+		}
+	}
+
+	if stored {
+		d.wake()
+	}
+}
+
+// Deliveries returns delivery log
+func (d *Dispatcher) Deliveries(conditions repo.DeliveryConditions) ([]repo.WebhookDelivery, error) {
+	return d.repo.LookUpDeliveries(conditions)
+}
+
+// Retry schedules dead delivery again
+func (d *Dispatcher) Retry(id string) (repo.WebhookDelivery, error) {
+	delivery, err := d.repo.GetDelivery(id)
+	if err != nil {
+		return repo.WebhookDelivery{}, err
+	}
+
+	if delivery.State != repo.DeliveryDead {
+		return repo.WebhookDelivery{}, errors.Wrap(ErrNotDead, "delivery is "+delivery.State)
+	}
+
+	delivery.State = repo.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = d.clock.Now().UTC()
+	delivery.Updated = delivery.NextAttempt
+
+	if err := d.repo.UpdateDelivery(delivery); err != nil {
+		return repo.WebhookDelivery{}, err
+	}
+
+	d.wake()
+
+	return delivery, nil
+}
+
+func (d *Dispatcher) wake() {
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due deliveries until stop is closed, nil stop runs it forever
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-d.wakeup:
+		}
+	}
+}
+
+// DeliverDue makes attempts of all due deliveries
+func (d *Dispatcher) DeliverDue() {
+	due, err := d.repo.Due(d.clock.Now())
+	if err != nil {
+		log.Println("unable read webhook outbox:", err)
+		return
+	}
+
+	secrets := make(map[string]string)
+
+	subs, err := d.Subscriptions()
+	if err != nil {
+		log.Println("unable read webhook subscriptions:", err)
+		return
+	}
+
+	for _, sub := range subs {
+		secrets[sub.ID] = sub.Secret
+	}
+
+	for _, delivery := range due {
+		delivery = d.attempt(delivery, secrets[delivery.SubscriptionID])
+
+		if err := d.repo.UpdateDelivery(delivery); err != nil {
+			log.Println("unable store webhook delivery:", err)
+		}
+	}
+}
+
+// backoff returns delay before the next attempt after attempts failed ones
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.BaseDelay
+
+	for i := 1; i < attempts && delay < d.config.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > d.config.MaxDelay {
+		delay = d.config.MaxDelay
+	}
+
+	return delay
+}
+
+// attempt sends delivery and returns its new state
+func (d *Dispatcher) attempt(delivery repo.WebhookDelivery, secret string) repo.WebhookDelivery {
+	now := d.clock.Now().UTC()
+
+	// held delivery is attempted when it is not released in time
+	delivery.State = repo.DeliveryPending
+	delivery.Attempts++
+	delivery.Updated = now
+	delivery.LastStatus, delivery.LastError = 0, ""
+
+	status, err := d.send(delivery, secret, now)
+
+	switch {
+	case err == nil:
+		delivery.State = repo.DeliveryDelivered
+		delivery.LastStatus = status
+
+		return delivery
+	case status != 0:
+		delivery.LastStatus = status
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.config.MaxAttempts {
+		delivery.State = repo.DeliveryDead
+		return delivery
+	}
+
+	delivery.NextAttempt = now.Add(d.backoff(delivery.Attempts))
+
+	return delivery
+}
+
+func (d *Dispatcher) send(delivery repo.WebhookDelivery, secret string, now time.Time) (int, error) {
+	// delivery ID is known only after it is stored, so it is added to the payload on sending
+	var payload Payload
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		return 0, err
+	}
+
+	payload.Delivery = delivery.ID
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, errors.New("receiver responded with error status", j.KV("status", resp.StatusCode))
+	}
+
+	return resp.StatusCode, nil
+}
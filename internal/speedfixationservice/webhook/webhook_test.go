@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/pkg/clock"
+)
+
+// receiver is the local HTTP receiver of webhooks which fails the first requests
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads []Payload
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if Sign("secret", r.Header.Get(TimestampHeader), body) != r.Header.Get(SignatureHeader) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Delivery != r.Header.Get(DeliveryHeader) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rc.payloads = append(rc.payloads, payload)
+}
+
+func TestDispatcher(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "webhook")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	rc := &receiver{failures: 1}
+
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	static, err := LoadSubscriptions(strings.NewReader(`[{"url":"` + server.URL + `","secret":"secret","min_speed":90}]`))
+	require.NoError(t, err)
+
+	var (
+		clk    = clock.NewFake(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+		config = Config{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second, Timeout: time.Second}
+		d      = NewDispatcher(repo.NewTestWebhookRepository(tempDir, time.Hour, clk), clk, config, static...)
+	)
+
+	wrong, err := d.Subscribe(repo.WebhookSubscription{URL: server.URL, Secret: "wrong", Camera: "C12"})
+	require.NoError(t, err)
+
+	require.True(t, errors.Is(d.Unsubscribe("file-1"), ErrStaticSubscription))
+
+	d.Notify(repo.SpeedFixation{VehicleNumber: "6048EC3", Camera: "C12", Speed: 95})
+	d.Notify(repo.SpeedFixation{VehicleNumber: "0003AE3", Camera: "C14", Speed: 60})
+
+	// outbox survives restart of dispatcher
+	d = NewDispatcher(repo.NewTestWebhookRepository(tempDir, time.Hour, clk), clk, config, static...)
+
+	d.DeliverDue()
+	clk.Advance(time.Second)
+	d.DeliverDue()
+
+	delivered, err := d.Deliveries(repo.DeliveryConditions{State: repo.DeliveryDelivered})
+	require.NoError(t, err)
+	require.Len(t, delivered, 1)
+	require.Equal(t, 2, delivered[0].Attempts)
+	require.Equal(t, "file-1", delivered[0].SubscriptionID)
+
+	require.Len(t, rc.payloads, 1)
+	require.Equal(t, "violation", rc.payloads[0].Event)
+	require.Equal(t, "6048EC3", rc.payloads[0].Fixation.VehicleNumber)
+
+	// receiver rejects wrong signature, so delivery becomes dead after the last attempt
+	dead, err := d.Deliveries(repo.DeliveryConditions{State: repo.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, wrong.ID, dead[0].SubscriptionID)
+	require.Equal(t, http.StatusUnauthorized, dead[0].LastStatus)
+
+	retried, err := d.Retry(dead[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.DeliveryPending, retried.State)
+	require.Equal(t, 0, retried.Attempts)
+
+	// only dead deliveries are retried
+	_, err = d.Retry(retried.ID)
+	require.True(t, errors.Is(err, ErrNotDead))
+
+	_, err = d.Retry(delivered[0].ID)
+	require.True(t, errors.Is(err, ErrNotDead))
+}
+
+func TestDispatcher_Hold(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "webhook")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	rc := &receiver{}
+
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	static, err := LoadSubscriptions(strings.NewReader(`[{"url":"` + server.URL + `","secret":"secret","min_speed":90}]`))
+	require.NoError(t, err)
+
+	var (
+		clk    = clock.NewFake(time.Date(2019, 12, 27, 15, 3, 27, 0, time.UTC))
+		config = Config{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second, Timeout: time.Second}
+		d      = NewDispatcher(repo.NewTestWebhookRepository(tempDir, time.Hour, clk), clk, config, static...)
+	)
+
+	stored, err := d.Hold(repo.SpeedFixation{VehicleNumber: "6048EC3", Camera: "C12", Speed: 95})
+	require.NoError(t, err)
+
+	rejected, err := d.Hold(repo.SpeedFixation{VehicleNumber: "0003AE3", Camera: "C12", Speed: 98})
+	require.NoError(t, err)
+
+	_, err = d.Hold(repo.SpeedFixation{VehicleNumber: "1234AB7", Camera: "C12", Speed: 99})
+	require.NoError(t, err)
+
+	// held deliveries are not sent before the outcome of the store is known
+	d.DeliverDue()
+	require.Empty(t, rc.payloads)
+
+	stored(true)
+	rejected(false)
+	d.DeliverDue()
+
+	require.Len(t, rc.payloads, 1)
+	require.Equal(t, "6048EC3", rc.payloads[0].Fixation.VehicleNumber)
+
+	canceled, err := d.Deliveries(repo.DeliveryConditions{State: repo.DeliveryCanceled})
+	require.NoError(t, err)
+	require.Len(t, canceled, 1)
+
+	// delivery which is never released is sent after hold timeout, e.g. after restart
+	d = NewDispatcher(repo.NewTestWebhookRepository(tempDir, time.Hour, clk), clk, config, static...)
+	clk.Advance(holdTimeout)
+	d.DeliverDue()
+
+	require.Len(t, rc.payloads, 2)
+	require.Equal(t, "1234AB7", rc.payloads[1].Fixation.VehicleNumber)
+}
+
+func TestDispatcher_backoff(t *testing.T) {
+	d := NewDispatcher(nil, clock.System, Config{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+
+	for attempts, want := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second,
+		8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		require.Equal(t, want, d.backoff(attempts), attempts)
+	}
+}
@@ -0,0 +1,135 @@
+// Package speedfixationservice provides methods for handling traffic camera requests
+package speedfixationservice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/repo"
+	"github.com/IgorRybak2055/speed-control-service/internal/speedfixationservice/webhook"
+	"github.com/IgorRybak2055/speed-control-service/pkg/env"
+)
+
+// staticWebhooks reads subscriptions from file configured by environment
+func staticWebhooks() ([]repo.WebhookSubscription, error) {
+	path := env.GetString("webhookFile", "")
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return webhook.LoadSubscriptions(file)
+}
+
+// webhookRequest is the subscription created by API
+type webhookRequest struct {
+	URL      string  `json:"url"`
+	Secret   string  `json:"secret"`
+	MinSpeed float64 `json:"min_speed"`
+	Camera   string  `json:"camera"`
+}
+
+func (srv service) webhookList(w http.ResponseWriter, _ *http.Request) {
+	subs, err := srv.webhooks.Subscriptions()
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	// secrets are shown only on creation
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	makeResponse(w, subs)
+}
+
+func (srv service) webhookCreate(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responseError(w, fieldError("body", "unable parse json"))
+		return
+	}
+
+	var verr ValidationError
+
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.add("url", "absolute http or https url expected")
+	}
+
+	if req.MinSpeed < 0 {
+		verr.add("min_speed", "speed must not be negative")
+	}
+
+	if len(verr.Errors) > 0 {
+		responseError(w, &verr)
+		return
+	}
+
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			responseError(w, err)
+			return
+		}
+
+		req.Secret = hex.EncodeToString(b)
+	}
+
+	sub, err := srv.webhooks.Subscribe(repo.WebhookSubscription{
+		URL:      req.URL,
+		Secret:   req.Secret,
+		MinSpeed: req.MinSpeed,
+		Camera:   req.Camera,
+	})
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeStatusResponse(w, sub, http.StatusCreated)
+}
+
+func (srv service) webhookDelete(w http.ResponseWriter, r *http.Request) {
+	if err := srv.webhooks.Unsubscribe(r.FormValue("id")); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv service) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	conditions := repo.DeliveryConditions{State: r.FormValue("state"), SubscriptionID: r.FormValue("subscription_id")}
+
+	resp, err := srv.webhooks.Deliveries(conditions)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
+
+func (srv service) webhookRetry(w http.ResponseWriter, r *http.Request) {
+	resp, err := srv.webhooks.Retry(r.FormValue("id"))
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	makeResponse(w, resp)
+}
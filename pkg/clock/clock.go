@@ -0,0 +1,65 @@
+// Package clock provide access to the current time, so it can be controlled in tests
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System is the clock of operating system
+var System Clock = systemClock{}
+
+// Fake is the clock which time is set by test
+type Fake struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// NewFake return fake clock stopped at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now return time of clock, then the clock goes on by step
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now
+	f.now = f.now.Add(f.step)
+
+	return now
+}
+
+// Set moves clock to now
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	f.now = now
+	f.mu.Unlock()
+}
+
+// Advance moves clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+// SetStep makes clock go on by step after every reading, so code reading time twice sees different times
+func (f *Fake) SetStep(step time.Duration) {
+	f.mu.Lock()
+	f.step = step
+	f.mu.Unlock()
+}
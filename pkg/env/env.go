@@ -3,6 +3,8 @@ package env
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 // GetString return string env variable or passed default value
@@ -14,3 +16,33 @@ func GetString(key, defaultValue string) string {
 
 	return value
 }
+
+// GetInt return int env variable or passed default value if variable not exist or not a number
+func GetInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(GetString(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+// GetFloat return float env variable or passed default value if variable not exist or not a number
+func GetFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(GetString(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+// GetDuration return duration env variable or passed default value if variable not exist or not a duration
+func GetDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetString(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
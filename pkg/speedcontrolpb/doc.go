@@ -0,0 +1,4 @@
+// Package speedcontrolpb provides gRPC client and server code of speed fixation service
+package speedcontrolpb
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. speedcontrol.proto
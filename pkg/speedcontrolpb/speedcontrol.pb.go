@@ -0,0 +1,980 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: speedcontrol.proto
+
+package speedcontrolpb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type RegisterStatus int32
+
+const (
+	RegisterStatus_REGISTER_STATUS_UNSPECIFIED RegisterStatus = 0
+	RegisterStatus_ACCEPTED                    RegisterStatus = 1
+	RegisterStatus_DUPLICATE                   RegisterStatus = 2
+	RegisterStatus_REJECTED                    RegisterStatus = 3
+	RegisterStatus_QUARANTINED                 RegisterStatus = 4
+)
+
+var RegisterStatus_name = map[int32]string{
+	0: "REGISTER_STATUS_UNSPECIFIED",
+	1: "ACCEPTED",
+	2: "DUPLICATE",
+	3: "REJECTED",
+	4: "QUARANTINED",
+}
+
+var RegisterStatus_value = map[string]int32{
+	"REGISTER_STATUS_UNSPECIFIED": 0,
+	"ACCEPTED":                    1,
+	"DUPLICATE":                   2,
+	"REJECTED":                    3,
+	"QUARANTINED":                 4,
+}
+
+func (x RegisterStatus) String() string {
+	return proto.EnumName(RegisterStatus_name, int32(x))
+}
+
+func (RegisterStatus) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{0}
+}
+
+type Fixation struct {
+	Date                 *timestamp.Timestamp `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	VehicleNumber        string               `protobuf:"bytes,2,opt,name=vehicle_number,json=vehicleNumber,proto3" json:"vehicle_number,omitempty"`
+	RawVehicleNumber     string               `protobuf:"bytes,3,opt,name=raw_vehicle_number,json=rawVehicleNumber,proto3" json:"raw_vehicle_number,omitempty"`
+	Country              string               `protobuf:"bytes,4,opt,name=country,proto3" json:"country,omitempty"`
+	Camera               string               `protobuf:"bytes,5,opt,name=camera,proto3" json:"camera,omitempty"`
+	Speed                float64              `protobuf:"fixed64,6,opt,name=speed,proto3" json:"speed,omitempty"`
+	Flags                []string             `protobuf:"bytes,7,rep,name=flags,proto3" json:"flags,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Fixation) Reset()         { *m = Fixation{} }
+func (m *Fixation) String() string { return proto.CompactTextString(m) }
+func (*Fixation) ProtoMessage()    {}
+func (*Fixation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{0}
+}
+
+func (m *Fixation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Fixation.Unmarshal(m, b)
+}
+func (m *Fixation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Fixation.Marshal(b, m, deterministic)
+}
+func (m *Fixation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Fixation.Merge(m, src)
+}
+func (m *Fixation) XXX_Size() int {
+	return xxx_messageInfo_Fixation.Size(m)
+}
+func (m *Fixation) XXX_DiscardUnknown() {
+	xxx_messageInfo_Fixation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Fixation proto.InternalMessageInfo
+
+func (m *Fixation) GetDate() *timestamp.Timestamp {
+	if m != nil {
+		return m.Date
+	}
+	return nil
+}
+
+func (m *Fixation) GetVehicleNumber() string {
+	if m != nil {
+		return m.VehicleNumber
+	}
+	return ""
+}
+
+func (m *Fixation) GetRawVehicleNumber() string {
+	if m != nil {
+		return m.RawVehicleNumber
+	}
+	return ""
+}
+
+func (m *Fixation) GetCountry() string {
+	if m != nil {
+		return m.Country
+	}
+	return ""
+}
+
+func (m *Fixation) GetCamera() string {
+	if m != nil {
+		return m.Camera
+	}
+	return ""
+}
+
+func (m *Fixation) GetSpeed() float64 {
+	if m != nil {
+		return m.Speed
+	}
+	return 0
+}
+
+func (m *Fixation) GetFlags() []string {
+	if m != nil {
+		return m.Flags
+	}
+	return nil
+}
+
+type RegisterRequest struct {
+	Fixation *Fixation `protobuf:"bytes,1,opt,name=fixation,proto3" json:"fixation,omitempty"`
+	// Idempotency key, e.g. camera ID plus sequence number, the original result is returned for retries.
+	IdempotencyKey string `protobuf:"bytes,2,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// Base64 Ed25519 signature of canonical encoding of fixation, required for cameras with public keys.
+	Signature            string   `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
+func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
+func (*RegisterRequest) ProtoMessage()    {}
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{1}
+}
+
+func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterRequest.Unmarshal(m, b)
+}
+func (m *RegisterRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterRequest.Marshal(b, m, deterministic)
+}
+func (m *RegisterRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterRequest.Merge(m, src)
+}
+func (m *RegisterRequest) XXX_Size() int {
+	return xxx_messageInfo_RegisterRequest.Size(m)
+}
+func (m *RegisterRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterRequest proto.InternalMessageInfo
+
+func (m *RegisterRequest) GetFixation() *Fixation {
+	if m != nil {
+		return m.Fixation
+	}
+	return nil
+}
+
+func (m *RegisterRequest) GetIdempotencyKey() string {
+	if m != nil {
+		return m.IdempotencyKey
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
+type RegisterResponse struct {
+	Status               RegisterStatus `protobuf:"varint,1,opt,name=status,proto3,enum=speedcontrol.v1.RegisterStatus" json:"status,omitempty"`
+	Reason               string         `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *RegisterResponse) Reset()         { *m = RegisterResponse{} }
+func (m *RegisterResponse) String() string { return proto.CompactTextString(m) }
+func (*RegisterResponse) ProtoMessage()    {}
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{2}
+}
+
+func (m *RegisterResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterResponse.Unmarshal(m, b)
+}
+func (m *RegisterResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterResponse.Marshal(b, m, deterministic)
+}
+func (m *RegisterResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterResponse.Merge(m, src)
+}
+func (m *RegisterResponse) XXX_Size() int {
+	return xxx_messageInfo_RegisterResponse.Size(m)
+}
+func (m *RegisterResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterResponse proto.InternalMessageInfo
+
+func (m *RegisterResponse) GetStatus() RegisterStatus {
+	if m != nil {
+		return m.Status
+	}
+	return RegisterStatus_REGISTER_STATUS_UNSPECIFIED
+}
+
+func (m *RegisterResponse) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type RegisterResult struct {
+	Index                int32          `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Status               RegisterStatus `protobuf:"varint,2,opt,name=status,proto3,enum=speedcontrol.v1.RegisterStatus" json:"status,omitempty"`
+	Reason               string         `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *RegisterResult) Reset()         { *m = RegisterResult{} }
+func (m *RegisterResult) String() string { return proto.CompactTextString(m) }
+func (*RegisterResult) ProtoMessage()    {}
+func (*RegisterResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{3}
+}
+
+func (m *RegisterResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterResult.Unmarshal(m, b)
+}
+func (m *RegisterResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterResult.Marshal(b, m, deterministic)
+}
+func (m *RegisterResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterResult.Merge(m, src)
+}
+func (m *RegisterResult) XXX_Size() int {
+	return xxx_messageInfo_RegisterResult.Size(m)
+}
+func (m *RegisterResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterResult proto.InternalMessageInfo
+
+func (m *RegisterResult) GetIndex() int32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *RegisterResult) GetStatus() RegisterStatus {
+	if m != nil {
+		return m.Status
+	}
+	return RegisterStatus_REGISTER_STATUS_UNSPECIFIED
+}
+
+func (m *RegisterResult) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type RegisterBatchResponse struct {
+	Results              []*RegisterResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *RegisterBatchResponse) Reset()         { *m = RegisterBatchResponse{} }
+func (m *RegisterBatchResponse) String() string { return proto.CompactTextString(m) }
+func (*RegisterBatchResponse) ProtoMessage()    {}
+func (*RegisterBatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{4}
+}
+
+func (m *RegisterBatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterBatchResponse.Unmarshal(m, b)
+}
+func (m *RegisterBatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterBatchResponse.Marshal(b, m, deterministic)
+}
+func (m *RegisterBatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterBatchResponse.Merge(m, src)
+}
+func (m *RegisterBatchResponse) XXX_Size() int {
+	return xxx_messageInfo_RegisterBatchResponse.Size(m)
+}
+func (m *RegisterBatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterBatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterBatchResponse proto.InternalMessageInfo
+
+func (m *RegisterBatchResponse) GetResults() []*RegisterResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type OverSpeedRequest struct {
+	Date                 *timestamp.Timestamp `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	Speed                float64              `protobuf:"fixed64,2,opt,name=speed,proto3" json:"speed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *OverSpeedRequest) Reset()         { *m = OverSpeedRequest{} }
+func (m *OverSpeedRequest) String() string { return proto.CompactTextString(m) }
+func (*OverSpeedRequest) ProtoMessage()    {}
+func (*OverSpeedRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{5}
+}
+
+func (m *OverSpeedRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OverSpeedRequest.Unmarshal(m, b)
+}
+func (m *OverSpeedRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OverSpeedRequest.Marshal(b, m, deterministic)
+}
+func (m *OverSpeedRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OverSpeedRequest.Merge(m, src)
+}
+func (m *OverSpeedRequest) XXX_Size() int {
+	return xxx_messageInfo_OverSpeedRequest.Size(m)
+}
+func (m *OverSpeedRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_OverSpeedRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OverSpeedRequest proto.InternalMessageInfo
+
+func (m *OverSpeedRequest) GetDate() *timestamp.Timestamp {
+	if m != nil {
+		return m.Date
+	}
+	return nil
+}
+
+func (m *OverSpeedRequest) GetSpeed() float64 {
+	if m != nil {
+		return m.Speed
+	}
+	return 0
+}
+
+type FixationList struct {
+	Fixations            []*Fixation `protobuf:"bytes,1,rep,name=fixations,proto3" json:"fixations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *FixationList) Reset()         { *m = FixationList{} }
+func (m *FixationList) String() string { return proto.CompactTextString(m) }
+func (*FixationList) ProtoMessage()    {}
+func (*FixationList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{6}
+}
+
+func (m *FixationList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FixationList.Unmarshal(m, b)
+}
+func (m *FixationList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FixationList.Marshal(b, m, deterministic)
+}
+func (m *FixationList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FixationList.Merge(m, src)
+}
+func (m *FixationList) XXX_Size() int {
+	return xxx_messageInfo_FixationList.Size(m)
+}
+func (m *FixationList) XXX_DiscardUnknown() {
+	xxx_messageInfo_FixationList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FixationList proto.InternalMessageInfo
+
+func (m *FixationList) GetFixations() []*Fixation {
+	if m != nil {
+		return m.Fixations
+	}
+	return nil
+}
+
+type MinMaxSpeedRequest struct {
+	Date                 *timestamp.Timestamp `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *MinMaxSpeedRequest) Reset()         { *m = MinMaxSpeedRequest{} }
+func (m *MinMaxSpeedRequest) String() string { return proto.CompactTextString(m) }
+func (*MinMaxSpeedRequest) ProtoMessage()    {}
+func (*MinMaxSpeedRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{7}
+}
+
+func (m *MinMaxSpeedRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MinMaxSpeedRequest.Unmarshal(m, b)
+}
+func (m *MinMaxSpeedRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MinMaxSpeedRequest.Marshal(b, m, deterministic)
+}
+func (m *MinMaxSpeedRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MinMaxSpeedRequest.Merge(m, src)
+}
+func (m *MinMaxSpeedRequest) XXX_Size() int {
+	return xxx_messageInfo_MinMaxSpeedRequest.Size(m)
+}
+func (m *MinMaxSpeedRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MinMaxSpeedRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MinMaxSpeedRequest proto.InternalMessageInfo
+
+func (m *MinMaxSpeedRequest) GetDate() *timestamp.Timestamp {
+	if m != nil {
+		return m.Date
+	}
+	return nil
+}
+
+type SpeedStatistics struct {
+	Date                 *timestamp.Timestamp `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	Count                int64                `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	Mean                 float64              `protobuf:"fixed64,3,opt,name=mean,proto3" json:"mean,omitempty"`
+	Min                  *Fixation            `protobuf:"bytes,4,opt,name=min,proto3" json:"min,omitempty"`
+	Max                  *Fixation            `protobuf:"bytes,5,opt,name=max,proto3" json:"max,omitempty"`
+	MinTies              []*Fixation          `protobuf:"bytes,6,rep,name=min_ties,json=minTies,proto3" json:"min_ties,omitempty"`
+	MaxTies              []*Fixation          `protobuf:"bytes,7,rep,name=max_ties,json=maxTies,proto3" json:"max_ties,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *SpeedStatistics) Reset()         { *m = SpeedStatistics{} }
+func (m *SpeedStatistics) String() string { return proto.CompactTextString(m) }
+func (*SpeedStatistics) ProtoMessage()    {}
+func (*SpeedStatistics) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{8}
+}
+
+func (m *SpeedStatistics) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SpeedStatistics.Unmarshal(m, b)
+}
+func (m *SpeedStatistics) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SpeedStatistics.Marshal(b, m, deterministic)
+}
+func (m *SpeedStatistics) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SpeedStatistics.Merge(m, src)
+}
+func (m *SpeedStatistics) XXX_Size() int {
+	return xxx_messageInfo_SpeedStatistics.Size(m)
+}
+func (m *SpeedStatistics) XXX_DiscardUnknown() {
+	xxx_messageInfo_SpeedStatistics.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SpeedStatistics proto.InternalMessageInfo
+
+func (m *SpeedStatistics) GetDate() *timestamp.Timestamp {
+	if m != nil {
+		return m.Date
+	}
+	return nil
+}
+
+func (m *SpeedStatistics) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *SpeedStatistics) GetMean() float64 {
+	if m != nil {
+		return m.Mean
+	}
+	return 0
+}
+
+func (m *SpeedStatistics) GetMin() *Fixation {
+	if m != nil {
+		return m.Min
+	}
+	return nil
+}
+
+func (m *SpeedStatistics) GetMax() *Fixation {
+	if m != nil {
+		return m.Max
+	}
+	return nil
+}
+
+func (m *SpeedStatistics) GetMinTies() []*Fixation {
+	if m != nil {
+		return m.MinTies
+	}
+	return nil
+}
+
+func (m *SpeedStatistics) GetMaxTies() []*Fixation {
+	if m != nil {
+		return m.MaxTies
+	}
+	return nil
+}
+
+type QueryRequest struct {
+	From *timestamp.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To   *timestamp.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	// Filter expression, e.g. speed > 90 and camera in ("C12","C14").
+	Filter               string   `protobuf:"bytes,3,opt,name=filter,proto3" json:"filter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueryRequest) Reset()         { *m = QueryRequest{} }
+func (m *QueryRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryRequest) ProtoMessage()    {}
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2d6cdc21ac1c68e7, []int{9}
+}
+
+func (m *QueryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryRequest.Unmarshal(m, b)
+}
+func (m *QueryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryRequest.Marshal(b, m, deterministic)
+}
+func (m *QueryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryRequest.Merge(m, src)
+}
+func (m *QueryRequest) XXX_Size() int {
+	return xxx_messageInfo_QueryRequest.Size(m)
+}
+func (m *QueryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryRequest proto.InternalMessageInfo
+
+func (m *QueryRequest) GetFrom() *timestamp.Timestamp {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *QueryRequest) GetTo() *timestamp.Timestamp {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+func (m *QueryRequest) GetFilter() string {
+	if m != nil {
+		return m.Filter
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("speedcontrol.v1.RegisterStatus", RegisterStatus_name, RegisterStatus_value)
+	proto.RegisterType((*Fixation)(nil), "speedcontrol.v1.Fixation")
+	proto.RegisterType((*RegisterRequest)(nil), "speedcontrol.v1.RegisterRequest")
+	proto.RegisterType((*RegisterResponse)(nil), "speedcontrol.v1.RegisterResponse")
+	proto.RegisterType((*RegisterResult)(nil), "speedcontrol.v1.RegisterResult")
+	proto.RegisterType((*RegisterBatchResponse)(nil), "speedcontrol.v1.RegisterBatchResponse")
+	proto.RegisterType((*OverSpeedRequest)(nil), "speedcontrol.v1.OverSpeedRequest")
+	proto.RegisterType((*FixationList)(nil), "speedcontrol.v1.FixationList")
+	proto.RegisterType((*MinMaxSpeedRequest)(nil), "speedcontrol.v1.MinMaxSpeedRequest")
+	proto.RegisterType((*SpeedStatistics)(nil), "speedcontrol.v1.SpeedStatistics")
+	proto.RegisterType((*QueryRequest)(nil), "speedcontrol.v1.QueryRequest")
+}
+
+func init() { proto.RegisterFile("speedcontrol.proto", fileDescriptor_2d6cdc21ac1c68e7) }
+
+var fileDescriptor_2d6cdc21ac1c68e7 = []byte{
+	// 812 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0xdd, 0x6e, 0xe3, 0x44,
+	0x14, 0xc6, 0x71, 0xf3, 0x77, 0xfa, 0x93, 0x68, 0x04, 0xc8, 0x04, 0x50, 0x83, 0x11, 0x10, 0x2d,
+	0xac, 0xb3, 0x14, 0xaa, 0x15, 0xe2, 0x2a, 0x9b, 0x78, 0x57, 0x81, 0x6d, 0xb7, 0x3b, 0x71, 0x11,
+	0x82, 0x8b, 0x68, 0xe2, 0x4e, 0xdc, 0x51, 0x63, 0x4f, 0x98, 0x19, 0xb7, 0xc9, 0x2d, 0x2f, 0xc0,
+	0x5b, 0x70, 0xcf, 0x83, 0xf1, 0x0e, 0xc8, 0x63, 0x3b, 0x75, 0x1a, 0x35, 0x5d, 0x76, 0xef, 0x7c,
+	0xce, 0x7c, 0xdf, 0x9c, 0x9f, 0xf9, 0x3e, 0x03, 0x92, 0x73, 0x4a, 0x2f, 0x7c, 0x1e, 0x29, 0xc1,
+	0x67, 0xce, 0x5c, 0x70, 0xc5, 0x51, 0x63, 0x2d, 0x77, 0xfd, 0x6d, 0xeb, 0x30, 0xe0, 0x3c, 0x98,
+	0xd1, 0xae, 0x3e, 0x9e, 0xc4, 0xd3, 0xae, 0x62, 0x21, 0x95, 0x8a, 0x84, 0xf3, 0x94, 0x61, 0xff,
+	0x6b, 0x40, 0xed, 0x39, 0x5b, 0x10, 0xc5, 0x78, 0x84, 0x1c, 0xd8, 0xb9, 0x20, 0x8a, 0x5a, 0x46,
+	0xdb, 0xe8, 0xec, 0x1e, 0xb5, 0x9c, 0x94, 0xec, 0xe4, 0x64, 0xc7, 0xcb, 0xc9, 0x58, 0xe3, 0xd0,
+	0x17, 0x70, 0x70, 0x4d, 0x2f, 0x99, 0x3f, 0xa3, 0xe3, 0x28, 0x0e, 0x27, 0x54, 0x58, 0xa5, 0xb6,
+	0xd1, 0xa9, 0xe3, 0xfd, 0x2c, 0x7b, 0xaa, 0x93, 0xe8, 0x1b, 0x40, 0x82, 0xdc, 0x8c, 0xef, 0x40,
+	0x4d, 0x0d, 0x6d, 0x0a, 0x72, 0xf3, 0xcb, 0x1a, 0xda, 0x82, 0xaa, 0xcf, 0xe3, 0x48, 0x89, 0xa5,
+	0xb5, 0xa3, 0x21, 0x79, 0x88, 0x3e, 0x84, 0x8a, 0x4f, 0x42, 0x2a, 0x88, 0x55, 0xd6, 0x07, 0x59,
+	0x84, 0xde, 0x87, 0xb2, 0x9e, 0xdb, 0xaa, 0xb4, 0x8d, 0x8e, 0x81, 0xd3, 0x20, 0xc9, 0x4e, 0x67,
+	0x24, 0x90, 0x56, 0xb5, 0x6d, 0x76, 0xea, 0x38, 0x0d, 0xec, 0xbf, 0x0c, 0x68, 0x60, 0x1a, 0x30,
+	0xa9, 0xa8, 0xc0, 0xf4, 0x8f, 0x98, 0x4a, 0x85, 0x8e, 0xa1, 0x36, 0xcd, 0x56, 0x90, 0x8d, 0xfe,
+	0x91, 0x73, 0x67, 0x91, 0x4e, 0xbe, 0x23, 0xbc, 0x82, 0xa2, 0xaf, 0xa0, 0xc1, 0x2e, 0x68, 0x38,
+	0xe7, 0x8a, 0x46, 0xfe, 0x72, 0x7c, 0x45, 0x97, 0xd9, 0xf8, 0x07, 0x85, 0xf4, 0xcf, 0x74, 0x89,
+	0x3e, 0x81, 0xba, 0x64, 0x41, 0x44, 0x54, 0x2c, 0x68, 0x36, 0xf6, 0x6d, 0xc2, 0xf6, 0xa1, 0x79,
+	0xdb, 0x90, 0x9c, 0xf3, 0x48, 0x52, 0xf4, 0x14, 0x2a, 0x52, 0x11, 0x15, 0x4b, 0xdd, 0xcf, 0xc1,
+	0xd1, 0xe1, 0x46, 0x3f, 0x39, 0x65, 0xa4, 0x61, 0x38, 0x83, 0x27, 0x2b, 0x12, 0x94, 0x48, 0x1e,
+	0x65, 0xad, 0x64, 0x91, 0x7d, 0x03, 0x07, 0x85, 0x22, 0xf1, 0x4c, 0x25, 0xeb, 0x61, 0xd1, 0x05,
+	0x5d, 0xe8, 0x0a, 0x65, 0x9c, 0x06, 0x85, 0xc2, 0xa5, 0xb7, 0x2d, 0x6c, 0xae, 0x15, 0xc6, 0xf0,
+	0x41, 0xce, 0x78, 0x46, 0x94, 0x7f, 0xb9, 0x1a, 0xf1, 0x07, 0xa8, 0x0a, 0xdd, 0x49, 0x32, 0xa3,
+	0xd9, 0xd9, 0xdd, 0x52, 0x2a, 0xed, 0x18, 0xe7, 0x78, 0xfb, 0x57, 0x68, 0xbe, 0xba, 0xa6, 0x62,
+	0x94, 0xc0, 0xf3, 0x37, 0xfc, 0xbf, 0xd2, 0x5d, 0x69, 0xa6, 0x54, 0xd0, 0x8c, 0xfd, 0x02, 0xf6,
+	0xf2, 0x87, 0x7e, 0xc9, 0xa4, 0x42, 0x4f, 0xa1, 0x9e, 0x3f, 0x77, 0xde, 0xe6, 0x16, 0x69, 0xdc,
+	0x62, 0xed, 0x01, 0xa0, 0x13, 0x16, 0x9d, 0x90, 0xc5, 0xbb, 0x34, 0x69, 0xff, 0x53, 0x82, 0x86,
+	0xbe, 0x20, 0x59, 0x36, 0x93, 0x8a, 0xf9, 0xf2, 0x6d, 0x06, 0xd5, 0xfe, 0xd1, 0x83, 0x9a, 0x38,
+	0x0d, 0x10, 0x82, 0x9d, 0x90, 0x92, 0xf4, 0xb1, 0x0c, 0xac, 0xbf, 0xd1, 0xd7, 0x60, 0x86, 0x2c,
+	0xd2, 0xa6, 0xdb, 0x3a, 0x66, 0x82, 0xd2, 0x60, 0xb2, 0xb0, 0xca, 0x0f, 0x83, 0xc9, 0x02, 0x7d,
+	0x0f, 0xb5, 0x90, 0x45, 0x63, 0xc5, 0xa8, 0xb4, 0x2a, 0x0f, 0x6d, 0xb1, 0x1a, 0xb2, 0xc8, 0x63,
+	0x54, 0x6a, 0x16, 0x59, 0xa4, 0xac, 0xea, 0xc3, 0x2c, 0xb2, 0x48, 0x58, 0xf6, 0x9f, 0x06, 0xec,
+	0xbd, 0x8e, 0xa9, 0x58, 0x16, 0x96, 0x3e, 0x15, 0x3c, 0x7c, 0x93, 0x85, 0x25, 0x38, 0xf4, 0x08,
+	0x4a, 0x8a, 0x5b, 0xa5, 0x07, 0xd1, 0x25, 0xc5, 0x13, 0xd5, 0x4f, 0xd9, 0x4c, 0xad, 0xfe, 0x66,
+	0x59, 0xf4, 0x28, 0xbc, 0xb5, 0x5b, 0xea, 0x13, 0x74, 0x08, 0x1f, 0x63, 0xf7, 0xc5, 0x70, 0xe4,
+	0xb9, 0x78, 0x3c, 0xf2, 0x7a, 0xde, 0xf9, 0x68, 0x7c, 0x7e, 0x3a, 0x3a, 0x73, 0xfb, 0xc3, 0xe7,
+	0x43, 0x77, 0xd0, 0x7c, 0x0f, 0xed, 0x41, 0xad, 0xd7, 0xef, 0xbb, 0x67, 0x9e, 0x3b, 0x68, 0x1a,
+	0x68, 0x1f, 0xea, 0x83, 0xf3, 0xb3, 0x97, 0xc3, 0x7e, 0xcf, 0x73, 0x9b, 0xa5, 0xe4, 0x10, 0xbb,
+	0x3f, 0xb9, 0xfd, 0xe4, 0xd0, 0x44, 0x0d, 0xd8, 0x7d, 0x7d, 0xde, 0xc3, 0xbd, 0x53, 0x6f, 0x78,
+	0xea, 0x0e, 0x9a, 0x3b, 0x47, 0x7f, 0x9b, 0xb0, 0xa7, 0x75, 0xd2, 0x4f, 0x37, 0x83, 0x5e, 0x41,
+	0x2d, 0xaf, 0x8f, 0xda, 0x5b, 0x7c, 0xa5, 0x37, 0xd4, 0xfa, 0x6c, 0x0b, 0x22, 0x73, 0xeb, 0xef,
+	0xb0, 0xbf, 0x66, 0xe3, 0x37, 0xb8, 0xf5, 0xcb, 0x7b, 0x11, 0x6b, 0x3f, 0x82, 0x8e, 0x81, 0x4e,
+	0xa0, 0xbe, 0xf2, 0x33, 0xda, 0x6c, 0xe6, 0xae, 0xd7, 0x5b, 0x9f, 0xde, 0x2b, 0x03, 0x6d, 0x5a,
+	0x0f, 0x76, 0x0b, 0xde, 0x43, 0x9f, 0x6f, 0xa0, 0x37, 0x9d, 0xd9, 0xda, 0x1c, 0xe7, 0xae, 0xef,
+	0xfa, 0x50, 0xd6, 0xb2, 0x42, 0x9b, 0xd5, 0x8b, 0x72, 0x6b, 0xdd, 0xaf, 0xd1, 0x27, 0xc6, 0x33,
+	0xfc, 0xdb, 0x59, 0xc0, 0xd4, 0x65, 0x3c, 0x71, 0x7c, 0x1e, 0x76, 0x87, 0x01, 0x17, 0x78, 0x39,
+	0x21, 0x57, 0x47, 0x4f, 0x8e, 0x8f, 0xbb, 0x9a, 0xf6, 0x38, 0xe3, 0x3d, 0x96, 0x54, 0x5c, 0x33,
+	0x9f, 0x76, 0xe7, 0x57, 0x41, 0xb7, 0x78, 0xe1, 0x7c, 0xf2, 0xe3, 0x7a, 0x38, 0xa9, 0x68, 0x6d,
+	0x7e, 0xf7, 0xdf, 0x00, 0x7a, 0x20, 0x7e, 0xec, 0x10, 0x08, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SpeedControlClient is the client API for SpeedControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SpeedControlClient interface {
+	// Register stores fixation made by camera.
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// RegisterBatch stores fixations buffered by camera in one storage transaction.
+	RegisterBatch(ctx context.Context, opts ...grpc.CallOption) (SpeedControl_RegisterBatchClient, error)
+	// OverSpeed returns fixations of the day with speed greater than the limit.
+	OverSpeed(ctx context.Context, in *OverSpeedRequest, opts ...grpc.CallOption) (*FixationList, error)
+	// MinMaxSpeed returns speed statistics of the day.
+	MinMaxSpeed(ctx context.Context, in *MinMaxSpeedRequest, opts ...grpc.CallOption) (*SpeedStatistics, error)
+	// Query streams fixations of the date range matched by filter expression.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (SpeedControl_QueryClient, error)
+}
+
+type speedControlClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSpeedControlClient(cc *grpc.ClientConn) SpeedControlClient {
+	return &speedControlClient{cc}
+}
+
+func (c *speedControlClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, "/speedcontrol.v1.SpeedControl/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *speedControlClient) RegisterBatch(ctx context.Context, opts ...grpc.CallOption) (SpeedControl_RegisterBatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SpeedControl_serviceDesc.Streams[0], "/speedcontrol.v1.SpeedControl/RegisterBatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &speedControlRegisterBatchClient{stream}
+	return x, nil
+}
+
+type SpeedControl_RegisterBatchClient interface {
+	Send(*RegisterRequest) error
+	CloseAndRecv() (*RegisterBatchResponse, error)
+	grpc.ClientStream
+}
+
+type speedControlRegisterBatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *speedControlRegisterBatchClient) Send(m *RegisterRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *speedControlRegisterBatchClient) CloseAndRecv() (*RegisterBatchResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RegisterBatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *speedControlClient) OverSpeed(ctx context.Context, in *OverSpeedRequest, opts ...grpc.CallOption) (*FixationList, error) {
+	out := new(FixationList)
+	err := c.cc.Invoke(ctx, "/speedcontrol.v1.SpeedControl/OverSpeed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *speedControlClient) MinMaxSpeed(ctx context.Context, in *MinMaxSpeedRequest, opts ...grpc.CallOption) (*SpeedStatistics, error) {
+	out := new(SpeedStatistics)
+	err := c.cc.Invoke(ctx, "/speedcontrol.v1.SpeedControl/MinMaxSpeed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *speedControlClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (SpeedControl_QueryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SpeedControl_serviceDesc.Streams[1], "/speedcontrol.v1.SpeedControl/Query", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &speedControlQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SpeedControl_QueryClient interface {
+	Recv() (*Fixation, error)
+	grpc.ClientStream
+}
+
+type speedControlQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *speedControlQueryClient) Recv() (*Fixation, error) {
+	m := new(Fixation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SpeedControlServer is the server API for SpeedControl service.
+type SpeedControlServer interface {
+	// Register stores fixation made by camera.
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// RegisterBatch stores fixations buffered by camera in one storage transaction.
+	RegisterBatch(SpeedControl_RegisterBatchServer) error
+	// OverSpeed returns fixations of the day with speed greater than the limit.
+	OverSpeed(context.Context, *OverSpeedRequest) (*FixationList, error)
+	// MinMaxSpeed returns speed statistics of the day.
+	MinMaxSpeed(context.Context, *MinMaxSpeedRequest) (*SpeedStatistics, error)
+	// Query streams fixations of the date range matched by filter expression.
+	Query(*QueryRequest, SpeedControl_QueryServer) error
+}
+
+// UnimplementedSpeedControlServer can be embedded to have forward compatible implementations.
+type UnimplementedSpeedControlServer struct {
+}
+
+func (*UnimplementedSpeedControlServer) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (*UnimplementedSpeedControlServer) RegisterBatch(srv SpeedControl_RegisterBatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method RegisterBatch not implemented")
+}
+func (*UnimplementedSpeedControlServer) OverSpeed(ctx context.Context, req *OverSpeedRequest) (*FixationList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OverSpeed not implemented")
+}
+func (*UnimplementedSpeedControlServer) MinMaxSpeed(ctx context.Context, req *MinMaxSpeedRequest) (*SpeedStatistics, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MinMaxSpeed not implemented")
+}
+func (*UnimplementedSpeedControlServer) Query(req *QueryRequest, srv SpeedControl_QueryServer) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+
+func RegisterSpeedControlServer(s *grpc.Server, srv SpeedControlServer) {
+	s.RegisterService(&_SpeedControl_serviceDesc, srv)
+}
+
+func _SpeedControl_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpeedControlServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/speedcontrol.v1.SpeedControl/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpeedControlServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpeedControl_RegisterBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SpeedControlServer).RegisterBatch(&speedControlRegisterBatchServer{stream})
+}
+
+type SpeedControl_RegisterBatchServer interface {
+	SendAndClose(*RegisterBatchResponse) error
+	Recv() (*RegisterRequest, error)
+	grpc.ServerStream
+}
+
+type speedControlRegisterBatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *speedControlRegisterBatchServer) SendAndClose(m *RegisterBatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *speedControlRegisterBatchServer) Recv() (*RegisterRequest, error) {
+	m := new(RegisterRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _SpeedControl_OverSpeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OverSpeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpeedControlServer).OverSpeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/speedcontrol.v1.SpeedControl/OverSpeed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpeedControlServer).OverSpeed(ctx, req.(*OverSpeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpeedControl_MinMaxSpeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MinMaxSpeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpeedControlServer).MinMaxSpeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/speedcontrol.v1.SpeedControl/MinMaxSpeed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpeedControlServer).MinMaxSpeed(ctx, req.(*MinMaxSpeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpeedControl_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SpeedControlServer).Query(m, &speedControlQueryServer{stream})
+}
+
+type SpeedControl_QueryServer interface {
+	Send(*Fixation) error
+	grpc.ServerStream
+}
+
+type speedControlQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *speedControlQueryServer) Send(m *Fixation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _SpeedControl_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "speedcontrol.v1.SpeedControl",
+	HandlerType: (*SpeedControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _SpeedControl_Register_Handler,
+		},
+		{
+			MethodName: "OverSpeed",
+			Handler:    _SpeedControl_OverSpeed_Handler,
+		},
+		{
+			MethodName: "MinMaxSpeed",
+			Handler:    _SpeedControl_MinMaxSpeed_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RegisterBatch",
+			Handler:       _SpeedControl_RegisterBatch_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Query",
+			Handler:       _SpeedControl_Query_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "speedcontrol.proto",
+}